@@ -0,0 +1,241 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"korok"
+	"net/http"
+	"report"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ADMIN_DEFAULT_LINES = 100
+	ADMIN_MAX_LINES     = 1000
+)
+
+// 管理接口返回的CoinDeal状态
+type DealStatus struct {
+	Instance   string
+	Coin       string
+	Balance    report.Balance
+	Total      float64
+	Ratio      float64
+	PriceTime  time.Time
+	AmountTime time.Time
+	Params     RbParams
+	Paused     bool
+
+	// 强制再平衡还在等待下单
+	RebalancePending bool
+
+	// 启动后还没有再平衡时为nil
+	LastRebalance *report.RebalanceReport
+}
+
+// 管理接口, 请求必须带 Authorization: Bearer <token>, token为空时拒绝所有请求
+//
+//	GET  /api/deals                                  所有CoinDeal的状态
+//	GET  /api/deals/{instance}/{coin}                一个CoinDeal的状态
+//	POST /api/deals/{instance}/{coin}/pause          暂停下单
+//	POST /api/deals/{instance}/{coin}/resume         恢复下单
+//	POST /api/deals/{instance}/{coin}/rebalance      立即再平衡到PerfectRatio
+//	POST /api/deals/{instance}/{coin}/renew          刷新持仓并发送持仓报告
+//	GET  /api/log/level, POST /api/log/level?level=debug
+//	GET  /api/log/lines?n=100                        ring日志输出中保留的最近日志
+func NewAdminHandler(deals []*CoinDeal, token string) http.Handler {
+	admin := &Admin{Deals: deals}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/deals", methods(map[string]http.HandlerFunc{"GET": admin.ListDeals}))
+	mux.HandleFunc("/api/deals/", admin.ServeDeal)
+	mux.HandleFunc("/api/log/level", methods(map[string]http.HandlerFunc{
+		"GET":  admin.GetLogLevel,
+		"POST": admin.SetLogLevel,
+	}))
+	mux.HandleFunc("/api/log/lines", methods(map[string]http.HandlerFunc{"GET": admin.LogLines}))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if token == "" || !strings.HasPrefix(auth, "Bearer ") ||
+			subtle.ConstantTimeCompare([]byte(auth[len("Bearer "):]), []byte(token)) != 1 {
+			writeError(w, http.StatusUnauthorized, "bad or missing bearer token")
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+type Admin struct {
+	Deals []*CoinDeal
+}
+
+// 按请求方法分发, 其他方法返回405
+func methods(handlers map[string]http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		handler, ok := handlers[r.Method]
+		if !ok {
+			writeError(w, http.StatusMethodNotAllowed, r.Method+" is not allowed")
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// 分发 /api/deals/{instance}/{coin}[/{action}]
+func (admin *Admin) ServeDeal(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/deals/"), "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		writeError(w, http.StatusNotFound, "use /api/deals/{instance}/{coin}[/{action}]")
+		return
+	}
+
+	deal := admin.findDeal(parts[0], parts[1])
+	if deal == nil {
+		writeError(w, http.StatusNotFound, "no coin "+parts[1]+" in instance "+parts[0])
+		return
+	}
+
+	if len(parts) == 2 {
+		methods(map[string]http.HandlerFunc{"GET": func(w http.ResponseWriter, r *http.Request) {
+			writeJson(w, http.StatusOK, deal.Status())
+		}})(w, r)
+		return
+	}
+
+	var action func(*CoinDeal, http.ResponseWriter, *http.Request)
+	switch parts[2] {
+	case "pause":
+		action = admin.Pause
+	case "resume":
+		action = admin.Resume
+	case "rebalance":
+		action = admin.Rebalance
+	case "renew":
+		action = admin.Renew
+	default:
+		writeError(w, http.StatusNotFound, "unknown action "+parts[2])
+		return
+	}
+	methods(map[string]http.HandlerFunc{"POST": func(w http.ResponseWriter, r *http.Request) {
+		action(deal, w, r)
+	}})(w, r)
+}
+
+func (admin *Admin) findDeal(instance string, coin string) *CoinDeal {
+	for _, deal := range admin.Deals {
+		if deal.Instance == instance && deal.Info.CoinName == coin {
+			return deal
+		}
+	}
+	return nil
+}
+
+func (deal *CoinDeal) Status() *DealStatus {
+	balance := deal.Info.Balance()
+	priceTime, amountTime := deal.Info.RenewTimes()
+	status := &DealStatus{
+		Instance:   deal.Instance,
+		Coin:       deal.Info.CoinName,
+		Balance:    balance,
+		Total:      balance.Total(),
+		Ratio:      balance.Ratio(),
+		PriceTime:  priceTime,
+		AmountTime: amountTime,
+		Params:     deal.Rebalance.GetParams(),
+		Paused:     deal.Rebalance.Paused(),
+
+		RebalancePending: deal.Rebalance.ForcePending(),
+	}
+	if last := deal.Rebalance.LastRebalance(); last != nil {
+		// 资产曲线在报告邮件中, 这里不返回
+		rep := *last
+		rep.Equity = nil
+		status.LastRebalance = &rep
+	}
+	return status
+}
+
+func (admin *Admin) ListDeals(w http.ResponseWriter, r *http.Request) {
+	res := make([]*DealStatus, 0, len(admin.Deals))
+	for _, deal := range admin.Deals {
+		res = append(res, deal.Status())
+	}
+	writeJson(w, http.StatusOK, res)
+}
+
+func (admin *Admin) Pause(deal *CoinDeal, w http.ResponseWriter, r *http.Request) {
+	deal.Rebalance.Pause()
+	korok.Notice("[%s] [Admin] trading paused by %s", deal.Info.Tag, r.RemoteAddr)
+	writeJson(w, http.StatusOK, deal.Status())
+}
+
+func (admin *Admin) Resume(deal *CoinDeal, w http.ResponseWriter, r *http.Request) {
+	deal.Rebalance.Resume()
+	korok.Notice("[%s] [Admin] trading resumed by %s", deal.Info.Tag, r.RemoteAddr)
+	writeJson(w, http.StatusOK, deal.Status())
+}
+
+// 在下一次收到Info时执行, 结果见再平衡报告和LastRebalance
+func (admin *Admin) Rebalance(deal *CoinDeal, w http.ResponseWriter, r *http.Request) {
+	deal.Rebalance.ForceRebalance()
+	korok.Notice("[%s] [Admin] rebalance forced by %s", deal.Info.Tag, r.RemoteAddr)
+	writeJson(w, http.StatusAccepted, deal.Status())
+}
+
+func (admin *Admin) Renew(deal *CoinDeal, w http.ResponseWriter, r *http.Request) {
+	deal.Info.RequestRenew()
+	korok.Notice("[%s] [Admin] renew requested by %s", deal.Info.Tag, r.RemoteAddr)
+	writeJson(w, http.StatusAccepted, deal.Status())
+}
+
+func (admin *Admin) GetLogLevel(w http.ResponseWriter, r *http.Request) {
+	writeJson(w, http.StatusOK, map[string]string{"Level": korok.LevelName(korok.GetLevel())})
+}
+
+// 直到下次热加载配置前有效
+func (admin *Admin) SetLogLevel(w http.ResponseWriter, r *http.Request) {
+	level, err := korok.ParseLevel(r.FormValue("level"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	logLevel.Set(level)
+	korok.Notice("[Admin] log level set to %s by %s", korok.LevelName(level), r.RemoteAddr)
+	admin.GetLogLevel(w, r)
+}
+
+func (admin *Admin) LogLines(w http.ResponseWriter, r *http.Request) {
+	n := ADMIN_DEFAULT_LINES
+	if value := r.FormValue("n"); value != "" {
+		var err error
+		if n, err = strconv.Atoi(value); err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "n must be a positive number")
+			return
+		}
+	}
+	if n > ADMIN_MAX_LINES {
+		n = ADMIN_MAX_LINES
+	}
+
+	lines := korok.RecentLines(n)
+	if lines == nil {
+		writeError(w, http.StatusNotFound, "no ring sink in LogSinks")
+		return
+	}
+	writeJson(w, http.StatusOK, lines)
+}
+
+func writeJson(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJson(w, code, map[string]string{"Error": msg})
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"config"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"report"
+	"strings"
+	"testing"
+)
+
+const adminToken = "s3cret"
+
+func newTestAdmin(t *testing.T) (http.Handler, *CoinDeal) {
+	inst := &config.InstanceConfig{
+		Name:         "main",
+		AccessKey:    "ak",
+		SecretKey:    "sk",
+		AccountID:    "1001",
+		PerfectRatio: 1,
+		UpRatio:      1.2,
+		DownRatio:    0.8,
+	}
+	deal := NewCoinDeal(inst, "ada", report.NewHistory(), DigestSchedule{})
+	return NewAdminHandler([]*CoinDeal{deal}, adminToken), deal
+}
+
+func adminRequest(handler http.Handler, method string, path string, auth string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAdminAuth(t *testing.T) {
+	handler, _ := newTestAdmin(t)
+	cases := []struct {
+		auth string
+		want int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Bearer", http.StatusUnauthorized},
+		{"Bearer ", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"Bearer " + adminToken + "x", http.StatusUnauthorized},
+		{"Basic " + adminToken, http.StatusUnauthorized},
+		{"bearer " + adminToken, http.StatusUnauthorized},
+		{"Bearer " + adminToken, http.StatusOK},
+	}
+	for _, c := range cases {
+		for _, path := range []string{"/api/deals", "/api/deals/main/ada/pause", "/api/log/level"} {
+			method := "GET"
+			if strings.HasSuffix(path, "/pause") {
+				method = "POST"
+			}
+			rec := adminRequest(handler, method, path, c.auth)
+			if rec.Code != c.want {
+				t.Errorf("%s %s with %q: %d, want %d", method, path, c.auth, rec.Code, c.want)
+			}
+		}
+	}
+
+	// token为空时拒绝所有请求
+	empty := NewAdminHandler(nil, "")
+	for _, auth := range []string{"", "Bearer ", "Bearer x"} {
+		if rec := adminRequest(empty, "GET", "/api/deals", auth); rec.Code != http.StatusUnauthorized {
+			t.Errorf("empty token with %q: %d, want 401", auth, rec.Code)
+		}
+	}
+}
+
+func TestAdminMethods(t *testing.T) {
+	handler, deal := newTestAdmin(t)
+	cases := []struct {
+		method string
+		path   string
+	}{
+		{"GET", "/api/deals/main/ada/pause"},
+		{"GET", "/api/deals/main/ada/resume"},
+		{"GET", "/api/deals/main/ada/rebalance"},
+		{"GET", "/api/deals/main/ada/renew"},
+		{"PUT", "/api/deals/main/ada/pause"},
+		{"DELETE", "/api/deals/main/ada/rebalance"},
+		{"POST", "/api/deals"},
+		{"POST", "/api/deals/main/ada"},
+		{"PUT", "/api/log/level"},
+		{"POST", "/api/log/lines"},
+	}
+	for _, c := range cases {
+		rec := adminRequest(handler, c.method, c.path, "Bearer "+adminToken)
+		if rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("%s %s: %d, want 405", c.method, c.path, rec.Code)
+		}
+	}
+
+	// 不允许的方法不能改变状态
+	if deal.Rebalance.Paused() || deal.Rebalance.ForcePending() || len(deal.Info.renewChannel) != 0 {
+		t.Errorf("rejected requests changed state: paused %v force %v renew %d",
+			deal.Rebalance.Paused(), deal.Rebalance.ForcePending(), len(deal.Info.renewChannel))
+	}
+}
+
+func TestAdminNotFound(t *testing.T) {
+	handler, _ := newTestAdmin(t)
+	for _, path := range []string{
+		"/api/deals/main",
+		"/api/deals/main/dot",
+		"/api/deals/alt/ada",
+		"/api/deals/main/ada/sell",
+		"/api/deals/main/ada/pause/now",
+	} {
+		if rec := adminRequest(handler, "POST", path, "Bearer "+adminToken); rec.Code != http.StatusNotFound {
+			t.Errorf("POST %s: %d, want 404", path, rec.Code)
+		}
+	}
+}
+
+func TestAdminActions(t *testing.T) {
+	handler, deal := newTestAdmin(t)
+	post := func(action string, wantCode int) *DealStatus {
+		rec := adminRequest(handler, "POST", "/api/deals/main/ada/"+action, "Bearer "+adminToken)
+		if rec.Code != wantCode {
+			t.Fatalf("POST %s: %d, want %d: %s", action, rec.Code, wantCode, rec.Body)
+		}
+		status := &DealStatus{}
+		if err := json.Unmarshal(rec.Body.Bytes(), status); err != nil {
+			t.Fatalf("POST %s: %s", action, err)
+		}
+		return status
+	}
+
+	if status := post("pause", http.StatusOK); !status.Paused || !deal.Rebalance.Paused() {
+		t.Errorf("pause: status %v, Paused() %v, want true", status.Paused, deal.Rebalance.Paused())
+	}
+	if status := post("resume", http.StatusOK); status.Paused || deal.Rebalance.Paused() {
+		t.Errorf("resume: status %v, Paused() %v, want false", status.Paused, deal.Rebalance.Paused())
+	}
+
+	status := post("rebalance", http.StatusAccepted)
+	if !status.RebalancePending || !deal.Rebalance.ForcePending() {
+		t.Errorf("rebalance: status %v, ForcePending() %v, want true", status.RebalancePending, deal.Rebalance.ForcePending())
+	}
+	if status.Instance != "main" || status.Coin != "ada" || status.Params != deal.Rebalance.GetParams() {
+		t.Errorf("rebalance status %+v", status)
+	}
+
+	// 连续请求只保留一次刷新信号
+	post("renew", http.StatusAccepted)
+	post("renew", http.StatusAccepted)
+	if n := len(deal.Info.renewChannel); n != 1 {
+		t.Errorf("renew: %d pending signals, want 1", n)
+	}
+
+	rec := adminRequest(handler, "GET", "/api/deals", "Bearer "+adminToken)
+	var list []*DealStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Paused || !list[0].RebalancePending {
+		t.Errorf("list after actions: %s", rec.Body)
+	}
+}
@@ -2,149 +2,364 @@ package main
 
 import (
 	"config"
+	"context"
 	"errors"
 	"fmt"
 	"korok"
 	"models"
+	"notify"
+	"report"
 	"services"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
+	"untils"
 )
 
+type RbParams struct {
+	PerfectRatio float64
+
+	UpRatio   float64
+	DownRatio float64
+}
+
 type Info struct {
 	CoinPrice  float64
 	CoinAmount float64
 	USDTAmount float64
 }
 
+const (
+	PLACE_TIMEOUT = 10000 //ms
+
+	// 市价单成交明细可能稍后才能查到
+	MATCH_RESULTS_RETRY    = 3
+	MATCH_RESULTS_INTERVAL = 500 //ms
+)
+
 const (
 	ACTION_NONEED = iota
 	ACTION_SELL
 	ACTION_BUY
 )
 
-func NewARStrategy(name string, accountID string) *AutoRebalance {
+func NewARStrategy(name string, inst *config.InstanceConfig, history *report.History) *AutoRebalance {
 	return &AutoRebalance{
-		CoinName:     name,
-		AccountID:    accountID,
-		PerfectRatio: config.ShannonConf.PerfectRatio,
-		UpRatio:      config.ShannonConf.UpRatio,
-		DownRatio:    config.ShannonConf.DownRatio,
-		InfoChannel:  make(chan *Info, 100),
+		Instance:  inst.Name,
+		CoinName:  name,
+		AccountID: inst.AccountID,
+		Tag:       inst.Name + "/" + name,
+		ToMail:    inst.ToMail,
+		Credential: &untils.Credential{
+			AccessKey: inst.AccessKey,
+			SecretKey: inst.SecretKey,
+		},
+		Params: RbParams{
+			PerfectRatio: inst.PerfectRatio,
+			UpRatio:      inst.UpRatio,
+			DownRatio:    inst.DownRatio,
+		},
+		History:     history,
+		InfoChannel: make(chan *Info, 100),
 	}
 }
 
 type AutoRebalance struct {
+	Instance  string
 	CoinName  string
 	AccountID string
 
+	// 日志和邮件中标识实例
+	Tag        string
+	ToMail     string
+	Credential *untils.Credential
+
 	LastRbTime       time.Time
 	LastRbCoinPrice  float64
 	LastRbCoinAmount float64
 	LastRbUSDTAmount float64
 
-	PerfectRatio float64
+	ParamsMu sync.Mutex
+	Params   RbParams
 
-	UpRatio   float64
-	DownRatio float64
+	History *report.History
 
 	InfoChannel chan *Info
+
+	// 暂停时只计算比例, 不下单
+	paused int32
+	// 下次收到Info时即使比例在区间内也再平衡到PerfectRatio
+	force int32
+
+	lastMu     sync.Mutex
+	lastReport *report.RebalanceReport
+
+	// 每次再平衡后调用, 用于刷新持仓
+	AfterRebalance func()
+}
+
+func (ar *AutoRebalance) GetParams() RbParams {
+	ar.ParamsMu.Lock()
+	defer ar.ParamsMu.Unlock()
+	return ar.Params
+}
+
+// 替换策略参数, 从下一次收到Info时生效
+func (ar *AutoRebalance) SetParams(params RbParams) (old RbParams) {
+	ar.ParamsMu.Lock()
+	defer ar.ParamsMu.Unlock()
+	old = ar.Params
+	ar.Params = params
+	return old
 }
 
 func (ar *AutoRebalance) ReceiveInfo(info *Info) {
 	ar.InfoChannel <- info
 }
 
-func (ar *AutoRebalance) RunRbRountine(Signal chan int) {
-	go ar.AutoRb(Signal)
+// 暂停下单直到Resume, 仍然计算比例
+func (ar *AutoRebalance) Pause() {
+	atomic.StoreInt32(&ar.paused, 1)
+}
+
+func (ar *AutoRebalance) Resume() {
+	atomic.StoreInt32(&ar.paused, 0)
+}
+
+func (ar *AutoRebalance) Paused() bool {
+	return atomic.LoadInt32(&ar.paused) == 1
+}
+
+// 下次收到Info时再平衡到PerfectRatio, 比例在区间内或暂停时也执行
+func (ar *AutoRebalance) ForceRebalance() {
+	atomic.StoreInt32(&ar.force, 1)
+}
+
+// 强制再平衡还没有下单
+func (ar *AutoRebalance) ForcePending() bool {
+	return atomic.LoadInt32(&ar.force) == 1
 }
 
-func (ar *AutoRebalance) AutoRb(Signal chan int) {
+// 最近一次再平衡的报告, 启动后还没有时为nil
+func (ar *AutoRebalance) LastRebalance() *report.RebalanceReport {
+	ar.lastMu.Lock()
+	defer ar.lastMu.Unlock()
+	return ar.lastReport
+}
+
+func (ar *AutoRebalance) RunRbRountine() {
+	go ar.AutoRb()
+}
+
+func (ar *AutoRebalance) AutoRb() {
+	defer korok.FlushOnPanic()
 	for {
 		select {
 		case info := <-ar.InfoChannel:
-			opRecord, isChange := ar.HandleInfo(info)
+			rep, isChange := ar.HandleInfo(info)
 			if isChange {
-				korok.Info("[BlockChain] %s Rebalance Happend !!", ar.CoinName)
-				mailHead := fmt.Sprintf("[BlockChain] %s Rebalance Happend !!", ar.CoinName)
-				go SendMail(mailHead, opRecord)
-				Signal <- 1
+				level := notify.LEVEL_NOTICE
+				mailHead := fmt.Sprintf("[BlockChain][%s] %s Rebalance Happend !!", ar.Tag, ar.CoinName)
+				if rep.Error != "" {
+					level = notify.LEVEL_ERROR
+					mailHead = fmt.Sprintf("[BlockChain][%s] %s Rebalance Failed !!", ar.Tag, ar.CoinName)
+				}
+				ctx := korok.WithLogID(context.Background(), rep.LogID)
+				korok.InfoCtx(ctx, "[%s] [BlockChain] %s Rebalance Happend !!", ar.Tag, ar.CoinName)
+				go SendReport(ctx, level, ar.Tag, ar.ToMail, mailHead, report.TEMPLATE_REBALANCE, rep)
+
+				ar.lastMu.Lock()
+				ar.lastReport = rep
+				ar.lastMu.Unlock()
+				if ar.AfterRebalance != nil {
+					ar.AfterRebalance()
+				}
 			}
 		}
 	}
 }
 
-func (ar *AutoRebalance) HandleInfo(info *Info) (opRecord string, isChange bool) {
+func (ar *AutoRebalance) newReport(logid uint32, info *Info) *report.RebalanceReport {
+	now := time.Now()
+	return &report.RebalanceReport{
+		LogID: logid,
+		Tag:   ar.Tag,
+		Coin:  ar.CoinName,
+		Time:  now,
+		Before: report.Balance{
+			CoinPrice:  info.CoinPrice,
+			CoinAmount: info.CoinAmount,
+			USDTAmount: info.USDTAmount,
+		},
+		Equity: ar.History.Since(now.Add(-time.Duration(report.HISTORY_WINDOW) * time.Hour)),
+	}
+}
+
+func (ar *AutoRebalance) HandleInfo(info *Info) (rep *report.RebalanceReport, isChange bool) {
 	ratio, err := ar.CurrRatio(info)
 	if err != nil {
-		opRecord = "Compute CurrRatio Failed."
-		return opRecord, true
+		rep = ar.newReport(korok.NewLogID(), info)
+		rep.Error = "Compute CurrRatio Failed."
+		return rep, true
+	}
+	params := ar.GetParams()
+	observeRatio(ar.Instance, ar.CoinName, params, ratio)
+	action := ar.RbAction(&params, ratio)
+	force := ar.ForcePending()
+	if force && action == ACTION_NONEED {
+		action = ar.ForceAction(&params, ratio)
 	}
-	action := ar.RbAction(ratio)
 	if action == ACTION_NONEED {
+		// 比例正好是PerfectRatio, 强制再平衡已无需下单
+		atomic.StoreInt32(&ar.force, 0)
+		isChange = false
+		return
+	}
+	if !force && ar.Paused() {
+		korok.Debug("[%s] paused, skip %s at ratio %f", ar.Tag, actionName(action), ratio)
 		isChange = false
 		return
 	}
+	// 一次再平衡的决策, 下单, 成交和通知使用同一个logid
+	logid := korok.NewLogID()
+	ctx := korok.WithLogID(context.Background(), logid)
+
 	totalAsset := info.CoinPrice*info.CoinAmount + info.USDTAmount
-	perfectCoinAsset := totalAsset * (ar.PerfectRatio / (ar.PerfectRatio + 1))
-	korok.Info("AutoRb, ratio: %v, info.CoinAmount: %v, info.USDTAmount: %v", ratio, info.CoinAmount, info.USDTAmount)
+	perfectCoinAsset := totalAsset * (params.PerfectRatio / (params.PerfectRatio + 1))
+	korok.InfowCtx(ctx, "AutoRb", "tag", ar.Tag, "coin", ar.CoinName, "ratio", ratio, "coin_amount", info.CoinAmount, "usdt_amount", info.USDTAmount)
 	if info.CoinAmount == ar.LastRbCoinAmount || info.USDTAmount == ar.LastRbUSDTAmount {
-		korok.Fatal("need renew amount info")
+		korok.WarnCtx(ctx, "[%s] need renew amount info", ar.Tag)
+		rebalancesCounter.With(ar.Instance, ar.CoinName, actionName(action), RESULT_SKIPPED).Inc()
 		isChange = false
 		return
 	}
 
-	korok.Info("AutoRb, totalAsset: %f, perfectCoinAsset: %f", totalAsset, perfectCoinAsset)
+	korok.InfowCtx(ctx, "AutoRb", "tag", ar.Tag, "coin", ar.CoinName, "total_asset", totalAsset, "perfect_coin_asset", perfectCoinAsset)
+
+	// 强制再平衡在真正下单时才清除, 之前跳过时留到下一次Info
+	atomic.StoreInt32(&ar.force, 0)
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(PLACE_TIMEOUT)*time.Millisecond)
+	defer cancel()
+	ctx = untils.WithCredential(ctx, ar.Credential)
+
+	rep = ar.newReport(logid, info)
+	rep.Price = info.CoinPrice
 
 	var placeErr error
 	if action == ACTION_SELL {
 		coinSellAsset := info.CoinAmount*info.CoinPrice - perfectCoinAsset
 		coinSellAmount := coinSellAsset / info.CoinPrice
-		korok.Info("AutoRb, coinSellAsset: %f, coinSellAmount: %f", coinSellAsset, coinSellAmount)
+		korok.InfowCtx(ctx, "AutoRb sell", "tag", ar.Tag, "coin", ar.CoinName, "asset", coinSellAsset, "amount", coinSellAmount)
 
-		opRecord += fmt.Sprintf("<h1>SELL %s HAPPEND !</h1>\n\n", ar.CoinName)
-		opRecord += fmt.Sprintf("<h2>SELL INFO</h2>\n")
-		opRecord += fmt.Sprintf("SELL COIN: %s\n", ar.CoinName)
-		opRecord += fmt.Sprintf("SELL AMOUNT: %f\n", coinSellAmount)
-		opRecord += fmt.Sprintf("SELL PRICE: %f\n", info.CoinPrice)
-		opRecord += fmt.Sprintf("SELL ASSET: %f\n\n", coinSellAsset)
+		rep.Action = actionName(action)
+		rep.Amount = coinSellAmount
+		rep.Asset = coinSellAsset
 
-		placeErr = ar.SellCoin(coinSellAmount)
+		rep.OrderID, placeErr = ar.SellCoin(ctx, coinSellAmount)
 	} else if action == ACTION_BUY {
 		coinBuyAsset := perfectCoinAsset - info.CoinAmount*info.CoinPrice
 		coinBuyAmount := coinBuyAsset / info.CoinPrice
 
-		korok.Info("AutoRb, coinBuyAsset: %f, coinBuyAmount: %f", coinBuyAsset, coinBuyAmount)
+		korok.InfowCtx(ctx, "AutoRb buy", "tag", ar.Tag, "coin", ar.CoinName, "asset", coinBuyAsset, "amount", coinBuyAmount)
 
-		opRecord += fmt.Sprintf("<h1>BUY %s HAPPEND !</h1>\n\n", ar.CoinName)
-		opRecord += fmt.Sprintf("<h2>BUY INFO</h2>\n")
-		opRecord += fmt.Sprintf("BUY COIN: %s\n", ar.CoinName)
-		opRecord += fmt.Sprintf("BUY AMOUNT: %f\n", coinBuyAmount)
-		opRecord += fmt.Sprintf("BUY PRICE: %f\n", info.CoinPrice)
-		opRecord += fmt.Sprintf("BUY ASSET: %f\n\n", coinBuyAsset)
+		rep.Action = actionName(action)
+		rep.Amount = coinBuyAmount
+		rep.Asset = coinBuyAsset
 
-		placeErr = ar.BuyCoin(coinBuyAsset)
+		rep.OrderID, placeErr = ar.BuyCoin(ctx, coinBuyAsset)
 	}
 
 	if placeErr != nil {
+		rebalancesCounter.With(ar.Instance, ar.CoinName, rep.Action, RESULT_ERROR).Inc()
 		isChange = false
 		return
 	}
+	rebalancesCounter.With(ar.Instance, ar.CoinName, rep.Action, RESULT_OK).Inc()
 
 	ar.LastRbTime = time.Now()
 	ar.LastRbCoinPrice = info.CoinPrice
 	ar.LastRbCoinAmount = info.CoinAmount
 	ar.LastRbUSDTAmount = info.USDTAmount
 
-	opRecord += fmt.Sprintf("<h2>BEFORE SELL/BUY INFO</h2>\n")
-	opRecord += fmt.Sprintf("BEFORE COIN AMOUNT: %f\n", info.CoinAmount)
-	opRecord += fmt.Sprintf("BEFORE COIN ASSET: %f\n", info.CoinAmount*info.CoinPrice)
-	opRecord += fmt.Sprintf("BEFORE USDT ASSET: %f\n", info.USDTAmount)
-	opRecord += fmt.Sprintf("BEFORE %s/usdt RATIO: %f", ar.CoinName, info.CoinAmount*info.CoinPrice/info.USDTAmount)
+	// 成交明细和下单后的持仓只用于报告, 查询失败不影响再平衡结果
+	rep.Fills = ar.QueryFills(ctx, rep.OrderID)
+	rep.After = ar.QueryBalance(ctx, info.CoinPrice)
+
+	ar.History.AddRebalance(report.RebalanceRecord{
+		Time:   ar.LastRbTime,
+		Action: rep.Action,
+		Price:  rep.Price,
+		Amount: rep.Amount,
+		Fees:   rep.Fees(),
+	})
+
+	return rep, true
+}
+
+// 查询订单的成交明细, 没有查到时重试几次
+func (ar *AutoRebalance) QueryFills(ctx context.Context, orderID string) []report.Fill {
+	for i := 0; i < MATCH_RESULTS_RETRY; i++ {
+		if i > 0 {
+			select {
+			case <-time.After(time.Duration(MATCH_RESULTS_INTERVAL) * time.Millisecond):
+			case <-ctx.Done():
+				return nil
+			}
+		}
+
+		res, err := services.GetMatchResults(ctx, orderID)
+		if err != nil {
+			continue
+		}
+		if res.Status != "ok" {
+			korok.ErrorCtx(ctx, "[%s] GetMatchResults Failed with ErrCode: %s, ErrMsg: %s", ar.Tag, res.ErrCode, res.ErrMsg)
+			continue
+		}
+		if len(res.Data) == 0 {
+			continue
+		}
+
+		fills := make([]report.Fill, 0, len(res.Data))
+		for _, match := range res.Data {
+			price, _ := strconv.ParseFloat(match.Price, 64)
+			amount, _ := strconv.ParseFloat(match.FilledAmount, 64)
+			fee, _ := strconv.ParseFloat(match.FilledFees, 64)
+			fills = append(fills, report.Fill{
+				Time:        time.Unix(0, match.CreatedAt*int64(time.Millisecond)),
+				Price:       price,
+				Amount:      amount,
+				Fee:         fee,
+				FeeCurrency: match.FeeCurrency,
+			})
+		}
+		return fills
+	}
+
+	korok.ErrorCtx(ctx, "[%s] no match results of order %s", ar.Tag, orderID)
+	return nil
+}
 
-	return opRecord, true
+// 查询下单后的持仓
+func (ar *AutoRebalance) QueryBalance(ctx context.Context, price float64) *report.Balance {
+	balance, err := services.GetAccountBalance(ctx, ar.AccountID)
+	if err != nil {
+		return nil
+	}
+	coinAmount, usdtAmount, err := ParseAmounts(balance, ar.CoinName)
+	if err != nil {
+		korok.ErrorCtx(ctx, "[%s] %s", ar.Tag, err)
+		return nil
+	}
+	return &report.Balance{
+		CoinPrice:  price,
+		CoinAmount: coinAmount,
+		USDTAmount: usdtAmount,
+	}
 }
 
-func (ar *AutoRebalance) BuyCoin(amount float64) error {
+func (ar *AutoRebalance) BuyCoin(ctx context.Context, amount float64) (string, error) {
 
 	buyPara := models.PlaceRequestParams{
 		AccountID: ar.AccountID,
@@ -154,22 +369,26 @@ func (ar *AutoRebalance) BuyCoin(amount float64) error {
 		Type:      "buy-market",
 	}
 
-	korok.Info("AutoRb, BuyPara: %v", buyPara)
-	res, err := services.Place(buyPara)
+	korok.InfowCtx(ctx, "AutoRb place", "tag", ar.Tag, "coin", ar.CoinName, "params", buyPara)
+	res, err := services.Place(ctx, buyPara)
 	if err != nil {
-		korok.Fatal("Place Buy Faild: %s", err)
-		return err
+		korok.ErrorCtx(ctx, "[%s] Place Buy Faild: %s", ar.Tag, err)
+		ordersCounter.With(ar.Instance, ar.CoinName, "buy", RESULT_ERROR).Inc()
+		return "", err
 	}
 
 	if res.Status != "ok" {
-		korok.Fatal("Place Buy Faild with ErrCode: %s, ErrMsg: %s", res.ErrCode, res.ErrMsg)
-		return errors.New(fmt.Sprintf("Place Buy Faild with ErrCode: %s, ErrMsg: %s", res.ErrCode, res.ErrMsg))
+		korok.ErrorwCtx(ctx, "Place Buy Faild", "tag", ar.Tag, "coin", ar.CoinName, "err_code", res.ErrCode, "err_msg", res.ErrMsg)
+		ordersCounter.With(ar.Instance, ar.CoinName, "buy", RESULT_ERROR).Inc()
+		return "", errors.New(fmt.Sprintf("Place Buy Faild with ErrCode: %s, ErrMsg: %s", res.ErrCode, res.ErrMsg))
 	}
 
-	return nil
+	korok.InfowCtx(ctx, "AutoRb order placed", "tag", ar.Tag, "coin", ar.CoinName, "order_id", res.Data, "type", buyPara.Type)
+	ordersCounter.With(ar.Instance, ar.CoinName, "buy", RESULT_OK).Inc()
+	return res.Data, nil
 }
 
-func (ar *AutoRebalance) SellCoin(amount float64) error {
+func (ar *AutoRebalance) SellCoin(ctx context.Context, amount float64) (string, error) {
 
 	sellPara := models.PlaceRequestParams{
 		AccountID: ar.AccountID,
@@ -178,33 +397,58 @@ func (ar *AutoRebalance) SellCoin(amount float64) error {
 		Symbol:    ar.CoinName + "usdt",
 		Type:      "sell-market",
 	}
-	korok.Info("AutoRb, SellPara: %v", sellPara)
-	res, err := services.Place(sellPara)
+	korok.InfowCtx(ctx, "AutoRb place", "tag", ar.Tag, "coin", ar.CoinName, "params", sellPara)
+	res, err := services.Place(ctx, sellPara)
 	if err != nil {
-		korok.Fatal("Place Sell Faild: %s", err)
-		return err
+		korok.ErrorCtx(ctx, "[%s] Place Sell Faild: %s", ar.Tag, err)
+		ordersCounter.With(ar.Instance, ar.CoinName, "sell", RESULT_ERROR).Inc()
+		return "", err
 	}
 
 	if res.Status != "ok" {
-		korok.Fatal("Place Sell Faild with ErrCode: %s, ErrMsg: %s", res.ErrCode, res.ErrMsg)
-		return errors.New(fmt.Sprintf("Place Sell Faild with ErrCode: %s, ErrMsg: %s", res.ErrCode, res.ErrMsg))
+		korok.ErrorwCtx(ctx, "Place Sell Faild", "tag", ar.Tag, "coin", ar.CoinName, "err_code", res.ErrCode, "err_msg", res.ErrMsg)
+		ordersCounter.With(ar.Instance, ar.CoinName, "sell", RESULT_ERROR).Inc()
+		return "", errors.New(fmt.Sprintf("Place Sell Faild with ErrCode: %s, ErrMsg: %s", res.ErrCode, res.ErrMsg))
 	}
 
-	return nil
+	korok.InfowCtx(ctx, "AutoRb order placed", "tag", ar.Tag, "coin", ar.CoinName, "order_id", res.Data, "type", sellPara.Type)
+	ordersCounter.With(ar.Instance, ar.CoinName, "sell", RESULT_OK).Inc()
+	return res.Data, nil
 }
 
 func (ar *AutoRebalance) CurrRatio(info *Info) (float64, error) {
 	if info.CoinAmount <= 0 || info.USDTAmount <= 0 || info.CoinPrice <= 0 {
-		korok.Fatal("Amount Error, CoinPrice: %f, CoinAmount: %f, USDTAmount: %f", info.CoinPrice, info.CoinAmount, info.USDTAmount)
+		korok.Error("[%s] Amount Error, CoinPrice: %f, CoinAmount: %f, USDTAmount: %f", ar.Tag, info.CoinPrice, info.CoinAmount, info.USDTAmount)
 		return 0, errors.New("Amount Error")
 	}
 	return info.CoinPrice * info.CoinAmount / info.USDTAmount, nil
 }
 
-func (ar *AutoRebalance) RbAction(ratio float64) int {
-	if ratio > ar.UpRatio {
+// 指标和报告中的操作名
+func actionName(action int) string {
+	switch action {
+	case ACTION_SELL:
+		return "SELL"
+	case ACTION_BUY:
+		return "BUY"
+	}
+	return "NONE"
+}
+
+// 强制再平衡时按PerfectRatio决定方向
+func (ar *AutoRebalance) ForceAction(params *RbParams, ratio float64) int {
+	if ratio > params.PerfectRatio {
+		return ACTION_SELL
+	} else if ratio < params.PerfectRatio {
+		return ACTION_BUY
+	}
+	return ACTION_NONEED
+}
+
+func (ar *AutoRebalance) RbAction(params *RbParams, ratio float64) int {
+	if ratio > params.UpRatio {
 		return ACTION_SELL
-	} else if ratio < ar.DownRatio {
+	} else if ratio < params.DownRatio {
 		return ACTION_BUY
 	}
 	return ACTION_NONEED
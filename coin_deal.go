@@ -0,0 +1,77 @@
+package main
+
+import (
+	"config"
+	"korok"
+	"path/filepath"
+	"report"
+	"time"
+)
+
+// 一个实例中一个币种的策略, 各自持有状态
+type CoinDeal struct {
+	Instance string
+
+	Info      *CoinInfo
+	Rebalance *AutoRebalance
+
+	// 资产曲线, 持仓报告和再平衡报告共用
+	History *report.History
+}
+
+func NewCoinDeal(inst *config.InstanceConfig, coin string, history *report.History, schedule DigestSchedule) *CoinDeal {
+	info := NewCoinInfo(coin, inst, history)
+	info.Schedule = schedule
+	rebalance := NewARStrategy(coin, inst, history)
+	// 再平衡后持仓变化, 立即刷新并发送持仓报告
+	rebalance.AfterRebalance = info.RequestRenew
+	return &CoinDeal{
+		Instance:  inst.Name,
+		Info:      info,
+		Rebalance: rebalance,
+		History:   history,
+	}
+}
+
+// 为每个实例的每个币种创建CoinDeal, 并从SnapshotDir加载资产快照
+func NewCoinDeals(conf *config.ShannonConfig) ([]*CoinDeal, error) {
+	schedule, err := NewDigestSchedule(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	var deals []*CoinDeal
+	for _, inst := range conf.Instances {
+		for _, coin := range inst.Coins {
+			path := filepath.Join(conf.SnapshotDir, inst.Name+"_"+coin+".jsonl")
+			history, err := report.OpenHistory(path)
+			if err != nil {
+				return nil, err
+			}
+			deals = append(deals, NewCoinDeal(inst, coin, history, schedule))
+		}
+	}
+	return deals, nil
+}
+
+func (deal *CoinDeal) AutoRenew() {
+	deal.Info.RunRenewRoutine()
+}
+
+func (deal *CoinDeal) AutoRb() {
+	defer korok.FlushOnPanic()
+	deal.Rebalance.RunRbRountine()
+	clocker := time.NewTicker(time.Duration(RENEW_INTERVAL) * time.Millisecond)
+	for {
+		select {
+		case <-clocker.C:
+			info := &Info{
+				CoinPrice:  deal.Info.GetCoinPrice(),
+				CoinAmount: deal.Info.GetCoinAmount(),
+				USDTAmount: deal.Info.GetUSDTAmount(),
+			}
+
+			deal.Rebalance.ReceiveInfo(info)
+		}
+	}
+}
@@ -1,93 +1,176 @@
 package main
 
 import (
+	"config"
+	"context"
 	"errors"
 	"korok"
+	"models"
+	"notify"
+	"report"
 	"services"
 	"strconv"
 	"sync"
+	"sync/atomic"
+	"untils"
 	//"encoding/json"
 	"fmt"
 	"time"
 )
 
 const (
-	RENEW_INTERVAL = 500 //ms
+	RENEW_INTERVAL = 500  //ms
+	RENEW_TIMEOUT  = 3000 //ms
 )
 
-func NewCoinInfo(name string, accountID string) *CoinInfo {
+func NewCoinInfo(name string, inst *config.InstanceConfig, history *report.History) *CoinInfo {
 	return &CoinInfo{
-		CoinName:        name,
-		AccountID:       accountID,
-		NeedRenewAmount: true,
+		Instance:  inst.Name,
+		CoinName:  name,
+		AccountID: inst.AccountID,
+		Tag:       inst.Name + "/" + name,
+		ToMail:    inst.ToMail,
+		Credential: &untils.Credential{
+			AccessKey: inst.AccessKey,
+			SecretKey: inst.SecretKey,
+		},
+		History:      history,
+		renewChannel: make(chan struct{}, 1),
 	}
 }
 
 type CoinInfo struct {
+	Instance  string
 	CoinName  string
 	AccountID string
 
-	NeedRenewAmount bool
+	// 日志和邮件中标识实例
+	Tag        string
+	ToMail     string
+	Credential *untils.Credential
+
+	// RequestRenew的信号, 立即刷新并发送持仓报告
+	renewChannel chan struct{}
+
+	// 资产曲线, 每次刷新后记录
+	History  *report.History
+	Schedule DigestSchedule
 
 	Mu sync.Mutex
 
 	CoinPrice  float64
 	CoinAmount float64
 	USDTAmount float64
+	PriceTime  time.Time // 价格最近一次刷新成功的时间
+	AmountTime time.Time // 持仓最近一次刷新成功的时间
+
+	// 健康检查用: ClockRenew最近一轮结束的时间(UnixNano), 连续刷新失败的轮数
+	heartbeat int64
+	failures  int32
 }
 
 func (ci *CoinInfo) RunRenewRoutine() {
+	// 启动后先发送一次持仓报告
+	ci.RequestRenew()
+	atomic.StoreInt64(&ci.heartbeat, time.Now().UnixNano())
 	go ci.ClockRenew()
-	go ci.ClockMail()
+	go ci.ClockDigest(ci.Schedule)
 }
 
-func (ci *CoinInfo) ClockMail() {
-	clocker := time.NewTicker(time.Duration(30) * time.Minute)
-	for {
-		select {
-		case <-clocker.C:
-			mailHead := "[BlockChain] Ticker Inform"
-			mailBody := ci.CoinInfoBody(mailHead)
-			go SendMail(mailHead, mailBody)
-		}
+// 立即刷新价格和持仓并发送持仓报告, 再平衡后和管理接口使用
+func (ci *CoinInfo) RequestRenew() {
+	select {
+	case ci.renewChannel <- struct{}{}:
+	default:
 	}
 }
 
 func (ci *CoinInfo) ClockRenew() {
+	defer korok.FlushOnPanic()
 	var round int = 0
 	clocker := time.NewTicker(time.Duration(RENEW_INTERVAL) * time.Millisecond)
 	for {
 		select {
 		case <-clocker.C:
-			ci.RenewAmountInfo()
-			err := ci.RenewPriceInfo()
 			round = (round + 1) % 20
-			if err == nil && round == 0 {
-				korok.Info("[Price Info] %s price: %f.", ci.CoinName, ci.GetCoinPrice())
-			}
-			if ci.NeedRenewAmount {
-				korok.Info("[Amount Info] %s amount: %f, usdt amount: %f.", ci.CoinName, ci.GetCoinAmount(), ci.GetUSDTAmount())
-				ci.NeedRenewAmount = false
-				mailHead := "[BlockChain] Renew Inform !!!"
-				mailBody := ci.CoinInfoBody(mailHead)
-				go SendMail(mailHead, mailBody)
-			}
+			ci.Renew(round == 0, false)
+		case <-ci.renewChannel:
+			ci.Renew(true, true)
 		}
 	}
 }
 
-func (ci *CoinInfo) CoinInfoBody(head string) (body string) {
-	coinAmount := ci.GetCoinAmount()
-	coinPrice := ci.GetCoinPrice()
-	usdtAmount := ci.GetUSDTAmount()
+// 刷新一次价格和持仓, logPrice时输出价格日志, sendReport时发送持仓报告
+func (ci *CoinInfo) Renew(logPrice bool, sendReport bool) {
+	// 每次刷新一个logid
+	ctx := korok.WithLogID(context.Background(), korok.NewLogID())
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(RENEW_TIMEOUT)*time.Millisecond)
+	defer cancel()
+	ctx = untils.WithCredential(ctx, ci.Credential)
 
-	body += head
-	body += fmt.Sprintf("\n\nCOIN: %s\n", ci.CoinName)
-	body += fmt.Sprintf("COIN AMOUNT: %f, COIN PRICE: %f\n", coinAmount, coinPrice)
-	body += fmt.Sprintf("COIN ASSET: %f, USDT ASSET: %f\n", coinAmount*coinPrice, usdtAmount)
-	body += fmt.Sprintf("COIN / USDT RATIO: %s/usdt: %f\n\n\n", ci.CoinName, coinAmount*coinPrice/usdtAmount)
-	body += fmt.Sprintf("TOTAL ASSET: %f\n", coinAmount*coinPrice+usdtAmount)
-	return body
+	amountErr := ci.RenewAmountInfo(ctx)
+	err := ci.RenewPriceInfo(ctx)
+	if amountErr == nil && err == nil {
+		atomic.StoreInt32(&ci.failures, 0)
+		balance := ci.Balance()
+		ci.History.Add(report.EquityPoint{Time: time.Now(), Balance: balance})
+		equityGauge.With(ci.Instance, ci.CoinName).Set(balance.Total())
+	} else {
+		atomic.AddInt32(&ci.failures, 1)
+	}
+	atomic.StoreInt64(&ci.heartbeat, time.Now().UnixNano())
+	if err == nil && logPrice {
+		korok.InfoCtx(ctx, "[%s] [Price Info] %s price: %f.", ci.Tag, ci.CoinName, ci.GetCoinPrice())
+	}
+	if sendReport {
+		korok.InfoCtx(ctx, "[%s] [Amount Info] %s amount: %f, usdt amount: %f.", ci.Tag, ci.CoinName, ci.GetCoinAmount(), ci.GetUSDTAmount())
+		mailHead := fmt.Sprintf("[BlockChain][%s] Renew Inform !!!", ci.Tag)
+		go SendReport(ctx, notify.LEVEL_INFO, ci.Tag, ci.ToMail, mailHead, report.TEMPLATE_TICKER, ci.TickerReport(mailHead))
+	}
+}
+
+// 价格和持仓最近一次刷新成功的时间, 还没有成功时为零值
+func (ci *CoinInfo) RenewTimes() (priceTime time.Time, amountTime time.Time) {
+	ci.Mu.Lock()
+	defer ci.Mu.Unlock()
+	return ci.PriceTime, ci.AmountTime
+}
+
+// 刷新goroutine最近一次完成一轮的时间, 还没有启动时为零值
+func (ci *CoinInfo) Heartbeat() time.Time {
+	nanos := atomic.LoadInt64(&ci.heartbeat)
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
+
+// 连续刷新失败的轮数
+func (ci *CoinInfo) Failures() int {
+	return int(atomic.LoadInt32(&ci.failures))
+}
+
+// 当前持仓和最近24小时的资产曲线
+func (ci *CoinInfo) TickerReport(head string) *report.TickerReport {
+	now := time.Now()
+	return &report.TickerReport{
+		Head:    head,
+		Tag:     ci.Tag,
+		Coin:    ci.CoinName,
+		Time:    now,
+		Balance: ci.Balance(),
+		Equity:  ci.History.Since(now.Add(-time.Duration(report.HISTORY_WINDOW) * time.Hour)),
+	}
+}
+
+func (ci *CoinInfo) Balance() report.Balance {
+	ci.Mu.Lock()
+	defer ci.Mu.Unlock()
+	return report.Balance{
+		CoinPrice:  ci.CoinPrice,
+		CoinAmount: ci.CoinAmount,
+		USDTAmount: ci.USDTAmount,
+	}
 }
 
 func (ci *CoinInfo) SetCoinAmount(amount float64) {
@@ -127,56 +210,81 @@ func (ci *CoinInfo) GetCoinPrice() float64 {
 	return ci.CoinPrice
 }
 
-func (ci *CoinInfo) RenewAmountInfo() error {
-	balance, err := services.GetAccountBalance(ci.AccountID)
+func (ci *CoinInfo) RenewAmountInfo(ctx context.Context) error {
+	balance, err := services.GetAccountBalance(ctx, ci.AccountID)
 	if err != nil {
-		korok.Fatal("GetAccountBalance Failed : %s", err)
+		korok.ErrorCtx(ctx, "[%s] GetAccountBalance Failed : %s", ci.Tag, err)
 		return err
 	}
 
-	balanceList := balance.Data.List
-	for _, sub := range balanceList {
+	coinAmount, usdtAmount, err := ParseAmounts(balance, ci.CoinName)
+	if err != nil {
+		korok.ErrorCtx(ctx, "[%s] %s", ci.Tag, err)
+		return err
+	}
+	ci.Mu.Lock()
+	ci.CoinAmount = coinAmount
+	ci.USDTAmount = usdtAmount
+	ci.AmountTime = time.Now()
+	ci.Mu.Unlock()
+	balanceGauge.With(ci.Instance, ci.CoinName, ci.CoinName).Set(coinAmount)
+	balanceGauge.With(ci.Instance, ci.CoinName, "usdt").Set(usdtAmount)
+	return nil
+}
+
+// 从账户余额中取出coin和usdt的可交易余额, 请求失败或缺少币种时返回错误, 不能当作0
+func ParseAmounts(balance models.BalanceReturn, coin string) (coinAmount float64, usdtAmount float64, err error) {
+	if balance.Status != "ok" {
+		return 0, 0, fmt.Errorf("GetAccountBalance Failed with ErrCode: %s, ErrMsg: %s", balance.ErrCode, balance.ErrMsg)
+	}
+
+	var hasCoin, hasUSDT bool
+	for _, sub := range balance.Data.List {
 		if sub.Type != "trade" {
 			continue
 		}
 		if sub.Currency == "usdt" {
-			//ar.USDTAmount = float64(sub.Balance)
-			if f, err := strconv.ParseFloat(sub.Balance, 64); err == nil {
-				ci.SetUSDTAmount(f)
-			} else {
-				korok.Fatal("ParseFloat to USDTAmount Failed, string: %s", sub.Balance)
-				return err
+			if usdtAmount, err = strconv.ParseFloat(sub.Balance, 64); err != nil {
+				return 0, 0, fmt.Errorf("ParseFloat to USDTAmount Failed, string: %s", sub.Balance)
 			}
-		} else if sub.Currency == ci.CoinName {
-			if f, err := strconv.ParseFloat(sub.Balance, 64); err == nil {
-				ci.SetCoinAmount(f)
-			} else {
-				korok.Fatal("ParseFloat to CoinAmount Failed, string: %s", sub.Balance)
-				return err
+			hasUSDT = true
+		} else if sub.Currency == coin {
+			if coinAmount, err = strconv.ParseFloat(sub.Balance, 64); err != nil {
+				return 0, 0, fmt.Errorf("ParseFloat to CoinAmount Failed, string: %s", sub.Balance)
 			}
+			hasCoin = true
 		}
 	}
-	return nil
-
+	if !hasCoin {
+		return 0, 0, fmt.Errorf("no trade balance of %s in account %d", coin, balance.Data.ID)
+	}
+	if !hasUSDT {
+		return 0, 0, fmt.Errorf("no trade balance of usdt in account %d", balance.Data.ID)
+	}
+	return coinAmount, usdtAmount, nil
 }
 
-func (ci *CoinInfo) RenewPriceInfo() error {
+func (ci *CoinInfo) RenewPriceInfo(ctx context.Context) error {
 	symbol := ci.CoinName + "usdt"
-	price, err := services.GetKLine(symbol, "1min", 1)
+	price, err := services.GetKLine(ctx, symbol, "1min", 1)
 	if err != nil {
-		korok.Fatal("GetKLine Failed : %s", err)
+		korok.ErrorCtx(ctx, "[%s] GetKLine Failed : %s", ci.Tag, err)
 		return err
 	}
 
 	kLineData := price.Data
 	if len(kLineData) != 1 {
-		korok.Fatal("kLineData len != 1")
+		korok.ErrorCtx(ctx, "[%s] kLineData len != 1", ci.Tag)
 		return errors.New("kLineData len != 1")
 	}
 
 	kLine := kLineData[0]
 
-	ci.SetCoinPrice(kLine.Close)
+	ci.Mu.Lock()
+	ci.CoinPrice = kLine.Close
+	ci.PriceTime = time.Now()
+	ci.Mu.Unlock()
+	coinPriceGauge.With(ci.Instance, ci.CoinName).Set(kLine.Close)
 
 	return nil
 }
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"config"
+	"context"
+	"fmt"
+	"korok"
+	"notify"
+	"os"
+	"os/signal"
+	"reflect"
+	"report"
+	"strings"
+	"syscall"
+	"time"
+	"untils"
+)
+
+const (
+	CONFIG_CHECK_INTERVAL = 5 //s
+)
+
+// 热加载时生效的顶层配置, 其余字段修改后需要重启
+var reloadableFields = map[string]bool{
+	"LogFormat": true, "LogLevel": true, "LogRotate": true, "LogMaxBackups": true, "LogMaxAge": true, "LogCompress": true,
+	"LogPolicy": true, "LogSampleFirst": true, "LogSampleThereafter": true, "LogSampleLevel": true, "LogSinks": true,
+	"MarketRate": true, "MarketBurst": true, "TradeRate": true, "TradeBurst": true,
+	"TemplateDir":  true,
+	"PerfectRatio": true, "UpRatio": true, "DownRatio": true,
+}
+
+// 只用于生成其他字段的配置, 比较生成的结果
+var derivedFields = map[string]bool{
+	"AccessKeyFile": true, "SecretKeyFile": true, "FromPwdFile": true, "AdminTokenFile": true, "Keystore": true, "KeystoreKey": true,
+	"FromMail": true, "FromPwd": true, "ToMail": true, "AccountID": true, "Instances": true,
+}
+
+// 实例中热加载时生效的配置
+var reloadableInstanceFields = map[string]bool{
+	"PerfectRatio": true, "UpRatio": true, "DownRatio": true,
+}
+
+var derivedInstanceFields = map[string]bool{
+	"Name": true, "AccessKeyFile": true, "SecretKeyFile": true, "Keystore": true, "KeystoreKey": true,
+}
+
+func NewConfigWatcher(path string, deals ...*CoinDeal) *ConfigWatcher {
+	cw := &ConfigWatcher{
+		Path:       path,
+		Deals:      deals,
+		hupChannel: make(chan os.Signal, 1),
+	}
+	if stat, err := os.Stat(path); err == nil {
+		cw.lastModTime = stat.ModTime()
+	}
+	return cw
+}
+
+// 配置文件修改或收到SIGHUP时重新加载策略参数
+type ConfigWatcher struct {
+	Path  string
+	Deals []*CoinDeal
+
+	lastModTime time.Time
+	hupChannel  chan os.Signal
+}
+
+func (cw *ConfigWatcher) RunWatchRoutine() {
+	signal.Notify(cw.hupChannel, syscall.SIGHUP)
+	go cw.Watch()
+}
+
+func (cw *ConfigWatcher) Watch() {
+	defer korok.FlushOnPanic()
+	clocker := time.NewTicker(time.Duration(CONFIG_CHECK_INTERVAL) * time.Second)
+	for {
+		select {
+		case <-clocker.C:
+			if cw.modified() {
+				cw.Reload("file changed")
+			}
+		case <-cw.hupChannel:
+			cw.modified()
+			cw.Reload("SIGHUP")
+		}
+	}
+}
+
+func (cw *ConfigWatcher) modified() bool {
+	stat, err := os.Stat(cw.Path)
+	if err != nil {
+		return false
+	}
+	if stat.ModTime().Equal(cw.lastModTime) {
+		return false
+	}
+	cw.lastModTime = stat.ModTime()
+	return true
+}
+
+func (cw *ConfigWatcher) Reload(reason string) {
+	korok.Info("[Config Reload] %s, reload %s", reason, cw.Path)
+
+	conf, err := config.LoadShannonConfig(cw.Path)
+	if err != nil {
+		korok.Error("[Config Reload] keep running with old params, LoadShannonConfig Failed: %s", err)
+		return
+	}
+
+	running := config.ShannonConf
+	if running != nil {
+		if fields := RestartFields(running, conf); len(fields) != 0 {
+			korok.Warn("[Config Reload] restart to apply changed %s", strings.Join(fields, ", "))
+		}
+	}
+
+	if err := korok.SetFormat(conf.LogFormat); err != nil {
+		korok.Error("[Config Reload] keep old log format: %s", err)
+	}
+	if err := korok.SetRotation(conf.LogRotate, conf.LogMaxBackups, conf.LogMaxAge, conf.LogCompress); err != nil {
+		korok.Error("[Config Reload] keep old log rotation: %s", err)
+	}
+	if err := korok.SetPolicy(conf.LogPolicy); err != nil {
+		korok.Error("[Config Reload] keep old log policy: %s", err)
+	}
+	korok.SetSampling(conf.KorokSampling())
+	if err := korok.ConfigureSinks(conf.KorokSinks()); err != nil {
+		korok.Error("[Config Reload] keep old log sinks: %s", err)
+	}
+	if err := logLevel.Configure(conf.LogLevel); err != nil {
+		korok.Error("[Config Reload] keep old log level: %s", err)
+	}
+
+	untils.SetRateLimit(untils.LIMIT_GROUP_MARKET, conf.MarketRate, conf.MarketBurst)
+	untils.SetRateLimit(untils.LIMIT_GROUP_TRADE, conf.TradeRate, conf.TradeBurst)
+
+	// 模板文件不在轮询范围内, 修改后发送SIGHUP重新加载
+	if err := report.Init(conf.TemplateDir); err != nil {
+		korok.Error("[Config Reload] keep old report templates: %s", err)
+	}
+
+	for _, deal := range cw.Deals {
+		ar := deal.Rebalance
+		inst := conf.Instance(deal.Instance)
+		// 删除的实例已在RestartFields中提示
+		if inst == nil {
+			continue
+		}
+
+		params := RbParams{
+			PerfectRatio: inst.PerfectRatio,
+			UpRatio:      inst.UpRatio,
+			DownRatio:    inst.DownRatio,
+		}
+		old := ar.SetParams(params)
+		diff := DiffRbParams(old, params)
+		if diff == "" {
+			korok.Info("[Config Reload] [%s] params unchanged", ar.Tag)
+			continue
+		}
+
+		korok.Info("[Config Reload] [%s] params changed: %s", ar.Tag, diff)
+		mailHead := fmt.Sprintf("[BlockChain][%s] Params Reloaded", ar.Tag)
+		mailBody := fmt.Sprintf("%s\n\nTRIGGER: %s\n%s\n", mailHead, reason, diff)
+		go SendNotify(context.Background(), notify.LEVEL_NOTICE, ar.Tag, ar.ToMail, mailHead, mailBody)
+	}
+
+	if running != nil {
+		config.ShannonConf = ReloadedConfig(running, conf)
+	}
+}
+
+// 修改后需要重启才能生效的配置项, 只返回字段名, 不包含值
+func RestartFields(running, loaded *config.ShannonConfig) []string {
+	res := changedFields(running, loaded, reloadableFields, derivedFields)
+	for _, inst := range running.Instances {
+		li := loaded.Instance(inst.Name)
+		if li == nil {
+			res = append(res, fmt.Sprintf("Instances[%s] (removed)", inst.Name))
+			continue
+		}
+		for _, name := range changedFields(inst, li, reloadableInstanceFields, derivedInstanceFields) {
+			res = append(res, fmt.Sprintf("Instances[%s].%s", inst.Name, name))
+		}
+	}
+	for _, inst := range loaded.Instances {
+		if running.Instance(inst.Name) == nil {
+			res = append(res, fmt.Sprintf("Instances[%s] (added)", inst.Name))
+		}
+	}
+	return res
+}
+
+// 热加载后实际生效的配置: 可热加载的字段取新配置, 其余保持运行中的值
+func ReloadedConfig(running, loaded *config.ShannonConfig) *config.ShannonConfig {
+	res := *running
+	copyFields(&res, loaded, reloadableFields)
+
+	res.Instances = make([]*config.InstanceConfig, 0, len(running.Instances))
+	for _, inst := range running.Instances {
+		ic := *inst
+		if li := loaded.Instance(inst.Name); li != nil {
+			copyFields(&ic, li, reloadableInstanceFields)
+		}
+		res.Instances = append(res.Instances, &ic)
+	}
+	return &res
+}
+
+// 比较两个同类型结构体指针的导出字段, 返回值不同的字段名
+func changedFields(old, curr interface{}, skips ...map[string]bool) []string {
+	ov := reflect.ValueOf(old).Elem()
+	cv := reflect.ValueOf(curr).Elem()
+
+	var res []string
+	for i := 0; i < ov.NumField(); i++ {
+		field := ov.Type().Field(i)
+		if field.PkgPath != "" || inAny(field.Name, skips) {
+			continue
+		}
+		if !reflect.DeepEqual(ov.Field(i).Interface(), cv.Field(i).Interface()) {
+			res = append(res, field.Name)
+		}
+	}
+	return res
+}
+
+func copyFields(dst, src interface{}, names map[string]bool) {
+	dv := reflect.ValueOf(dst).Elem()
+	sv := reflect.ValueOf(src).Elem()
+	for name := range names {
+		dv.FieldByName(name).Set(sv.FieldByName(name))
+	}
+}
+
+func inAny(name string, sets []map[string]bool) bool {
+	for _, set := range sets {
+		if set[name] {
+			return true
+		}
+	}
+	return false
+}
+
+func DiffRbParams(old, curr RbParams) (diff string) {
+	if old.PerfectRatio != curr.PerfectRatio {
+		diff += fmt.Sprintf("PerfectRatio: %v -> %v\n", old.PerfectRatio, curr.PerfectRatio)
+	}
+	if old.UpRatio != curr.UpRatio {
+		diff += fmt.Sprintf("UpRatio: %v -> %v\n", old.UpRatio, curr.UpRatio)
+	}
+	if old.DownRatio != curr.DownRatio {
+		diff += fmt.Sprintf("DownRatio: %v -> %v\n", old.DownRatio, curr.DownRatio)
+	}
+	return diff
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"config"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const watcherConfig = `{
+	"AccessKey": "ak", "SecretKey": "sk", "AccountID": "1001",
+	"FromMail": "bot@example.com", "FromPwd": "pwd", "ToMail": "ops@example.com",
+	"PerfectRatio": 1, "UpRatio": 1.2, "DownRatio": 0.8,
+	"Instances": [{"Name": "main", "Coins": ["ada"]}, {"Name": "alt", "Coins": ["dot"], "PerfectRatio": 1.1, "UpRatio": 1.3}]
+}`
+
+func writeWatcherConfig(t *testing.T, path string, content string) {
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func loadWatcherConfig(t *testing.T, content string) *config.ShannonConfig {
+	path := filepath.Join(t.TempDir(), "shannon.conf")
+	writeWatcherConfig(t, path, content)
+	conf, err := config.LoadShannonConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conf
+}
+
+func TestDiffRbParams(t *testing.T) {
+	base := RbParams{PerfectRatio: 1, UpRatio: 1.2, DownRatio: 0.8}
+	cases := []struct {
+		curr RbParams
+		want string
+	}{
+		{base, ""},
+		{RbParams{PerfectRatio: 1.05, UpRatio: 1.2, DownRatio: 0.8}, "PerfectRatio: 1 -> 1.05\n"},
+		{RbParams{PerfectRatio: 1, UpRatio: 1.25, DownRatio: 0.75}, "UpRatio: 1.2 -> 1.25\nDownRatio: 0.8 -> 0.75\n"},
+		{RbParams{}, "PerfectRatio: 1 -> 0\nUpRatio: 1.2 -> 0\nDownRatio: 0.8 -> 0\n"},
+	}
+	for _, c := range cases {
+		if diff := DiffRbParams(base, c.curr); diff != c.want {
+			t.Errorf("DiffRbParams(%+v) = %q, want %q", c.curr, diff, c.want)
+		}
+	}
+}
+
+func TestRestartFields(t *testing.T) {
+	running := loadWatcherConfig(t, watcherConfig)
+	cases := []struct {
+		name    string
+		replace []string
+		want    []string
+	}{
+		{"unchanged", nil, nil},
+		{"reloadable only", []string{`"PerfectRatio": 1,`, `"PerfectRatio": 1.02, "LogLevel": "debug", "MarketRate": 5,`}, nil},
+		{"credentials", []string{`"SecretKey": "sk"`, `"SecretKey": "sk2"`},
+			[]string{"SecretKey", "Instances[main].SecretKey", "Instances[alt].SecretKey"}},
+		{"mail", []string{`"ToMail": "ops@example.com"`, `"ToMail": "ops2@example.com"`},
+			[]string{"Notifiers", "Instances[main].ToMail", "Instances[alt].ToMail"}},
+		{"instances", []string{`{"Name": "alt", "Coins": ["dot"]`, `{"Name": "new", "Coins": ["dot"]`},
+			[]string{"Instances[alt] (removed)", "Instances[new] (added)"}},
+		{"coins and account", []string{`{"Name": "main", "Coins": ["ada"]}`, `{"Name": "main", "Coins": ["ada", "link"], "AccountID": "1002"}`},
+			[]string{"Instances[main].Coins", "Instances[main].AccountID"}},
+		{"addresses", []string{`"AccessKey": "ak",`, `"AccessKey": "ak", "MetricsAddr": "127.0.0.1:9108", "Proxy": "http://127.0.0.1:1087",`},
+			[]string{"MetricsAddr", "Proxy"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			content := watcherConfig
+			if c.replace != nil {
+				content = strings.Replace(content, c.replace[0], c.replace[1], 1)
+			}
+			if got := RestartFields(running, loadWatcherConfig(t, content)); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("RestartFields = %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestReloadedConfig(t *testing.T) {
+	running := loadWatcherConfig(t, watcherConfig)
+	content := strings.Replace(watcherConfig, `"SecretKey": "sk",`, `"SecretKey": "sk2", "LogLevel": "debug", "MarketRate": 5,`, 1)
+	content = strings.Replace(content, `"UpRatio": 1.3`, `"UpRatio": 1.4`, 1)
+	loaded := loadWatcherConfig(t, content)
+
+	res := ReloadedConfig(running, loaded)
+	if res.LogLevel != "debug" || res.MarketRate != 5 {
+		t.Errorf("reloadable fields not applied: %v", res)
+	}
+	if res.SecretKey != "sk" || res.Instances[1].SecretKey != "sk" {
+		t.Errorf("restart only fields should keep the running values: %v", res)
+	}
+	if res.Instances[1].UpRatio != 1.4 || res.Instances[0].UpRatio != 1.2 {
+		t.Errorf("instance params %v %v", res.Instances[0], res.Instances[1])
+	}
+	if running.Instances[1].UpRatio != 1.3 || running.LogLevel != "" {
+		t.Error("ReloadedConfig must not modify the running config")
+	}
+}
+
+func TestReloadFailedKeepsParams(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shannon.conf")
+	writeWatcherConfig(t, path, watcherConfig)
+	conf, err := config.LoadShannonConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old := config.ShannonConf
+	config.ShannonConf = conf
+	defer func() { config.ShannonConf = old }()
+
+	deal := &CoinDeal{Instance: "main", Rebalance: NewARStrategy("ada", conf.Instance("main"), nil)}
+	cw := NewConfigWatcher(path, deal)
+
+	for _, content := range []string{
+		`{"PerfectRatio": 1.1,`,
+		strings.Replace(strings.Replace(watcherConfig, `"PerfectRatio": 1,`, `"PerfectRatio": 1.1,`, 1), `"DownRatio": 0.8`, `"DownRatio": 1.5`, 1),
+	} {
+		writeWatcherConfig(t, path, content)
+		cw.Reload("test")
+
+		want := RbParams{PerfectRatio: 1, UpRatio: 1.2, DownRatio: 0.8}
+		if params := deal.Rebalance.GetParams(); params != want {
+			t.Errorf("params %+v after failed reload, want %+v", params, want)
+		}
+		if config.ShannonConf != conf {
+			t.Error("config.ShannonConf replaced after failed reload")
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"config"
+	"context"
+	"fmt"
+	"korok"
+	"notify"
+	"report"
+	"time"
+)
+
+// 日报和周报的发送时间, 按本地时间
+type DigestSchedule struct {
+	Hour   int
+	Minute int
+
+	Weekly  bool
+	Weekday time.Weekday
+}
+
+func NewDigestSchedule(conf *config.ShannonConfig) (DigestSchedule, error) {
+	hour, min, err := conf.DigestClock()
+	if err != nil {
+		return DigestSchedule{}, err
+	}
+	weekday, weekly, err := conf.DigestWeekly()
+	if err != nil {
+		return DigestSchedule{}, err
+	}
+	return DigestSchedule{Hour: hour, Minute: min, Weekly: weekly, Weekday: weekday}, nil
+}
+
+// now之后第一次发送的时间
+func (ds DigestSchedule) Next(now time.Time) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day(), ds.Hour, ds.Minute, 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// 在at发送日报时是否同时发送周报
+func (ds DigestSchedule) WeeklyAt(at time.Time) bool {
+	return ds.Weekly && at.Weekday() == ds.Weekday
+}
+
+func (ci *CoinInfo) ClockDigest(schedule DigestSchedule) {
+	defer korok.FlushOnPanic()
+	for {
+		next := schedule.Next(time.Now())
+		timer := time.NewTimer(time.Until(next))
+		<-timer.C
+
+		ci.SendDigest(report.DIGEST_DAILY, next.AddDate(0, 0, -1), next)
+		if schedule.WeeklyAt(next) {
+			ci.SendDigest(report.DIGEST_WEEKLY, next.AddDate(0, 0, -7), next)
+		}
+	}
+}
+
+func (ci *CoinInfo) SendDigest(period string, from time.Time, to time.Time) {
+	digest := report.NewDigest(ci.History, period, from, to)
+	digest.Tag = ci.Tag
+	digest.Coin = ci.CoinName
+
+	title := "Daily"
+	if period == report.DIGEST_WEEKLY {
+		title = "Weekly"
+	}
+	digest.Head = fmt.Sprintf("[BlockChain][%s] %s Digest %s", ci.Tag, title, to.Format("2006-01-02"))
+
+	ctx := korok.WithLogID(context.Background(), korok.NewLogID())
+	korok.InfoCtx(ctx, "[%s] %s digest, snapshots: %d, rebalances: %d, return: %.4f, hodl return: %.4f",
+		ci.Tag, period, digest.Points, len(digest.Rebalances), digest.Return(), digest.HodlReturn())
+	go SendReport(ctx, notify.LEVEL_INFO, ci.Tag, ci.ToMail, digest.Head, report.TEMPLATE_DIGEST, digest)
+}
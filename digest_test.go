@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDigestScheduleNext(t *testing.T) {
+	cst := time.FixedZone("CST", 8*3600)
+	at := func(month time.Month, day, hour, min, sec int) time.Time {
+		return time.Date(2026, month, day, hour, min, sec, 0, cst)
+	}
+	schedule := DigestSchedule{Hour: 8, Minute: 30}
+	cases := []struct {
+		now  time.Time
+		want time.Time
+	}{
+		{at(10, 19, 0, 0, 0), at(10, 19, 8, 30, 0)},
+		{at(10, 19, 8, 29, 59), at(10, 19, 8, 30, 0)},
+		// 正好在发送时间时取下一天, 避免重复发送
+		{at(10, 19, 8, 30, 0), at(10, 20, 8, 30, 0)},
+		{at(10, 19, 8, 30, 1), at(10, 20, 8, 30, 0)},
+		{at(10, 31, 23, 59, 59), at(11, 1, 8, 30, 0)},
+		{at(12, 31, 9, 0, 0), time.Date(2027, 1, 1, 8, 30, 0, 0, cst)},
+	}
+	for _, c := range cases {
+		if got := schedule.Next(c.now); !got.Equal(c.want) {
+			t.Errorf("Next(%s) = %s, want %s", c.now, got, c.want)
+		}
+	}
+
+	// 按now的时区计算
+	utcNow := time.Date(2026, 10, 19, 1, 0, 0, 0, time.UTC)
+	if got, want := schedule.Next(utcNow), time.Date(2026, 10, 19, 8, 30, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("Next(%s) = %s, want %s", utcNow, got, want)
+	}
+}
+
+func TestDigestScheduleNextDST(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no tzdata:", err)
+	}
+	schedule := DigestSchedule{Hour: 8}
+	// 夏令时结束的前一天, 间隔25小时但仍是本地8点
+	now := time.Date(2026, 10, 31, 8, 0, 0, 0, loc)
+	want := time.Date(2026, 11, 1, 8, 0, 0, 0, loc)
+	if got := schedule.Next(now); !got.Equal(want) || got.Sub(now) != 25*time.Hour {
+		t.Errorf("Next(%s) = %s, want %s", now, got, want)
+	}
+}
+
+func TestDigestScheduleWeekly(t *testing.T) {
+	schedule := DigestSchedule{Hour: 8, Weekly: true, Weekday: time.Monday}
+	// 2026-10-19是周一
+	now := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	var weekly []time.Time
+	for i := 0; i < 14; i++ {
+		next := schedule.Next(now)
+		if schedule.WeeklyAt(next) {
+			weekly = append(weekly, next)
+		}
+		now = next
+	}
+	want := []time.Time{
+		time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC),
+		time.Date(2026, 10, 26, 8, 0, 0, 0, time.UTC),
+	}
+	if len(weekly) != len(want) {
+		t.Fatalf("weekly digests at %v, want %v", weekly, want)
+	}
+	for i := range want {
+		if !weekly[i].Equal(want[i]) {
+			t.Errorf("weekly digest %d at %s, want %s", i, weekly[i], want[i])
+		}
+	}
+
+	schedule.Weekly = false
+	if schedule.WeeklyAt(want[0]) {
+		t.Errorf("WeeklyAt with Weekly=false should be false")
+	}
+}
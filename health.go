@@ -0,0 +1,195 @@
+package main
+
+import (
+	"config"
+	"context"
+	"fmt"
+	"korok"
+	"models"
+	"net/http"
+	"services"
+	"sync"
+	"time"
+)
+
+const (
+	SYMBOLS_TIMEOUT        = 5000  //ms
+	SYMBOLS_RETRY_INTERVAL = 10000 //ms
+)
+
+// /healthz和/readyz中的一项检查
+type Check struct {
+	Name string
+	Ok   bool
+	Msg  string `json:",omitempty"`
+}
+
+type CheckResult struct {
+	Ok     bool
+	Checks []*Check
+}
+
+// 按conf中的阈值检查deals
+func NewHealth(conf *config.ShannonConfig, deals []*CoinDeal) *Health {
+	return &Health{
+		Deals:       deals,
+		StaleAfter:  time.Duration(conf.HealthStaleAfter) * time.Millisecond,
+		MaxFailures: conf.HealthMaxFailures,
+		StartTime:   time.Now(),
+
+		now:        time.Now,
+		getSymbols: services.GetSymbols,
+	}
+}
+
+// 交易对信息和每个CoinDeal的首次价格, 持仓都获取后就绪, 之后停止刷新时不健康
+type Health struct {
+	Deals       []*CoinDeal
+	StaleAfter  time.Duration
+	MaxFailures int
+	StartTime   time.Time
+
+	mu         sync.Mutex
+	symbolsErr error // 为nil且symbolsOk时交易对信息已获取
+	symbolsOk  bool
+
+	now        func() time.Time
+	getSymbols func(ctx context.Context) models.SymbolsReturn
+}
+
+// 在后台获取交易对信息, 失败时重试直到所有币种都找到
+func (h *Health) RunSymbolsRoutine() {
+	go func() {
+		defer korok.FlushOnPanic()
+		for {
+			err := h.CheckSymbols()
+			if err == nil {
+				return
+			}
+
+			korok.Error("[Health] FetchSymbols Failed: %s", err)
+			time.Sleep(time.Duration(SYMBOLS_RETRY_INTERVAL) * time.Millisecond)
+		}
+	}()
+}
+
+// 获取一次交易对信息并记录结果, 用于Ready
+func (h *Health) CheckSymbols() error {
+	err := h.FetchSymbols()
+	h.mu.Lock()
+	h.symbolsErr = err
+	h.symbolsOk = err == nil
+	h.mu.Unlock()
+	return err
+}
+
+// 检查交易所是否有每个币种对usdt的交易对
+func (h *Health) FetchSymbols() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(SYMBOLS_TIMEOUT)*time.Millisecond)
+	defer cancel()
+
+	res := h.getSymbols(ctx)
+	if res.Status != "ok" {
+		return fmt.Errorf("GetSymbols Failed with ErrCode: %s, ErrMsg: %s", res.ErrCode, res.ErrMsg)
+	}
+
+	symbols := make(map[string]bool)
+	for _, symbol := range res.Data {
+		symbols[symbol.BaseCurrency+symbol.QuoteCurrency] = true
+	}
+	for _, deal := range h.Deals {
+		if !symbols[deal.Info.CoinName+"usdt"] {
+			return fmt.Errorf("[%s] symbol %susdt is not listed", deal.Info.Tag, deal.Info.CoinName)
+		}
+	}
+	return nil
+}
+
+// 配置已加载, 交易对信息已获取, 每个CoinDeal都有了首次价格和持仓
+func (h *Health) Ready() *CheckResult {
+	res := &CheckResult{Ok: true}
+
+	// Health在配置加载成功后才创建
+	res.add(&Check{Name: "config", Ok: true})
+
+	h.mu.Lock()
+	symbols := &Check{Name: "symbols", Ok: h.symbolsOk}
+	if h.symbolsErr != nil {
+		symbols.Msg = h.symbolsErr.Error()
+	} else if !h.symbolsOk {
+		symbols.Msg = "not fetched yet"
+	}
+	h.mu.Unlock()
+	res.add(symbols)
+
+	for _, deal := range h.Deals {
+		priceTime, amountTime := deal.Info.RenewTimes()
+		res.add(&Check{Name: deal.Info.Tag + " price", Ok: !priceTime.IsZero(), Msg: firstMsg(priceTime)})
+		res.add(&Check{Name: deal.Info.Tag + " balance", Ok: !amountTime.IsZero(), Msg: firstMsg(amountTime)})
+	}
+	return res
+}
+
+// 价格或持仓过期, 刷新goroutine停止, 或连续失败超过MaxFailures次时不健康
+func (h *Health) Healthy() *CheckResult {
+	res := &CheckResult{Ok: true}
+	now := h.now()
+
+	for _, deal := range h.Deals {
+		priceTime, amountTime := deal.Info.RenewTimes()
+		res.add(h.fresh(deal.Info.Tag+" price", now, priceTime))
+		res.add(h.fresh(deal.Info.Tag+" balance", now, amountTime))
+		res.add(h.fresh(deal.Info.Tag+" renew routine", now, deal.Info.Heartbeat()))
+
+		failures := deal.Info.Failures()
+		check := &Check{Name: deal.Info.Tag + " api failures", Ok: failures <= h.MaxFailures}
+		if !check.Ok {
+			check.Msg = fmt.Sprintf("%d renews failed in a row, threshold %d", failures, h.MaxFailures)
+		}
+		res.add(check)
+	}
+	return res
+}
+
+// 启动后还没有刷新过时从启动时间算起
+func (h *Health) fresh(name string, now time.Time, last time.Time) *Check {
+	since := last
+	if since.Before(h.StartTime) {
+		since = h.StartTime
+	}
+
+	check := &Check{Name: name, Ok: now.Sub(since) <= h.StaleAfter}
+	if !check.Ok {
+		check.Msg = fmt.Sprintf("not updated for %s, threshold %s", now.Sub(since).Truncate(time.Millisecond), h.StaleAfter)
+		if last.IsZero() {
+			check.Msg = fmt.Sprintf("not updated since start %s ago, threshold %s", now.Sub(since).Truncate(time.Millisecond), h.StaleAfter)
+		}
+	}
+	return check
+}
+
+func firstMsg(t time.Time) string {
+	if t.IsZero() {
+		return "not received yet"
+	}
+	return ""
+}
+
+func (res *CheckResult) add(check *Check) {
+	res.Checks = append(res.Checks, check)
+	if !check.Ok {
+		res.Ok = false
+	}
+}
+
+// 通过时返回200, 否则503, 内容是每一项检查的结果
+func serveCheck(check func() *CheckResult) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		res := check()
+		code := http.StatusOK
+		if !res.Ok {
+			code = http.StatusServiceUnavailable
+		}
+		writeJson(w, code, res)
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"config"
+	"context"
+	"encoding/json"
+	"models"
+	"net/http"
+	"net/http/httptest"
+	"report"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var healthStart = time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)
+
+func newTestHealth(t *testing.T, coins ...string) (*Health, *time.Time) {
+	inst := &config.InstanceConfig{Name: "main", AccessKey: "ak", SecretKey: "sk", AccountID: "1001"}
+	var deals []*CoinDeal
+	for _, coin := range coins {
+		deals = append(deals, NewCoinDeal(inst, coin, report.NewHistory(), DigestSchedule{}))
+	}
+	conf := &config.ShannonConfig{HealthStaleAfter: 60000, HealthMaxFailures: 3}
+	h := NewHealth(conf, deals)
+	h.StartTime = healthStart
+
+	now := healthStart
+	h.now = func() time.Time { return now }
+	h.getSymbols = func(ctx context.Context) models.SymbolsReturn {
+		return models.SymbolsReturn{Status: "ok", Data: []models.SymbolsData{
+			{BaseCurrency: "ada", QuoteCurrency: "usdt"},
+			{BaseCurrency: "dot", QuoteCurrency: "usdt"},
+			{BaseCurrency: "ada", QuoteCurrency: "btc"},
+		}}
+	}
+	return h, &now
+}
+
+// 模拟一次成功的刷新
+func renewAt(deal *CoinDeal, at time.Time) {
+	deal.Info.Mu.Lock()
+	deal.Info.PriceTime = at
+	deal.Info.AmountTime = at
+	deal.Info.Mu.Unlock()
+	atomic.StoreInt64(&deal.Info.heartbeat, at.UnixNano())
+	atomic.StoreInt32(&deal.Info.failures, 0)
+}
+
+// 按名字取检查结果
+func checksByName(res *CheckResult) map[string]*Check {
+	checks := make(map[string]*Check)
+	for _, check := range res.Checks {
+		checks[check.Name] = check
+	}
+	return checks
+}
+
+func TestHealthReady(t *testing.T) {
+	h, _ := newTestHealth(t, "ada")
+	deal := h.Deals[0]
+
+	res := h.Ready()
+	checks := checksByName(res)
+	if res.Ok || !checks["config"].Ok {
+		t.Errorf("before fetch: ok %v config %v, want false true", res.Ok, checks["config"].Ok)
+	}
+	if c := checks["symbols"]; c.Ok || c.Msg != "not fetched yet" {
+		t.Errorf("symbols before fetch: %+v", c)
+	}
+	for _, name := range []string{"main/ada price", "main/ada balance"} {
+		if c := checks[name]; c.Ok || c.Msg != "not received yet" {
+			t.Errorf("%s before renew: %+v", name, c)
+		}
+	}
+
+	if err := h.CheckSymbols(); err != nil {
+		t.Fatalf("CheckSymbols: %s", err)
+	}
+	if res := h.Ready(); res.Ok || !checksByName(res)["symbols"].Ok {
+		t.Errorf("after symbols only: %+v", res)
+	}
+
+	// 只有价格时持仓仍未就绪
+	deal.Info.Mu.Lock()
+	deal.Info.PriceTime = healthStart
+	deal.Info.Mu.Unlock()
+	checks = checksByName(h.Ready())
+	if !checks["main/ada price"].Ok || checks["main/ada balance"].Ok {
+		t.Errorf("after first price: price %+v balance %+v", checks["main/ada price"], checks["main/ada balance"])
+	}
+
+	renewAt(deal, healthStart)
+	if res := h.Ready(); !res.Ok {
+		t.Errorf("after first balance: %+v", res)
+	}
+}
+
+func TestHealthSymbols(t *testing.T) {
+	cases := []struct {
+		name    string
+		res     models.SymbolsReturn
+		coins   []string
+		errText string
+	}{
+		{"listed", models.SymbolsReturn{Status: "ok", Data: []models.SymbolsData{{BaseCurrency: "ada", QuoteCurrency: "usdt"}}}, []string{"ada"}, ""},
+		{"api error", models.SymbolsReturn{Status: "error", ErrCode: "bad-request", ErrMsg: "invalid"}, []string{"ada"}, "ErrCode: bad-request"},
+		{"empty response", models.SymbolsReturn{}, []string{"ada"}, "GetSymbols Failed"},
+		{"not listed", models.SymbolsReturn{Status: "ok", Data: []models.SymbolsData{{BaseCurrency: "ada", QuoteCurrency: "btc"}}}, []string{"ada"}, "symbol adausdt is not listed"},
+		{"one of two missing", models.SymbolsReturn{Status: "ok", Data: []models.SymbolsData{{BaseCurrency: "ada", QuoteCurrency: "usdt"}}}, []string{"ada", "dot"}, "[main/dot] symbol dotusdt"},
+	}
+	for _, c := range cases {
+		h, _ := newTestHealth(t, c.coins...)
+		symbols := c.res
+		h.getSymbols = func(ctx context.Context) models.SymbolsReturn {
+			if _, ok := ctx.Deadline(); !ok {
+				t.Errorf("%s: GetSymbols without deadline", c.name)
+			}
+			return symbols
+		}
+
+		err := h.CheckSymbols()
+		check := checksByName(h.Ready())["symbols"]
+		if c.errText == "" {
+			if err != nil || !check.Ok || check.Msg != "" {
+				t.Errorf("%s: err %v check %+v, want ok", c.name, err, check)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), c.errText) {
+			t.Errorf("%s: err %v, want %q", c.name, err, c.errText)
+		}
+		if check.Ok || check.Msg != err.Error() {
+			t.Errorf("%s: check %+v, want failed with %v", c.name, check, err)
+		}
+	}
+}
+
+func TestHealthStale(t *testing.T) {
+	stale := time.Minute
+	cases := []struct {
+		name    string
+		renew   time.Duration // 相对启动时间, <0时从未刷新
+		now     time.Duration
+		ok      bool
+		msgPart string
+	}{
+		{"never renewed within threshold", -1, stale, true, ""},
+		{"never renewed past threshold", -1, stale + time.Millisecond, false, "not updated since start 1m0.001s ago, threshold 1m0s"},
+		{"fresh", 10 * time.Second, 30 * time.Second, true, ""},
+		{"exactly at threshold", 10 * time.Second, 10*time.Second + stale, true, ""},
+		{"just past threshold", 10 * time.Second, 10*time.Second + stale + time.Millisecond, false, "not updated for 1m0.001s, threshold 1m0s"},
+		// 上次运行留下的时间早于启动时间, 从启动时间算起
+		{"renewed before start", -time.Hour, 30 * time.Second, true, ""},
+	}
+	for _, c := range cases {
+		h, now := newTestHealth(t, "ada")
+		deal := h.Deals[0]
+		atomic.StoreInt64(&deal.Info.heartbeat, 0)
+		if c.renew != -1 {
+			renewAt(deal, healthStart.Add(c.renew))
+		}
+		*now = healthStart.Add(c.now)
+
+		res := h.Healthy()
+		checks := checksByName(res)
+		if res.Ok != c.ok {
+			t.Errorf("%s: ok %v, want %v: %+v", c.name, res.Ok, c.ok, res.Checks)
+		}
+		for _, name := range []string{"main/ada price", "main/ada balance", "main/ada renew routine"} {
+			check := checks[name]
+			if check.Ok != c.ok || !strings.Contains(check.Msg, c.msgPart) {
+				t.Errorf("%s: %s = %+v, want ok %v msg %q", c.name, name, check, c.ok, c.msgPart)
+			}
+		}
+	}
+}
+
+func TestHealthHeartbeat(t *testing.T) {
+	h, now := newTestHealth(t, "ada")
+	deal := h.Deals[0]
+	renewAt(deal, healthStart)
+
+	// 价格和持仓过期前刷新goroutine仍在运行, 只是刷新失败
+	atomic.StoreInt64(&deal.Info.heartbeat, healthStart.Add(2*time.Minute).UnixNano())
+	*now = healthStart.Add(2 * time.Minute)
+	checks := checksByName(h.Healthy())
+	if checks["main/ada price"].Ok || checks["main/ada balance"].Ok || !checks["main/ada renew routine"].Ok {
+		t.Errorf("stale balance with live routine: %+v %+v %+v",
+			checks["main/ada price"], checks["main/ada balance"], checks["main/ada renew routine"])
+	}
+}
+
+func TestHealthFailures(t *testing.T) {
+	h, now := newTestHealth(t, "ada")
+	deal := h.Deals[0]
+	renewAt(deal, healthStart)
+	*now = healthStart.Add(time.Second)
+
+	for failures := 0; failures <= 5; failures++ {
+		atomic.StoreInt32(&deal.Info.failures, int32(failures))
+		res := h.Healthy()
+		check := checksByName(res)["main/ada api failures"]
+		want := failures <= h.MaxFailures
+		if check.Ok != want || res.Ok != want {
+			t.Errorf("%d failures: check %+v result %v, want %v", failures, check, res.Ok, want)
+		}
+		if !want && !strings.Contains(check.Msg, "renews failed in a row, threshold 3") {
+			t.Errorf("%d failures: msg %q", failures, check.Msg)
+		}
+	}
+}
+
+func TestServeCheck(t *testing.T) {
+	h, _ := newTestHealth(t, "ada")
+	cases := []struct {
+		prepare func()
+		want    int
+	}{
+		{func() {}, http.StatusServiceUnavailable},
+		{func() {
+			h.CheckSymbols()
+			renewAt(h.Deals[0], healthStart)
+		}, http.StatusOK},
+	}
+	for _, c := range cases {
+		c.prepare()
+		rec := httptest.NewRecorder()
+		serveCheck(h.Ready)(rec, httptest.NewRequest("GET", "/readyz", nil))
+		if rec.Code != c.want {
+			t.Errorf("readyz: %d, want %d", rec.Code, c.want)
+		}
+		res := &CheckResult{}
+		if err := json.Unmarshal(rec.Body.Bytes(), res); err != nil {
+			t.Fatal(err)
+		}
+		if res.Ok != (c.want == http.StatusOK) || len(res.Checks) != 4 {
+			t.Errorf("readyz body: %s", rec.Body)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"korok"
+	"metrics"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	HTTP_READ_TIMEOUT  = 5000  //ms
+	HTTP_WRITE_TIMEOUT = 10000 //ms
+)
+
+// /metrics输出Prometheus指标, /healthz和/readyz是存活和就绪检查
+func NewMetricsHandler(health *Health) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.HandleFunc("/healthz", serveCheck(health.Healthy))
+	mux.HandleFunc("/readyz", serveCheck(health.Ready))
+	return mux
+}
+
+// 在后台启动http服务, 返回前先监听地址, 地址错误时启动失败
+func RunHttpServer(name string, addr string, handler http.Handler) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{
+		Handler:      handler,
+		ReadTimeout:  time.Duration(HTTP_READ_TIMEOUT) * time.Millisecond,
+		WriteTimeout: time.Duration(HTTP_WRITE_TIMEOUT) * time.Millisecond,
+	}
+	go func() {
+		defer korok.FlushOnPanic()
+		err := server.Serve(listener)
+		if err != nil && err != http.ErrServerClosed {
+			korok.Error("[Http Server] %s on %s stopped: %s", name, addr, err)
+		}
+	}()
+
+	korok.Info("[Http Server] serve %s on %s", name, listener.Addr())
+	return nil
+}
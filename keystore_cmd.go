@@ -0,0 +1,142 @@
+package main
+
+import (
+	"config"
+	"flag"
+	"fmt"
+	"keystore"
+	"os"
+)
+
+const keystoreUsage = `usage: shannon keystore <command> [-keystore path] [-name key]
+
+commands:
+  init    create an empty keystore
+  add     add a new API key
+  rotate  replace the credentials of an existing API key
+  remove  delete an API key
+  list    list API keys without decrypting them
+`
+
+// 处理 shannon keystore 子命令, 返回进程退出码
+func RunKeystoreCmd(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, keystoreUsage)
+		return 2
+	}
+
+	command := args[0]
+	flags := flag.NewFlagSet("keystore "+command, flag.ContinueOnError)
+	path := flags.String("keystore", "../shannon_conf/shannon.keystore", "keystore file path")
+	name := flags.String("name", config.DEFAULT_KEYSTORE_KEY, "key name")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	var err error
+	switch command {
+	case "init":
+		err = keystoreInit(*path)
+	case "add", "rotate":
+		err = keystorePut(*path, *name, command == "rotate")
+	case "remove":
+		err = keystoreRemove(*path, *name)
+	case "list":
+		err = keystoreList(*path)
+	default:
+		fmt.Fprint(os.Stderr, keystoreUsage)
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "keystore %s failed: %s\n", command, err)
+		return 1
+	}
+	return 0
+}
+
+func keystoreInit(path string) error {
+	passphrase, err := keystore.ReadPassphrase(config.KEYSTORE_PASSPHRASE_ENV, "New passphrase: ")
+	if err != nil {
+		return err
+	}
+	if _, ok := os.LookupEnv(config.KEYSTORE_PASSPHRASE_ENV); !ok {
+		confirm, err := keystore.Prompt("Repeat passphrase: ", true)
+		if err != nil {
+			return err
+		}
+		if confirm != passphrase {
+			return fmt.Errorf("passphrases do not match")
+		}
+	}
+
+	if _, err := keystore.Create(path, passphrase); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "created %s\n", path)
+	return nil
+}
+
+func openKeystore(path string) (*keystore.Keystore, error) {
+	passphrase, err := keystore.ReadPassphrase(config.KEYSTORE_PASSPHRASE_ENV, fmt.Sprintf("Passphrase for %s: ", path))
+	if err != nil {
+		return nil, err
+	}
+	return keystore.Open(path, passphrase)
+}
+
+func keystorePut(path string, name string, rotate bool) error {
+	ks, err := openKeystore(path)
+	if err != nil {
+		return err
+	}
+
+	_, err = ks.Get(name)
+	if rotate && err == keystore.ErrKeyNotFound {
+		return fmt.Errorf("%s not found, use add", name)
+	}
+	if !rotate && err == nil {
+		return fmt.Errorf("%s already exists, use rotate", name)
+	}
+
+	cred := &keystore.Credential{}
+	if cred.AccessKey, err = keystore.Prompt("AccessKey: ", false); err != nil {
+		return err
+	}
+	if cred.SecretKey, err = keystore.Prompt("SecretKey: ", true); err != nil {
+		return err
+	}
+	if cred.AccessKey == "" || cred.SecretKey == "" {
+		return fmt.Errorf("AccessKey and SecretKey are required")
+	}
+
+	if err := ks.Put(name, cred); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "saved %s\n", name)
+	return nil
+}
+
+func keystoreRemove(path string, name string) error {
+	ks, err := openKeystore(path)
+	if err != nil {
+		return err
+	}
+	return ks.Remove(name)
+}
+
+func keystoreList(path string) error {
+	ks, err := openKeystore(path)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range ks.List() {
+		rotated := "-"
+		if !entry.Rotated.IsZero() {
+			rotated = entry.Rotated.Format("2006-01-02 15:04:05")
+		}
+		fmt.Printf("%-20s created %s  rotated %s\n", entry.Name, entry.Created.Format("2006-01-02 15:04:05"), rotated)
+	}
+	return nil
+}
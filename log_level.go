@@ -0,0 +1,70 @@
+package main
+
+import (
+	"korok"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+var logLevel = &LogLevelSwitch{configured: korok.LOG_EVENT_INFO}
+
+// 按配置设置日志级别, SIGUSR1在此之上切换debug, 不需要修改配置
+type LogLevelSwitch struct {
+	mu         sync.Mutex
+	configured int
+	debug      bool
+}
+
+// 应用配置中的级别名, 空为info; SIGUSR1打开的debug保持到再次切换
+func (ls *LogLevelSwitch) Configure(name string) error {
+	level := korok.LOG_EVENT_INFO
+	if name != "" {
+		var err error
+		level, err = korok.ParseLevel(name)
+		if err != nil {
+			return err
+		}
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.configured = level
+	ls.applyWithoutLock()
+	return nil
+}
+
+// 修改级别, 下次热加载配置时恢复
+func (ls *LogLevelSwitch) Set(level int) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.debug = false
+	korok.SetLevel(level)
+}
+
+func (ls *LogLevelSwitch) Toggle() {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.debug = !ls.debug
+	ls.applyWithoutLock()
+}
+
+func (ls *LogLevelSwitch) applyWithoutLock() {
+	level := ls.configured
+	if ls.debug {
+		level = korok.LOG_EVENT_DEBUG
+	}
+	korok.SetLevel(level)
+	korok.Notice("log level: %s", korok.LevelName(level))
+}
+
+func (ls *LogLevelSwitch) RunSignalRoutine() {
+	usr1Channel := make(chan os.Signal, 1)
+	signal.Notify(usr1Channel, syscall.SIGUSR1)
+	go func() {
+		for range usr1Channel {
+			ls.Toggle()
+		}
+	}()
+}
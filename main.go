@@ -2,18 +2,146 @@ package main
 
 import (
 	"config"
+	"context"
+	"flag"
+	"fmt"
 	"korok"
+	"os"
+	"os/signal"
+	"report"
+	"services"
+	"syscall"
+	"time"
+	"untils"
 )
 
 func main() {
-	err := config.GetShannonConfig("../shannon_conf/shannon.conf")
+	defer korok.FlushOnPanic()
+
+	if len(os.Args) > 1 && os.Args[1] == "keystore" {
+		os.Exit(RunKeystoreCmd(os.Args[2:]))
+	}
+
+	var confPath string
+	flag.StringVar(&confPath, "config", "../shannon_conf/shannon.conf", "config file path, empty to read config from SHANNON_* env only")
+	flag.Parse()
+
+	err := config.GetShannonConfig(confPath)
 	if err != nil {
+		fmt.Fprintf(os.Stderr, "GetShannonConfig Failed: %s\n", err)
 		korok.Fatal("GetShannonConfig Failed: %s", err)
-		return
 	}
 
-	ada := NewAdaDeal()
+	// 日志配置已经过Validate检查, 这里不会出错
+	korok.SetFormat(config.ShannonConf.LogFormat)
+	korok.SetRotation(config.ShannonConf.LogRotate, config.ShannonConf.LogMaxBackups, config.ShannonConf.LogMaxAge, config.ShannonConf.LogCompress)
+	korok.SetPolicy(config.ShannonConf.LogPolicy)
+	korok.SetSampling(config.ShannonConf.KorokSampling())
+	logLevel.Configure(config.ShannonConf.LogLevel)
+	logLevel.RunSignalRoutine()
+	err = korok.ConfigureSinks(config.ShannonConf.KorokSinks())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ConfigureSinks Failed: %s\n", err)
+		korok.Fatal("ConfigureSinks Failed: %s", err)
+	}
+
+	err = report.Init(config.ShannonConf.TemplateDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Load report templates Failed: %s\n", err)
+		korok.Fatal("Load report templates Failed: %s", err)
+	}
+
+	err = InitNotifier(config.ShannonConf)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "InitNotifier Failed: %s\n", err)
+		korok.Fatal("InitNotifier Failed: %s", err)
+	}
+
+	untils.SetRateLimit(untils.LIMIT_GROUP_MARKET, config.ShannonConf.MarketRate, config.ShannonConf.MarketBurst)
+	untils.SetRateLimit(untils.LIMIT_GROUP_TRADE, config.ShannonConf.TradeRate, config.ShannonConf.TradeBurst)
+
+	err = untils.InitHttpClient(config.ShannonConf.Proxy, config.ShannonConf.HttpTimeout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "InitHttpClient Failed: %s\n", err)
+		korok.Fatal("InitHttpClient Failed: %s", err)
+	}
+
+	if config.ShannonConf.ReplayFile != "" {
+		err = untils.EnableReplay(config.ShannonConf.ReplayFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "EnableReplay Failed: %s\n", err)
+			korok.Fatal("EnableReplay Failed: %s", err)
+		}
+		korok.Info("replay http session from %s", config.ShannonConf.ReplayFile)
+	} else if config.ShannonConf.RecordFile != "" {
+		err = untils.EnableRecord(config.ShannonConf.RecordFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "EnableRecord Failed: %s\n", err)
+			korok.Fatal("EnableRecord Failed: %s", err)
+		}
+		korok.Info("record http session to %s", config.ShannonConf.RecordFile)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(services.TIME_SYNC_TIMEOUT)*time.Millisecond)
+	_, err = services.SyncServerTime(ctx)
+	cancel()
+	if err != nil {
+		korok.Error("SyncServerTime Failed: %s", err)
+	}
+	services.RunTimeSyncRoutine()
+
+	deals, err := NewCoinDeals(config.ShannonConf)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "NewCoinDeals Failed: %s\n", err)
+		korok.Fatal("NewCoinDeals Failed: %s", err)
+	}
+	for _, inst := range config.ShannonConf.Instances {
+		korok.Info("start instance %v", *inst)
+	}
+
+	NewConfigWatcher(confPath, deals...).RunWatchRoutine()
+
+	health := NewHealth(config.ShannonConf, deals)
+	health.RunSymbolsRoutine()
+	if config.ShannonConf.MetricsAddr != "" {
+		err = RunHttpServer("metrics", config.ShannonConf.MetricsAddr, NewMetricsHandler(health))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "RunHttpServer Failed: %s\n", err)
+			korok.Fatal("RunHttpServer Failed: %s", err)
+		}
+	}
+
+	if config.ShannonConf.AdminAddr != "" {
+		err = RunHttpServer("admin api", config.ShannonConf.AdminAddr, NewAdminHandler(deals, config.ShannonConf.AdminToken))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "RunHttpServer Failed: %s\n", err)
+			korok.Fatal("RunHttpServer Failed: %s", err)
+		}
+	}
+
+	for _, deal := range deals {
+		deal.AutoRenew()
+		go deal.AutoRb()
+	}
+
+	sigChannel := make(chan os.Signal, 1)
+	signal.Notify(sigChannel, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-sigChannel
+	korok.Info("receive %s, shutting down", sig)
+	CloseNotifier()
+	for _, deal := range deals {
+		deal.History.Close()
+	}
+
+	// 回放与录制不一致时以非0退出
+	exitCode := 0
+	if err := untils.CloseHttpClient(); err != nil {
+		korok.Error("CloseHttpClient Failed: %s", err)
+		fmt.Fprintf(os.Stderr, "CloseHttpClient Failed: %s\n", err)
+		exitCode = 1
+	}
 
-	ada.AutoRenew()
-	ada.AutoRb()
+	// 最后落盘, 之前的退出步骤还会写日志
+	korok.Stop()
+	os.Exit(exitCode)
 }
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"korok"
+	"metrics"
+)
+
+// 再平衡和下单计数的结果标签
+const (
+	RESULT_OK      = "ok"
+	RESULT_ERROR   = "error"
+	RESULT_SKIPPED = "skipped"
+)
+
+var (
+	coinPriceGauge = metrics.NewGaugeVec("shannon_coin_price",
+		"Last close price of the coin in USDT.", "instance", "coin")
+	balanceGauge = metrics.NewGaugeVec("shannon_balance",
+		"Tradable balance of the account by currency.", "instance", "coin", "currency")
+	equityGauge = metrics.NewGaugeVec("shannon_equity_usdt",
+		"Coin and USDT balance valued in USDT.", "instance", "coin")
+	ratioGauge = metrics.NewGaugeVec("shannon_ratio",
+		"Coin asset divided by USDT asset, rebalanced when outside the down and up bands.", "instance", "coin")
+	ratioBandGauge = metrics.NewGaugeVec("shannon_ratio_band",
+		"Ratio bands of the strategy: perfect, up and down.", "instance", "coin", "band")
+
+	rebalancesCounter = metrics.NewCounterVec("shannon_rebalances_total",
+		"Rebalances triggered by the ratio leaving the bands, by action and result.", "instance", "coin", "action", "result")
+	ordersCounter = metrics.NewCounterVec("shannon_orders_total",
+		"Market orders placed, by side and result.", "instance", "coin", "side", "result")
+)
+
+func init() {
+	metrics.NewCounterFunc("shannon_log_dropped_lines_total",
+		"Log lines dropped because the log files fell behind.", func() float64 {
+			lines, _ := korok.Dropped()
+			return float64(lines)
+		})
+	metrics.NewCounterFunc("shannon_log_sampled_lines_total",
+		"Repeated log lines dropped by sampling.", func() float64 {
+			return float64(korok.Sampled())
+		})
+}
+
+// 策略参数的上下界, 参数热加载后下次计算比例时更新
+func observeRatio(instance string, coin string, params RbParams, ratio float64) {
+	ratioGauge.With(instance, coin).Set(ratio)
+	ratioBandGauge.With(instance, coin, "perfect").Set(params.PerfectRatio)
+	ratioBandGauge.With(instance, coin, "up").Set(params.UpRatio)
+	ratioBandGauge.With(instance, coin, "down").Set(params.DownRatio)
+}
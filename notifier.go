@@ -0,0 +1,97 @@
+package main
+
+import (
+	"config"
+	"context"
+	"korok"
+	"notify"
+	"report"
+	"time"
+)
+
+const (
+	NOTIFY_TIMEOUT       = 30000 //ms
+	NOTIFY_FLUSH_TIMEOUT = 30000 //ms
+)
+
+var (
+	notifier notify.Notifier = notify.NewFanout()
+	outbox   *notify.Outbox
+)
+
+// 通知先写入磁盘上的发件箱, 由后台发送并重试
+func InitNotifier(conf *config.ShannonConfig) error {
+	fanout, err := notify.NewFromConfig(conf.Notifiers)
+	if err != nil {
+		return err
+	}
+
+	outbox, err = notify.NewOutbox(conf.OutboxDir, fanout)
+	if err != nil {
+		return err
+	}
+	outbox.RunDeliverRoutine()
+
+	notifier = outbox
+	return nil
+}
+
+// 退出前尽量发送完待发送的通知
+func CloseNotifier() {
+	if outbox == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(NOTIFY_FLUSH_TIMEOUT)*time.Millisecond)
+	defer cancel()
+	if err := outbox.Close(ctx); err != nil {
+		korok.Error("CloseNotifier: %s", err)
+	}
+}
+
+// 发往所有满足级别的渠道
+// mailTo: 逗号分隔的收件人, 覆盖smtp渠道默认的收件人
+func SendNotify(ctx context.Context, level int, tag string, mailTo string, head string, body string) {
+	sendMessage(ctx, &notify.Message{
+		Level:  level,
+		Tag:    tag,
+		Title:  head,
+		Body:   body,
+		Time:   time.Now(),
+		MailTo: config.SplitMailList(mailTo),
+		LogID:  korok.LogIDFromContext(ctx),
+	})
+}
+
+// 用报告模板生成文本和html正文后发送
+func SendReport(ctx context.Context, level int, tag string, mailTo string, head string, name string, data interface{}) {
+	text, html, err := report.Render(name, data)
+	if err != nil {
+		korok.ErrorCtx(ctx, "[%s] render report error : %s", tag, err)
+		return
+	}
+
+	sendMessage(ctx, &notify.Message{
+		Level:  level,
+		Tag:    tag,
+		Title:  head,
+		Body:   text,
+		HTML:   html,
+		Time:   time.Now(),
+		MailTo: config.SplitMailList(mailTo),
+		LogID:  korok.LogIDFromContext(ctx),
+	})
+}
+
+func sendMessage(ctx context.Context, msg *notify.Message) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(NOTIFY_TIMEOUT)*time.Millisecond)
+	defer cancel()
+
+	err := notifier.Notify(ctx, msg)
+	if err != nil {
+		korok.ErrorCtx(ctx, "[%s] notify error : %s", msg.Tag, err)
+		return
+	}
+
+	korok.InfoCtx(ctx, "[%s] notify queued: %s", msg.Tag, msg.Title)
+}
@@ -19,40 +19,156 @@ const (
 )
 
 type ShannonConfig struct {
-	AccessKey string  `json:"AccessKey"`
-	SecretKey string  `json:"SecretKey"`
-	AccountID string  `json:"AccountID"`
-	FromMail string `json:"FromMail`
-	FromPwd  string `json:"FromPwd"`
-	ToMail string 	`json:"ToMail"`
-
-	PerfectRatio	float64 `json:"PerfectRatio"`
-	UpRatio float64 `json:"UpRatio"`
-	DownRatio float64 `json:"DownRatio"`
+	AccessKey string `json:"AccessKey"`
+	SecretKey string `json:"SecretKey"`
+	AccountID string `json:"AccountID"`
+	FromMail  string `json:"FromMail"`
+	FromPwd   string `json:"FromPwd"`
+	ToMail    string `json:"ToMail"`
+
+	// 从单独的文件读取secret, 优先于上面的明文配置
+	AccessKeyFile string `json:"AccessKeyFile"`
+	SecretKeyFile string `json:"SecretKeyFile"`
+	FromPwdFile   string `json:"FromPwdFile"`
+
+	// 从加密的密钥库读取AccessKey/SecretKey, 口令取自环境变量SHANNON_KEYSTORE_PASSPHRASE或终端输入
+	Keystore    string `json:"Keystore"`
+	KeystoreKey string `json:"KeystoreKey"` // 默认 default
+
+	LogFormat string `json:"LogFormat"` // text, json
+	LogLevel  string `json:"LogLevel"`  // debug, info, warning, error, notice, 默认 info
+
+	// 日志切分: hourly, daily, size, 默认 hourly; 备份保留数量和小时数, 0不限制
+	LogRotate     string `json:"LogRotate"`
+	LogMaxBackups int    `json:"LogMaxBackups"`
+	LogMaxAge     int    `json:"LogMaxAge"`
+	LogCompress   bool   `json:"LogCompress"`
+
+	// 日志积压时: block 等待写盘(默认, 不丢日志), drop 丢弃并计数, 不阻塞交易
+	LogPolicy string `json:"LogPolicy"`
+
+	// 每个调用点每分钟完整输出LogSampleFirst行(默认10, -1不限制), 之后每LogSampleThereafter行输出一行(默认0只计数)
+	// 只限制不高于LogSampleLevel的日志(默认warning), 窗口结束时输出重复次数
+	LogSampleFirst      int    `json:"LogSampleFirst"`
+	LogSampleThereafter int    `json:"LogSampleThereafter"`
+	LogSampleLevel      string `json:"LogSampleLevel"`
+
+	// 日志输出目标, 为空时只写日志文件
+	LogSinks []*LogSinkConfig `json:"LogSinks"`
+
+	// Prometheus指标和健康检查(/healthz, /readyz)的监听地址, 如 127.0.0.1:9108, 为空不开启, 修改后需要重启
+	MetricsAddr string `json:"MetricsAddr"`
+
+	// 价格或持仓超过HealthStaleAfter毫秒(默认60000)没有刷新, 或连续刷新失败超过HealthMaxFailures次(默认60)时/healthz失败
+	HealthStaleAfter  int `json:"HealthStaleAfter"`
+	HealthMaxFailures int `json:"HealthMaxFailures"`
+
+	// 管理接口的监听地址, 如 127.0.0.1:9109, 为空不开启, 修改后需要重启
+	// 必须设置AdminToken或AdminTokenFile, 请求带 Authorization: Bearer <AdminToken>
+	AdminAddr      string `json:"AdminAddr"`
+	AdminToken     string `json:"AdminToken"`
+	AdminTokenFile string `json:"AdminTokenFile"`
+
+	// 行情接口和账户/交易接口各自的限频, 每秒请求数和突发数, 默认行情10/10, 交易8/8, 热加载生效
+	MarketRate  float64 `json:"MarketRate"`
+	MarketBurst int     `json:"MarketBurst"`
+	TradeRate   float64 `json:"TradeRate"`
+	TradeBurst  int     `json:"TradeBurst"`
+
+	Proxy       string `json:"Proxy"`
+	HttpTimeout int    `json:"HttpTimeout"` // ms
+	RecordFile  string `json:"RecordFile"`  // 录制所有请求和响应
+	ReplayFile  string `json:"ReplayFile"`  // 从录制文件回放, 不访问网络
+
+	PerfectRatio float64 `json:"PerfectRatio"`
+	UpRatio      float64 `json:"UpRatio"`
+	DownRatio    float64 `json:"DownRatio"`
+
+	// 通知渠道, 为空时使用上面的邮件配置
+	Notifiers []*NotifierConfig `json:"Notifiers"`
+	OutboxDir string            `json:"OutboxDir"` // 待发送通知的落盘目录, 默认 ../outbox
+
+	// 报告模板目录, 其中的 rebalance.html, ticker.txt 等文件覆盖内置模板
+	TemplateDir string `json:"TemplateDir"`
+
+	// 资产快照的落盘目录, 默认 ../snapshots, 用于计算日报和周报
+	SnapshotDir   string `json:"SnapshotDir"`
+	DigestTime    string `json:"DigestTime"`    // 每天发送日报的时间, 默认 09:00
+	DigestWeekday string `json:"DigestWeekday"` // 发送周报的日期, 默认 monday, off不发送
+
+	// 同一进程中运行的多个实例, 为空时按顶层配置运行一个ada实例
+	// Instances, Notifiers, LogSinks 可以按下标用环境变量覆盖, 见ENV_PREFIX
+	Instances []*InstanceConfig `json:"Instances"`
 }
 
 func GetShannonConfig(path string) error {
+	res, err := LoadShannonConfig(path)
+	if err != nil {
+		return err
+	}
+
+	ShannonConf = res
+	ACCESS_KEY = res.AccessKey
+	SECRET_KEY = res.SecretKey
+	return nil
+}
+
+// 读取并校验配置, 不修改全局配置, 热加载时使用
+// path为空时只从环境变量读取
+func LoadShannonConfig(path string) (*ShannonConfig, error) {
 	res := &ShannonConfig{}
 
-	file, err := os.Open(path)
+	if path != "" {
+		err := readConfigFile(path, res)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := res.applyOverrides()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	defer file.Close()
+	err = res.unlockKeystore()
+	if err != nil {
+		return nil, err
+	}
 
-	context, err := ioutil.ReadAll(file)
+	err = res.buildInstances()
+	if err != nil {
+		return nil, err
+	}
+
+	err = res.buildNotifiers()
+	if err != nil {
+		return nil, err
+	}
+
+	res.buildDigest()
+	res.buildHealth()
+	res.buildRateLimit()
+
+	err = res.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func readConfigFile(path string, res *ShannonConfig) error {
+	file, err := os.Open(path)
 	if err != nil {
 		return err
 	}
 
-	err = json.Unmarshal(context, res)
+	defer file.Close()
+
+	context, err := ioutil.ReadAll(file)
 	if err != nil {
 		return err
 	}
 
-	ShannonConf = res
-	ACCESS_KEY = res.AccessKey
-	SECRET_KEY = res.SecretKey
-	return nil
+	return json.Unmarshal(context, res)
 }
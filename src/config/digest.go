@@ -0,0 +1,50 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	DEFAULT_SNAPSHOT_DIR   = "../snapshots"
+	DEFAULT_DIGEST_TIME    = "09:00"
+	DEFAULT_DIGEST_WEEKDAY = "monday"
+	DIGEST_WEEKLY_OFF      = "off"
+)
+
+// 填充汇总报告的默认配置
+func (conf *ShannonConfig) buildDigest() {
+	if conf.SnapshotDir == "" {
+		conf.SnapshotDir = DEFAULT_SNAPSHOT_DIR
+	}
+	if conf.DigestTime == "" {
+		conf.DigestTime = DEFAULT_DIGEST_TIME
+	}
+	if conf.DigestWeekday == "" {
+		conf.DigestWeekday = DEFAULT_DIGEST_WEEKDAY
+	}
+}
+
+// 每天发送日报的时间(本地时间), 格式 HH:MM
+func (conf *ShannonConfig) DigestClock() (hour int, min int, err error) {
+	t, err := time.Parse("15:04", conf.DigestTime)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%q is not a time like 09:00", conf.DigestTime)
+	}
+	return t.Hour(), t.Minute(), nil
+}
+
+// 发送周报的日期, off表示不发送周报
+func (conf *ShannonConfig) DigestWeekly() (weekday time.Weekday, enabled bool, err error) {
+	name := strings.ToLower(conf.DigestWeekday)
+	if name == DIGEST_WEEKLY_OFF {
+		return 0, false, nil
+	}
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.ToLower(d.String()) == name {
+			return d, true, nil
+		}
+	}
+	return 0, false, fmt.Errorf("%q is not a weekday like monday, or %q", conf.DigestWeekday, DIGEST_WEEKLY_OFF)
+}
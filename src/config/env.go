@@ -0,0 +1,234 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// 环境变量前缀, 如 SecretKey 对应 SHANNON_SECRET_KEY,
+// SHANNON_SECRET_KEY_FILE 则从文件中读取(如docker/k8s挂载的secret)
+// Instances, Notifiers, LogSinks 按下标覆盖, 如 SHANNON_INSTANCES_0_SECRET_KEY,
+// SHANNON_NOTIFIERS_1_PASSWORD_FILE, 下标超出配置文件中的数量时新建;
+// Coins, To 等字符串列表用逗号分隔, 如 SHANNON_INSTANCES_0_COINS=ada,dot
+// AccessKeyFile 等*File字段没有自己的环境变量, SHANNON_ACCESS_KEY_FILE 只表示从文件读取AccessKey
+const ENV_PREFIX = "SHANNON_"
+
+// 按下标覆盖时允许的最大下标
+const MAX_ENV_INDEX = 99
+
+// 字段名转为环境变量名, AccountID -> SHANNON_ACCOUNT_ID
+func EnvName(field string) string {
+	return ENV_PREFIX + envKey(field)
+}
+
+func envKey(field string) string {
+	var builder strings.Builder
+	runes := []rune(field)
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) && unicode.IsLower(runes[i-1]) {
+			builder.WriteByte('_')
+		}
+		builder.WriteRune(unicode.ToUpper(r))
+	}
+	return builder.String()
+}
+
+// 读取secret文件, 去掉首尾空白
+func ReadSecretFile(path string) (string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+// 按优先级覆盖配置: 配置文件 < *File字段指向的secret文件 < 环境变量 < 环境变量_FILE
+func (conf *ShannonConfig) applyOverrides() error {
+	secretFiles := []struct {
+		field string
+		path  string
+		dst   *string
+	}{
+		{"AccessKeyFile", conf.AccessKeyFile, &conf.AccessKey},
+		{"SecretKeyFile", conf.SecretKeyFile, &conf.SecretKey},
+		{"FromPwdFile", conf.FromPwdFile, &conf.FromPwd},
+		{"AdminTokenFile", conf.AdminTokenFile, &conf.AdminToken},
+	}
+	for _, sf := range secretFiles {
+		if sf.path == "" {
+			continue
+		}
+		value, err := ReadSecretFile(sf.path)
+		if err != nil {
+			return fmt.Errorf("%s: %s", sf.field, err)
+		}
+		*sf.dst = value
+	}
+
+	return applyEnv(reflect.ValueOf(conf).Elem(), ENV_PREFIX)
+}
+
+// 用环境变量覆盖结构体的字段, prefix为环境变量名前缀
+func applyEnv(v reflect.Value, prefix string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		// AccessKeyFile的环境变量名与AccessKey的_FILE形式相同, 只按后者处理
+		if base := strings.TrimSuffix(field.Name, "File"); base != field.Name {
+			if _, ok := t.FieldByName(base); ok {
+				continue
+			}
+		}
+		envName := prefix + envKey(field.Name)
+
+		if isStructSlice(field.Type) {
+			if err := applySliceEnv(v.Field(i), envName+"_"); err != nil {
+				return err
+			}
+			continue
+		}
+
+		value, ok := os.LookupEnv(envName)
+		if path, fileOk := os.LookupEnv(envName + "_FILE"); fileOk {
+			content, err := ReadSecretFile(path)
+			if err != nil {
+				return fmt.Errorf("%s_FILE: %s", envName, err)
+			}
+			value, ok = content, true
+		}
+		if !ok {
+			continue
+		}
+
+		if err := setField(v.Field(i), value); err != nil {
+			return fmt.Errorf("%s: %s", envName, err)
+		}
+		// 环境变量优先于配置文件中的*File字段, 之后不再从文件读取
+		if fileField := v.FieldByName(field.Name + "File"); fileField.IsValid() && fileField.Kind() == reflect.String {
+			fileField.SetString("")
+		}
+	}
+	return nil
+}
+
+// 元素为结构体指针的切片, 如Instances
+func isStructSlice(t reflect.Type) bool {
+	return t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Ptr && t.Elem().Elem().Kind() == reflect.Struct
+}
+
+// 按下标覆盖切片元素, 如 SHANNON_INSTANCES_0_SECRET_KEY, 下标超出时新建元素
+func applySliceEnv(sv reflect.Value, prefix string) error {
+	maxIndex := -1
+	for _, kv := range os.Environ() {
+		name := strings.SplitN(kv, "=", 2)[0]
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		rest := name[len(prefix):]
+		end := strings.IndexByte(rest, '_')
+		if end <= 0 {
+			continue
+		}
+		index, err := strconv.Atoi(rest[:end])
+		if err != nil {
+			continue
+		}
+		if index < 0 || index > MAX_ENV_INDEX {
+			return fmt.Errorf("%s: index %d is out of range [0, %d]", name, index, MAX_ENV_INDEX)
+		}
+		if index > maxIndex {
+			maxIndex = index
+		}
+	}
+
+	for sv.Len() <= maxIndex {
+		sv.Set(reflect.Append(sv, reflect.Zero(sv.Type().Elem())))
+	}
+	for i := 0; i < sv.Len(); i++ {
+		elem := sv.Index(i)
+		elemPrefix := prefix + strconv.Itoa(i) + "_"
+		if elem.IsNil() {
+			if !hasEnvPrefix(elemPrefix) {
+				continue
+			}
+			elem.Set(reflect.New(elem.Type().Elem()))
+		}
+		if err := applyEnv(elem.Elem(), elemPrefix); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func hasEnvPrefix(prefix string) bool {
+	for _, kv := range os.Environ() {
+		if strings.HasPrefix(kv, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func setField(fv reflect.Value, value string) error {
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(value)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Slice:
+		if fv.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported field type %s", fv.Type())
+		}
+		var list []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		fv.Set(reflect.ValueOf(list))
+	default:
+		return fmt.Errorf("unsupported field type %s", fv.Kind())
+	}
+	return nil
+}
+
+func maskSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "******"
+}
+
+// 日志中打印配置时隐藏密钥和口令
+func (conf ShannonConfig) String() string {
+	conf.AccessKey = maskSecret(conf.AccessKey)
+	conf.SecretKey = maskSecret(conf.SecretKey)
+	conf.FromPwd = maskSecret(conf.FromPwd)
+	conf.AdminToken = maskSecret(conf.AdminToken)
+	type plain ShannonConfig
+	return fmt.Sprintf("%+v", plain(conf))
+}
@@ -0,0 +1,205 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeSecretFile(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestEnvName(t *testing.T) {
+	cases := []struct {
+		field string
+		want  string
+	}{
+		{"AccessKey", "SHANNON_ACCESS_KEY"},
+		{"AccountID", "SHANNON_ACCOUNT_ID"},
+		{"FromPwd", "SHANNON_FROM_PWD"},
+		{"LogSampleFirst", "SHANNON_LOG_SAMPLE_FIRST"},
+		{"TLSMode", "SHANNON_TLSMODE"},
+		{"Proxy", "SHANNON_PROXY"},
+	}
+	for _, c := range cases {
+		if got := EnvName(c.field); got != c.want {
+			t.Errorf("EnvName(%s) = %s, want %s", c.field, got, c.want)
+		}
+	}
+}
+
+func TestEnvOverrides(t *testing.T) {
+	t.Setenv("SHANNON_ACCOUNT_ID", "2002")
+	t.Setenv("SHANNON_MARKET_RATE", "5.5")
+	t.Setenv("SHANNON_LOG_MAX_AGE", "72")
+	t.Setenv("SHANNON_LOG_COMPRESS", "true")
+	t.Setenv("SHANNON_SECRET_KEY", "sk-env")
+	t.Setenv("SHANNON_SECRET_KEY_FILE", writeSecretFile(t, "secret", " sk-file\n"))
+
+	conf, err := loadTestConfig(t, legacyConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.AccountID != "2002" || conf.MarketRate != 5.5 || conf.LogMaxAge != 72 || !conf.LogCompress {
+		t.Errorf("env not applied: %v", conf)
+	}
+	// _FILE优先于同名环境变量, 旧版实例继承覆盖后的值
+	if conf.SecretKey != "sk-file" || conf.Instances[0].SecretKey != "sk-file" || conf.Instances[0].AccountID != "2002" {
+		t.Errorf("SecretKey %q, instance %+v", conf.SecretKey, *conf.Instances[0])
+	}
+}
+
+func TestEnvFileFields(t *testing.T) {
+	fromConfig := writeSecretFile(t, "config-key", "ak-config-file")
+	fromEnv := writeSecretFile(t, "env-key", "ak-env-file")
+
+	// SHANNON_ACCESS_KEY_FILE 只表示从文件读取AccessKey, 不设置AccessKeyFile字段
+	t.Setenv("SHANNON_ACCESS_KEY_FILE", fromEnv)
+	conf, err := loadTestConfig(t, withLegacy(`"AccessKeyFile": "`+fromConfig+`"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.AccessKey != "ak-env-file" {
+		t.Errorf("AccessKey %q, want the env file", conf.AccessKey)
+	}
+	if conf.AccessKeyFile != "" {
+		t.Errorf("AccessKeyFile %q, want it cleared by the env override", conf.AccessKeyFile)
+	}
+
+	// 没有环境变量时使用配置文件中的*File字段
+	t.Setenv("SHANNON_ACCESS_KEY_FILE", "")
+	os.Unsetenv("SHANNON_ACCESS_KEY_FILE")
+	conf, err = loadTestConfig(t, withLegacy(`"AccessKeyFile": "`+fromConfig+`"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.AccessKey != "ak-config-file" || conf.AccessKeyFile != fromConfig {
+		t.Errorf("AccessKey %q AccessKeyFile %q, want the config file", conf.AccessKey, conf.AccessKeyFile)
+	}
+}
+
+func TestEnvIndexedOverrides(t *testing.T) {
+	t.Setenv("SHANNON_INSTANCES_0_ACCESS_KEY", "ak-main")
+	t.Setenv("SHANNON_INSTANCES_0_SECRET_KEY", "sk-main")
+	t.Setenv("SHANNON_INSTANCES_1_NAME", "alt")
+	t.Setenv("SHANNON_INSTANCES_1_COINS", "dot, link,")
+	t.Setenv("SHANNON_INSTANCES_1_ACCESS_KEY", "ak-alt")
+	t.Setenv("SHANNON_INSTANCES_1_SECRET_KEY_FILE", writeSecretFile(t, "alt", "sk-alt"))
+	t.Setenv("SHANNON_INSTANCES_1_PERFECT_RATIO", "1.05")
+	t.Setenv("SHANNON_NOTIFIERS_0_PASSWORD_FILE", writeSecretFile(t, "smtp", "smtp-pwd"))
+	t.Setenv("SHANNON_NOTIFIERS_0_TO", "a@example.com,b@example.com")
+	t.Setenv("SHANNON_LOG_SINKS_0_TYPE", "stderr")
+	t.Setenv("SHANNON_LOG_SINKS_0_SIZE", "10")
+
+	conf, err := loadTestConfig(t, withLegacy(`
+		"Instances": [{"Name": "main", "Coins": ["ada"], "SecretKeyFile": "/nonexistent"}],
+		"Notifiers": [{"Type": "smtp", "From": "bot@example.com", "To": ["ops@example.com"], "PasswordFile": "/nonexistent"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(conf.Instances) != 2 {
+		t.Fatalf("instances %v", conf.Instances)
+	}
+	main, alt := conf.Instances[0], conf.Instances[1]
+	if main.SecretKey != "sk-main" || main.SecretKeyFile != "" || main.AccessKey != "ak-main" {
+		t.Errorf("main instance %+v", *main)
+	}
+	if alt.Name != "alt" || !reflect.DeepEqual(alt.Coins, []string{"dot", "link"}) || alt.AccessKey != "ak-alt" ||
+		alt.SecretKey != "sk-alt" || alt.PerfectRatio != 1.05 || alt.UpRatio != 1.2 || alt.AccountID != "1001" {
+		t.Errorf("alt instance %+v", *alt)
+	}
+
+	nc := conf.Notifiers[0]
+	if nc.Password != "smtp-pwd" || !reflect.DeepEqual(nc.To, []string{"a@example.com", "b@example.com"}) {
+		t.Errorf("notifier %+v", *nc)
+	}
+	if len(conf.LogSinks) != 1 || conf.LogSinks[0].Type != "stderr" || conf.LogSinks[0].Size != 10 {
+		t.Errorf("log sinks %v", conf.LogSinks)
+	}
+}
+
+func TestEnvOnly(t *testing.T) {
+	t.Setenv("SHANNON_INSTANCES_0_NAME", "main")
+	t.Setenv("SHANNON_INSTANCES_0_COINS", "ada")
+	t.Setenv("SHANNON_INSTANCES_0_ACCESS_KEY", "ak")
+	t.Setenv("SHANNON_INSTANCES_0_SECRET_KEY", "sk")
+	t.Setenv("SHANNON_INSTANCES_0_ACCOUNT_ID", "1")
+	t.Setenv("SHANNON_PERFECT_RATIO", "1")
+	t.Setenv("SHANNON_UP_RATIO", "1.2")
+	t.Setenv("SHANNON_DOWN_RATIO", "0.8")
+
+	conf, err := LoadShannonConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conf.Instances) != 1 || conf.Instances[0].Name != "main" || conf.Instances[0].legacy {
+		t.Errorf("instances %v", conf.Instances)
+	}
+}
+
+func TestEnvErrors(t *testing.T) {
+	cases := []struct {
+		env   string
+		value string
+		want  string
+	}{
+		{"SHANNON_LOG_MAX_AGE", "72h", "SHANNON_LOG_MAX_AGE: "},
+		{"SHANNON_LOG_COMPRESS", "yes", "SHANNON_LOG_COMPRESS: "},
+		{"SHANNON_FROM_PWD_FILE", "/nonexistent", "SHANNON_FROM_PWD_FILE: "},
+		{"SHANNON_INSTANCES_0_UP_RATIO", "high", "SHANNON_INSTANCES_0_UP_RATIO: "},
+		{"SHANNON_INSTANCES_100_NAME", "x", "SHANNON_INSTANCES_100_NAME: index 100 is out of range"},
+	}
+	for _, c := range cases {
+		t.Run(c.env, func(t *testing.T) {
+			t.Setenv(c.env, c.value)
+			if _, err := loadTestConfig(t, legacyConfig); err == nil || !strings.HasPrefix(err.Error(), c.want) {
+				t.Errorf("error %v, want prefix %q", err, c.want)
+			}
+		})
+	}
+}
+
+func TestStringMasksSecrets(t *testing.T) {
+	t.Setenv("SHANNON_ADMIN_TOKEN", "admin-secret")
+	t.Setenv("SHANNON_INSTANCES_0_SECRET_KEY", "instance-secret")
+	t.Setenv("SHANNON_NOTIFIERS_1_TOKEN", "telegram-secret")
+
+	conf, err := loadTestConfig(t, `{
+		"AccessKey": "top-access", "SecretKey": "top-secret", "AccountID": "1",
+		"FromMail": "bot@example.com", "FromPwd": "mail-secret", "ToMail": "ops@example.com",
+		"AdminAddr": "127.0.0.1:9109",
+		"PerfectRatio": 1, "UpRatio": 1.2, "DownRatio": 0.8,
+		"Instances": [{"Name": "main", "Coins": ["ada"], "AccessKey": "instance-access"}],
+		"Notifiers": [
+			{"Type": "smtp", "From": "bot@example.com", "To": ["ops@example.com"], "Password": "smtp-secret"},
+			{"Type": "telegram", "ChatID": "42"}
+		]
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.AdminToken != "admin-secret" || conf.Instances[0].SecretKey != "instance-secret" || conf.Notifiers[1].Token != "telegram-secret" {
+		t.Fatalf("env not applied: %+v", *conf)
+	}
+
+	str := conf.String()
+	for _, secret := range []string{"top-access", "top-secret", "mail-secret", "admin-secret", "instance-access", "instance-secret", "smtp-secret", "telegram-secret"} {
+		if strings.Contains(str, secret) {
+			t.Errorf("String() leaks %s:\n%s", secret, str)
+		}
+	}
+	for _, visible := range []string{"AccountID:1", "Name:main", "ChatID:42", "AdminToken:******"} {
+		if !strings.Contains(str, visible) {
+			t.Errorf("String() misses %s:\n%s", visible, str)
+		}
+	}
+}
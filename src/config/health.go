@@ -0,0 +1,16 @@
+package config
+
+const (
+	DEFAULT_HEALTH_STALE_AFTER  = 60000 //ms
+	DEFAULT_HEALTH_MAX_FAILURES = 60
+)
+
+// 填充健康检查的默认配置
+func (conf *ShannonConfig) buildHealth() {
+	if conf.HealthStaleAfter == 0 {
+		conf.HealthStaleAfter = DEFAULT_HEALTH_STALE_AFTER
+	}
+	if conf.HealthMaxFailures == 0 {
+		conf.HealthMaxFailures = DEFAULT_HEALTH_MAX_FAILURES
+	}
+}
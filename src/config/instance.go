@@ -0,0 +1,121 @@
+package config
+
+import (
+	"fmt"
+)
+
+const (
+	STRATEGY_SHANNON = "shannon"
+)
+
+// 一个机器人实例: 一个账户下的若干币种, 使用同一套策略参数
+// 未填写的字段继承顶层配置
+type InstanceConfig struct {
+	Name     string   `json:"Name"`     // 实例名, 日志和邮件中的标签
+	Coins    []string `json:"Coins"`    // 与usdt组成交易对的币种, 每个币种独立再平衡
+	Strategy string   `json:"Strategy"` // 目前只支持 shannon
+
+	AccessKey     string `json:"AccessKey"`
+	SecretKey     string `json:"SecretKey"`
+	AccessKeyFile string `json:"AccessKeyFile"`
+	SecretKeyFile string `json:"SecretKeyFile"`
+	Keystore      string `json:"Keystore"`
+	KeystoreKey   string `json:"KeystoreKey"`
+	AccountID     string `json:"AccountID"`
+
+	ToMail string `json:"ToMail"`
+
+	PerfectRatio float64 `json:"PerfectRatio"`
+	UpRatio      float64 `json:"UpRatio"`
+	DownRatio    float64 `json:"DownRatio"`
+
+	legacy bool // 由顶层配置生成
+}
+
+// 没有配置Instances时, 用顶层配置生成一个只交易ada的实例, 兼容旧配置
+func (conf *ShannonConfig) buildInstances() error {
+	if len(conf.Instances) == 0 {
+		conf.Instances = []*InstanceConfig{{
+			Name:   "ada",
+			Coins:  []string{"ada"},
+			legacy: true,
+		}}
+	}
+
+	for _, inst := range conf.Instances {
+		if inst == nil {
+			continue
+		}
+		if inst.Strategy == "" {
+			inst.Strategy = STRATEGY_SHANNON
+		}
+		if inst.ToMail == "" {
+			inst.ToMail = conf.ToMail
+		}
+		if inst.PerfectRatio == 0 {
+			inst.PerfectRatio = conf.PerfectRatio
+		}
+		if inst.UpRatio == 0 {
+			inst.UpRatio = conf.UpRatio
+		}
+		if inst.DownRatio == 0 {
+			inst.DownRatio = conf.DownRatio
+		}
+		if inst.AccountID == "" {
+			inst.AccountID = conf.AccountID
+		}
+
+		if err := inst.loadCredential(); err != nil {
+			return fmt.Errorf("Instances %q: %s", inst.Name, err)
+		}
+		if inst.AccessKey == "" && inst.SecretKey == "" {
+			inst.AccessKey = conf.AccessKey
+			inst.SecretKey = conf.SecretKey
+		}
+	}
+	return nil
+}
+
+func (inst *InstanceConfig) loadCredential() error {
+	if inst.AccessKeyFile != "" {
+		value, err := ReadSecretFile(inst.AccessKeyFile)
+		if err != nil {
+			return fmt.Errorf("AccessKeyFile: %s", err)
+		}
+		inst.AccessKey = value
+	}
+	if inst.SecretKeyFile != "" {
+		value, err := ReadSecretFile(inst.SecretKeyFile)
+		if err != nil {
+			return fmt.Errorf("SecretKeyFile: %s", err)
+		}
+		inst.SecretKey = value
+	}
+	if inst.Keystore != "" {
+		accessKey, secretKey, err := unlockKeystore(inst.Keystore, inst.KeystoreKey)
+		if err != nil {
+			return err
+		}
+		inst.AccessKey = accessKey
+		inst.SecretKey = secretKey
+	}
+	return nil
+}
+
+// 按名字查找实例
+func (conf *ShannonConfig) Instance(name string) *InstanceConfig {
+	for _, inst := range conf.Instances {
+		if inst != nil && inst.Name == name {
+			return inst
+		}
+	}
+	return nil
+}
+
+// 隐藏实例的API密钥
+func (inst InstanceConfig) String() string {
+	inst.AccessKey = maskSecret(inst.AccessKey)
+	inst.SecretKey = maskSecret(inst.SecretKey)
+	type plain InstanceConfig
+	return fmt.Sprintf("%+v", plain(inst))
+}
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"fmt"
+	"keystore"
+	"sync"
+)
+
+const (
+	KEYSTORE_PASSPHRASE_ENV = "SHANNON_KEYSTORE_PASSPHRASE"
+	DEFAULT_KEYSTORE_KEY    = "default"
+)
+
+// 解锁成功后缓存口令, 热加载时不再提示输入
+var (
+	passphraseMu     sync.Mutex
+	cachedPassphrase = map[string]string{}
+)
+
+func (conf *ShannonConfig) unlockKeystore() error {
+	if conf.Keystore == "" {
+		return nil
+	}
+
+	accessKey, secretKey, err := unlockKeystore(conf.Keystore, conf.KeystoreKey)
+	if err != nil {
+		return err
+	}
+	conf.AccessKey = accessKey
+	conf.SecretKey = secretKey
+	return nil
+}
+
+// 解锁密钥库并取出名为name的密钥
+func unlockKeystore(path string, name string) (accessKey string, secretKey string, err error) {
+	if name == "" {
+		name = DEFAULT_KEYSTORE_KEY
+	}
+
+	passphraseMu.Lock()
+	defer passphraseMu.Unlock()
+
+	passphrase, ok := cachedPassphrase[path]
+	if !ok {
+		passphrase, err = keystore.ReadPassphrase(KEYSTORE_PASSPHRASE_ENV, fmt.Sprintf("Passphrase for %s: ", path))
+		if err != nil {
+			return "", "", fmt.Errorf("Keystore: %s", err)
+		}
+	}
+
+	ks, err := keystore.Open(path, passphrase)
+	if err != nil {
+		return "", "", fmt.Errorf("Keystore: %s", err)
+	}
+	cred, err := ks.Get(name)
+	if err != nil {
+		return "", "", fmt.Errorf("KeystoreKey %q: %s", name, err)
+	}
+
+	cachedPassphrase[path] = passphrase
+	return cred.AccessKey, cred.SecretKey, nil
+}
@@ -0,0 +1,22 @@
+package config
+
+import (
+	"korok"
+)
+
+// 转换成korok的采样配置, 需要在Validate之后调用, LogSampleFirst为-1时返回nil
+func (conf *ShannonConfig) KorokSampling() *korok.SampleConf {
+	if conf.LogSampleFirst < 0 {
+		return nil
+	}
+
+	sc := korok.NewSampleConf()
+	if conf.LogSampleFirst > 0 {
+		sc.First = conf.LogSampleFirst
+	}
+	sc.Thereafter = conf.LogSampleThereafter
+	if conf.LogSampleLevel != "" {
+		sc.Level, _ = korok.ParseLevel(conf.LogSampleLevel)
+	}
+	return sc
+}
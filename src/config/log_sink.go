@@ -0,0 +1,57 @@
+package config
+
+import (
+	"korok"
+)
+
+// 日志输出目标配置
+type LogSinkConfig struct {
+	Type   string `json:"Type"`   // file, stderr, syslog, ring
+	Level  string `json:"Level"`  // 这个目标输出的最低级别, 默认debug, 仍受LogLevel限制
+	Format string `json:"Format"` // text, json, 为空时跟随LogFormat
+
+	Address string `json:"Address"` // syslog: 本地socket路径, 默认/dev/log
+	Tag     string `json:"Tag"`     // syslog: 程序名, 默认shannon
+	Size    int    `json:"Size"`    // ring: 内存中保留的行数, 默认1000
+}
+
+// 转换成korok的配置, 需要在Validate之后调用
+// 没有配置LogSinks时只写日志文件
+func (conf *ShannonConfig) KorokSinks() []*korok.SinkConf {
+	if len(conf.LogSinks) == 0 {
+		return []*korok.SinkConf{korok.NewSinkConf(korok.SINK_FILE)}
+	}
+
+	var res []*korok.SinkConf
+	for _, sc := range conf.LogSinks {
+		ksc := korok.NewSinkConf(sc.Type)
+		if sc.Level != "" {
+			ksc.Level, _ = korok.ParseLevel(sc.Level)
+		}
+		ksc.Format = sc.Format
+		ksc.Address = sc.Address
+		ksc.Tag = sc.Tag
+		ksc.Size = sc.Size
+		res = append(res, ksc)
+	}
+	return res
+}
+
+func (sc *LogSinkConfig) validate(ve *ValidationError, prefix string) {
+	switch sc.Type {
+	case korok.SINK_FILE, korok.SINK_STDERR, korok.SINK_SYSLOG, korok.SINK_RING:
+	default:
+		ve.add(prefix+"Type", "%q is not supported, use one of file/stderr/syslog/ring", sc.Type)
+	}
+	if sc.Level != "" {
+		if _, err := korok.ParseLevel(sc.Level); err != nil {
+			ve.add(prefix+"Level", "%s", err)
+		}
+	}
+	if sc.Format != "" && sc.Format != korok.LOG_FORMAT_TEXT && sc.Format != korok.LOG_FORMAT_JSON {
+		ve.add(prefix+"Format", "%q is not supported, use %q or %q", sc.Format, korok.LOG_FORMAT_TEXT, korok.LOG_FORMAT_JSON)
+	}
+	if sc.Size < 0 {
+		ve.add(prefix+"Size", "must be >= 0 lines, got %d", sc.Size)
+	}
+}
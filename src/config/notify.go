@@ -0,0 +1,171 @@
+package config
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+const (
+	NOTIFIER_SMTP     = "smtp"
+	NOTIFIER_WEBHOOK  = "webhook"
+	NOTIFIER_TELEGRAM = "telegram"
+	NOTIFIER_SLACK    = "slack"
+
+	DEFAULT_OUTBOX_DIR = "../outbox"
+)
+
+// 通知渠道配置
+type NotifierConfig struct {
+	Type     string `json:"Type"`     // smtp, webhook, telegram, slack
+	MinLevel string `json:"MinLevel"` // INFO, NOTICE, WARN, ERROR, 默认INFO
+
+	// 发件箱中识别渠道的名字, 默认由类型, 地址和收件人生成; 修改后未发送的通知不再投递
+	Name string `json:"Name"`
+
+	// smtp
+	Host               string   `json:"Host"`     // 默认smtp.gmail.com
+	Port               int      `json:"Port"`     // 默认587, TLSMode为tls时默认465
+	TLSMode            string   `json:"TLSMode"`  // starttls(默认), tls, none
+	Auth               string   `json:"Auth"`     // plain(默认), cram-md5, none
+	Username           string   `json:"Username"` // 默认为From
+	Password           string   `json:"Password"`
+	PasswordFile       string   `json:"PasswordFile"`
+	From               string   `json:"From"`
+	To                 []string `json:"To"`
+	InsecureSkipVerify bool     `json:"InsecureSkipVerify"`
+
+	// webhook/slack的地址, telegram的API地址(可为空)
+	Url string `json:"Url"`
+
+	// telegram
+	Token     string `json:"Token"`
+	TokenFile string `json:"TokenFile"`
+	ChatID    string `json:"ChatID"`
+
+	legacy bool // 由顶层邮件配置生成
+}
+
+// 没有配置Notifiers时, 用顶层的邮件配置生成smtp渠道, 兼容旧配置
+func (conf *ShannonConfig) buildNotifiers() error {
+	if conf.OutboxDir == "" {
+		conf.OutboxDir = DEFAULT_OUTBOX_DIR
+	}
+
+	if len(conf.Notifiers) == 0 && conf.FromMail != "" {
+		conf.Notifiers = []*NotifierConfig{{
+			Type:     NOTIFIER_SMTP,
+			From:     conf.FromMail,
+			Password: conf.FromPwd,
+			To:       SplitMailList(conf.ToMail),
+			legacy:   true,
+		}}
+	}
+
+	for i, nc := range conf.Notifiers {
+		if nc == nil {
+			continue
+		}
+		if nc.PasswordFile != "" {
+			value, err := ReadSecretFile(nc.PasswordFile)
+			if err != nil {
+				return fmt.Errorf("Notifiers[%d].PasswordFile: %s", i, err)
+			}
+			nc.Password = value
+		}
+		if nc.TokenFile != "" {
+			value, err := ReadSecretFile(nc.TokenFile)
+			if err != nil {
+				return fmt.Errorf("Notifiers[%d].TokenFile: %s", i, err)
+			}
+			nc.Token = value
+		}
+	}
+	return nil
+}
+
+func (nc *NotifierConfig) validate(ve *ValidationError, prefix string) {
+	switch nc.Type {
+	case NOTIFIER_SMTP:
+		if nc.From == "" {
+			ve.add(prefix+"From", "is required for smtp")
+		} else if !strings.Contains(nc.From, "@") {
+			ve.add(prefix+"From", "%q is not a mail address", nc.From)
+		}
+		if len(nc.To) == 0 {
+			ve.add(prefix+"To", "at least one recipient is required for smtp")
+		}
+		for _, to := range nc.To {
+			if !strings.Contains(to, "@") {
+				ve.add(prefix+"To", "%q is not a mail address", to)
+			}
+		}
+		if nc.Port < 0 || nc.Port > 65535 {
+			ve.add(prefix+"Port", "%d is not a valid port", nc.Port)
+		}
+		switch nc.TLSMode {
+		case "", "starttls", "tls", "none":
+		default:
+			ve.add(prefix+"TLSMode", "%q is not supported, use one of starttls/tls/none", nc.TLSMode)
+		}
+		switch nc.Auth {
+		case "", "plain", "cram-md5", "none":
+		default:
+			ve.add(prefix+"Auth", "%q is not supported, use one of plain/cram-md5/none", nc.Auth)
+		}
+		if (nc.Auth == "plain" || nc.Auth == "cram-md5") && nc.Password == "" {
+			ve.add(prefix+"Password", "is required for auth %s", nc.Auth)
+		}
+	case NOTIFIER_WEBHOOK, NOTIFIER_SLACK:
+		if !strings.HasPrefix(nc.Url, "http://") && !strings.HasPrefix(nc.Url, "https://") {
+			ve.add(prefix+"Url", "http(s) url is required for %s", nc.Type)
+		}
+	case NOTIFIER_TELEGRAM:
+		if nc.Token == "" {
+			ve.add(prefix+"Token", "bot token is required for telegram")
+		}
+		if nc.ChatID == "" {
+			ve.add(prefix+"ChatID", "is required for telegram")
+		}
+	default:
+		ve.add(prefix+"Type", "%q is not supported, use one of smtp/webhook/telegram/slack", nc.Type)
+	}
+
+	switch strings.ToUpper(nc.MinLevel) {
+	case "", "INFO", "NOTICE", "WARN", "ERROR":
+	default:
+		ve.add(prefix+"MinLevel", "%q is not supported, use one of INFO/NOTICE/WARN/ERROR", nc.MinLevel)
+	}
+}
+
+// 隐藏密码和token
+func (nc NotifierConfig) String() string {
+	nc.Password = maskSecret(nc.Password)
+	nc.Token = maskSecret(nc.Token)
+	type plain NotifierConfig
+	return fmt.Sprintf("%+v", plain(nc))
+}
+
+// 渠道的标识, 与在配置中的顺序无关, 不包含密码和token
+func (nc *NotifierConfig) ChannelID() string {
+	if nc.Name != "" {
+		return nc.Name
+	}
+
+	h := sha1.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%d\x00%s\x00%s\x00%s\x00%s",
+		nc.Type, strings.ToLower(nc.Host), nc.Port, nc.From, strings.Join(nc.To, ","), nc.Url, nc.ChatID)
+	return nc.Type + "-" + hex.EncodeToString(h.Sum(nil))[:12]
+}
+
+// 拆分以逗号分隔的多个邮件地址
+func SplitMailList(list string) []string {
+	var res []string
+	for _, addr := range strings.Split(list, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			res = append(res, addr)
+		}
+	}
+	return res
+}
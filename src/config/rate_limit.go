@@ -0,0 +1,25 @@
+package config
+
+// 火币的默认限频, 每秒请求数和突发数
+const (
+	DEFAULT_MARKET_RATE  = 10
+	DEFAULT_MARKET_BURST = 10
+	DEFAULT_TRADE_RATE   = 8
+	DEFAULT_TRADE_BURST  = 8
+)
+
+// 填充限频的默认配置
+func (conf *ShannonConfig) buildRateLimit() {
+	if conf.MarketRate == 0 {
+		conf.MarketRate = DEFAULT_MARKET_RATE
+	}
+	if conf.MarketBurst == 0 {
+		conf.MarketBurst = DEFAULT_MARKET_BURST
+	}
+	if conf.TradeRate == 0 {
+		conf.TradeRate = DEFAULT_TRADE_RATE
+	}
+	if conf.TradeBurst == 0 {
+		conf.TradeBurst = DEFAULT_TRADE_BURST
+	}
+}
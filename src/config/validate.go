@@ -0,0 +1,289 @@
+package config
+
+import (
+	"fmt"
+	"korok"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// 单个字段的校验错误
+type FieldError struct {
+	Field string
+	Msg   string
+}
+
+func (fe *FieldError) Error() string {
+	return fe.Field + ": " + fe.Msg
+}
+
+// 配置校验错误, 包含所有不合法的字段
+type ValidationError struct {
+	Errors []*FieldError
+}
+
+func (ve *ValidationError) Error() string {
+	msgs := make([]string, 0, len(ve.Errors))
+	for _, fe := range ve.Errors {
+		msgs = append(msgs, fe.Error())
+	}
+	return fmt.Sprintf("invalid config (%d errors): %s", len(ve.Errors), strings.Join(msgs, "; "))
+}
+
+func (ve *ValidationError) add(field string, format string, v ...interface{}) {
+	ve.Errors = append(ve.Errors, &FieldError{Field: field, Msg: fmt.Sprintf(format, v...)})
+}
+
+// 校验配置, 所有错误一起返回, 配置合法时返回nil
+// 需要在buildInstances之后调用, 账户和策略参数按实例校验
+func (conf *ShannonConfig) Validate() error {
+	ve := &ValidationError{}
+
+	// 邮件配置要么都填, 要么都不填
+	mailSet := 0
+	for _, v := range []string{conf.FromMail, conf.FromPwd, conf.ToMail} {
+		if v != "" {
+			mailSet++
+		}
+	}
+	if mailSet != 0 && mailSet != 3 {
+		if conf.FromMail == "" {
+			ve.add("FromMail", "is required when mail is configured")
+		}
+		if conf.FromPwd == "" {
+			ve.add("FromPwd", "is required when mail is configured")
+		}
+		if conf.ToMail == "" {
+			ve.add("ToMail", "is required when mail is configured")
+		}
+	}
+	if conf.FromMail != "" && !strings.Contains(conf.FromMail, "@") {
+		ve.add("FromMail", "%q is not a mail address", conf.FromMail)
+	}
+	for _, to := range SplitMailList(conf.ToMail) {
+		if !strings.Contains(to, "@") {
+			ve.add("ToMail", "%q is not a mail address", to)
+		}
+	}
+
+	if conf.LogFormat != "" && conf.LogFormat != korok.LOG_FORMAT_TEXT && conf.LogFormat != korok.LOG_FORMAT_JSON {
+		ve.add("LogFormat", "%q is not supported, use %q or %q", conf.LogFormat, korok.LOG_FORMAT_TEXT, korok.LOG_FORMAT_JSON)
+	}
+
+	if conf.LogLevel != "" {
+		if _, err := korok.ParseLevel(conf.LogLevel); err != nil {
+			ve.add("LogLevel", "%s", err)
+		}
+	}
+
+	switch conf.LogRotate {
+	case "", korok.ROTATE_HOURLY, korok.ROTATE_DAILY, korok.ROTATE_SIZE:
+	default:
+		ve.add("LogRotate", "%q is not supported, use %q, %q or %q", conf.LogRotate, korok.ROTATE_HOURLY, korok.ROTATE_DAILY, korok.ROTATE_SIZE)
+	}
+	if conf.LogMaxBackups < 0 {
+		ve.add("LogMaxBackups", "must be >= 0, got %d", conf.LogMaxBackups)
+	}
+	if conf.LogMaxAge < 0 {
+		ve.add("LogMaxAge", "must be >= 0 hours, got %d", conf.LogMaxAge)
+	}
+
+	switch conf.LogPolicy {
+	case "", korok.ASYNC_BLOCK, korok.ASYNC_DROP:
+	default:
+		ve.add("LogPolicy", "%q is not supported, use %q or %q", conf.LogPolicy, korok.ASYNC_BLOCK, korok.ASYNC_DROP)
+	}
+
+	if conf.LogSampleFirst < -1 {
+		ve.add("LogSampleFirst", "must be >= -1, got %d", conf.LogSampleFirst)
+	}
+	if conf.LogSampleThereafter < 0 {
+		ve.add("LogSampleThereafter", "must be >= 0, got %d", conf.LogSampleThereafter)
+	}
+	if conf.LogSampleLevel != "" {
+		if _, err := korok.ParseLevel(conf.LogSampleLevel); err != nil {
+			ve.add("LogSampleLevel", "%s", err)
+		}
+	}
+
+	for i, sc := range conf.LogSinks {
+		prefix := fmt.Sprintf("LogSinks[%d].", i)
+		if sc == nil {
+			ve.add(prefix[:len(prefix)-1], "is null")
+			continue
+		}
+		sc.validate(ve, prefix)
+	}
+
+	if conf.MetricsAddr != "" {
+		if _, port, err := net.SplitHostPort(conf.MetricsAddr); err != nil || port == "" {
+			ve.add("MetricsAddr", "%q is not a listen address like 127.0.0.1:9108", conf.MetricsAddr)
+		}
+	}
+
+	if conf.HealthStaleAfter < 0 {
+		ve.add("HealthStaleAfter", "must be >= 0 ms, got %d", conf.HealthStaleAfter)
+	}
+	if conf.HealthMaxFailures < 0 {
+		ve.add("HealthMaxFailures", "must be >= 0, got %d", conf.HealthMaxFailures)
+	}
+
+	if conf.AdminAddr != "" {
+		if _, port, err := net.SplitHostPort(conf.AdminAddr); err != nil || port == "" {
+			ve.add("AdminAddr", "%q is not a listen address like 127.0.0.1:9109", conf.AdminAddr)
+		}
+		// 本机地址也要求token, 浏览器中的网页可以向127.0.0.1发送POST
+		if conf.AdminToken == "" {
+			ve.add("AdminToken", "is required when AdminAddr is set")
+		}
+	}
+
+	if conf.MarketRate < 0 {
+		ve.add("MarketRate", "must be >= 0 requests/s (0 = default), got %v", conf.MarketRate)
+	}
+	if conf.MarketBurst < 0 {
+		ve.add("MarketBurst", "must be >= 0 (0 = default), got %d", conf.MarketBurst)
+	}
+	if conf.TradeRate < 0 {
+		ve.add("TradeRate", "must be >= 0 requests/s (0 = default), got %v", conf.TradeRate)
+	}
+	if conf.TradeBurst < 0 {
+		ve.add("TradeBurst", "must be >= 0 (0 = default), got %d", conf.TradeBurst)
+	}
+
+	if conf.Proxy != "" {
+		if u, err := url.Parse(conf.Proxy); err != nil || u.Scheme == "" || u.Host == "" {
+			ve.add("Proxy", "%q is not a valid url like http://127.0.0.1:1087", conf.Proxy)
+		}
+	}
+	if conf.HttpTimeout < 0 {
+		ve.add("HttpTimeout", "must be >= 0 ms, got %d", conf.HttpTimeout)
+	}
+	if conf.RecordFile != "" && conf.ReplayFile != "" {
+		ve.add("RecordFile", "can not be used together with ReplayFile")
+	}
+
+	channelIDs := make(map[string]int)
+	for i, nc := range conf.Notifiers {
+		prefix := fmt.Sprintf("Notifiers[%d].", i)
+		if nc == nil {
+			ve.add(prefix[:len(prefix)-1], "is null")
+			continue
+		}
+		// 由顶层邮件配置生成的渠道, 已经按FromMail/FromPwd/ToMail校验过
+		if !nc.legacy {
+			nc.validate(ve, prefix)
+		}
+
+		id := nc.ChannelID()
+		if j, ok := channelIDs[id]; ok {
+			ve.add(prefix+"Name", "channel %q is the same as Notifiers[%d], set a different Name", id, j)
+		}
+		channelIDs[id] = i
+	}
+
+	if conf.TemplateDir != "" {
+		if fi, err := os.Stat(conf.TemplateDir); err != nil {
+			ve.add("TemplateDir", "%s", err)
+		} else if !fi.IsDir() {
+			ve.add("TemplateDir", "%q is not a directory", conf.TemplateDir)
+		}
+	}
+
+	if _, _, err := conf.DigestClock(); err != nil {
+		ve.add("DigestTime", "%s", err)
+	}
+	if _, _, err := conf.DigestWeekly(); err != nil {
+		ve.add("DigestWeekday", "%s", err)
+	}
+
+	if len(conf.Instances) == 0 {
+		ve.add("Instances", "at least one instance is required")
+	}
+	names := make(map[string]bool)
+	coins := make(map[string]string)
+	for i, inst := range conf.Instances {
+		prefix := fmt.Sprintf("Instances[%d].", i)
+		// 由旧版顶层配置生成的实例, 错误指向顶层字段
+		if inst != nil && inst.legacy {
+			prefix = ""
+		}
+		if inst == nil {
+			ve.add(prefix[:len(prefix)-1], "is null")
+			continue
+		}
+
+		if inst.Name == "" {
+			ve.add(prefix+"Name", "is required")
+		} else if names[inst.Name] {
+			ve.add(prefix+"Name", "%q is used by another instance", inst.Name)
+		}
+		names[inst.Name] = true
+
+		if len(inst.Coins) == 0 {
+			ve.add(prefix+"Coins", "at least one coin is required")
+		}
+		for _, coin := range inst.Coins {
+			if coin == "" || coin != strings.ToLower(coin) {
+				ve.add(prefix+"Coins", "%q must be a lower case coin name like ada", coin)
+				continue
+			}
+			// 同一账户的同一币种只能由一个实例交易, 否则会互相抵消
+			key := inst.AccountID + "/" + coin
+			if other, ok := coins[key]; ok {
+				ve.add(prefix+"Coins", "%s of account %s is already traded by instance %q", coin, inst.AccountID, other)
+			}
+			coins[key] = inst.Name
+		}
+
+		if inst.Strategy != STRATEGY_SHANNON {
+			ve.add(prefix+"Strategy", "%q is not supported, use %q", inst.Strategy, STRATEGY_SHANNON)
+		}
+
+		inst.validate(ve, prefix)
+	}
+
+	if len(ve.Errors) != 0 {
+		return ve
+	}
+	return nil
+}
+
+func (inst *InstanceConfig) validate(ve *ValidationError, prefix string) {
+	if inst.AccessKey == "" {
+		ve.add(prefix+"AccessKey", "is required")
+	}
+	if inst.SecretKey == "" {
+		ve.add(prefix+"SecretKey", "is required")
+	}
+	if inst.AccountID == "" {
+		ve.add(prefix+"AccountID", "is required, query it with services.GetAccounts")
+	}
+	// 旧版配置的ToMail已经在顶层校验过
+	if !inst.legacy {
+		for _, to := range SplitMailList(inst.ToMail) {
+			if !strings.Contains(to, "@") {
+				ve.add(prefix+"ToMail", "%q is not a mail address", to)
+			}
+		}
+	}
+
+	if inst.PerfectRatio <= 0 {
+		ve.add(prefix+"PerfectRatio", "must be > 0, got %v", inst.PerfectRatio)
+	}
+	if inst.DownRatio <= 0 {
+		ve.add(prefix+"DownRatio", "must be > 0, got %v", inst.DownRatio)
+	}
+	if inst.UpRatio <= 0 {
+		ve.add(prefix+"UpRatio", "must be > 0, got %v", inst.UpRatio)
+	}
+	if inst.DownRatio > 0 && inst.UpRatio > 0 && inst.DownRatio >= inst.UpRatio {
+		ve.add(prefix+"DownRatio", "must be < UpRatio, got DownRatio %v >= UpRatio %v", inst.DownRatio, inst.UpRatio)
+	}
+	if inst.PerfectRatio > 0 && inst.DownRatio < inst.UpRatio &&
+		(inst.PerfectRatio <= inst.DownRatio || inst.PerfectRatio >= inst.UpRatio) {
+		ve.add(prefix+"PerfectRatio", "must be inside (DownRatio, UpRatio) = (%v, %v), got %v", inst.DownRatio, inst.UpRatio, inst.PerfectRatio)
+	}
+}
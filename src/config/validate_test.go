@@ -0,0 +1,156 @@
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const legacyConfig = `{
+	"AccessKey": "ak", "SecretKey": "sk", "AccountID": "1001",
+	"FromMail": "bot@example.com", "FromPwd": "pwd", "ToMail": "ops@example.com",
+	"PerfectRatio": 1, "UpRatio": 1.2, "DownRatio": 0.8
+}`
+
+func loadTestConfig(t *testing.T, content string) (*ShannonConfig, error) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return LoadShannonConfig(path)
+}
+
+// 校验错误中的字段名, 按添加顺序
+func errorFields(t *testing.T, err error) []string {
+	if err == nil {
+		return nil
+	}
+	ve, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("error %v is not a ValidationError", err)
+	}
+	var fields []string
+	for _, fe := range ve.Errors {
+		fields = append(fields, fe.Field)
+	}
+	return fields
+}
+
+// 在旧版配置上覆盖部分字段
+func withLegacy(fields string) string {
+	return strings.TrimSuffix(legacyConfig, "}") + ", " + fields + "}"
+}
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		name   string
+		config string
+		fields []string
+	}{
+		{"legacy", legacyConfig, nil},
+		{"legacy without mail", `{"AccessKey": "ak", "SecretKey": "sk", "AccountID": "1", "PerfectRatio": 1, "UpRatio": 1.2, "DownRatio": 0.8}`, nil},
+		{"legacy empty", `{}`, []string{"AccessKey", "SecretKey", "AccountID", "PerfectRatio", "DownRatio", "UpRatio"}},
+		{"legacy ratio order", withLegacy(`"UpRatio": 0.8, "DownRatio": 1.2`), []string{"DownRatio"}},
+		{"legacy perfect ratio", withLegacy(`"PerfectRatio": 1.5`), []string{"PerfectRatio"}},
+		{"legacy partial mail", `{"AccessKey": "ak", "SecretKey": "sk", "AccountID": "1", "PerfectRatio": 1, "UpRatio": 1.2, "DownRatio": 0.8, "FromMail": "bot@example.com"}`,
+			[]string{"FromPwd", "ToMail"}},
+		{"legacy bad recipient", withLegacy(`"ToMail": "ops@example.com, ops"`), []string{"ToMail"}},
+		{"log options", withLegacy(`"LogFormat": "xml", "LogLevel": "loud", "LogRotate": "weekly", "LogMaxBackups": -1, "LogMaxAge": -1, "LogPolicy": "retry"`),
+			[]string{"LogFormat", "LogLevel", "LogRotate", "LogMaxBackups", "LogMaxAge", "LogPolicy"}},
+		{"log sampling", withLegacy(`"LogSampleFirst": -2, "LogSampleThereafter": -1, "LogSampleLevel": "x"`),
+			[]string{"LogSampleFirst", "LogSampleThereafter", "LogSampleLevel"}},
+		{"log sinks", withLegacy(`"LogSinks": [{"Type": "file"}, null, {"Type": "kafka", "Format": "xml", "Size": -1}]`),
+			[]string{"LogSinks[1]", "LogSinks[2].Type", "LogSinks[2].Format", "LogSinks[2].Size"}},
+		{"listen addresses", withLegacy(`"MetricsAddr": "9108", "AdminAddr": "127.0.0.1:9109"`), []string{"MetricsAddr", "AdminToken"}},
+		{"admin token", withLegacy(`"AdminAddr": "127.0.0.1:9109", "AdminToken": "t"`), nil},
+		{"negative rate limit", withLegacy(`"MarketRate": -1, "MarketBurst": -1, "TradeRate": -0.5, "TradeBurst": -1`),
+			[]string{"MarketRate", "MarketBurst", "TradeRate", "TradeBurst"}},
+		{"http options", withLegacy(`"Proxy": "127.0.0.1:1087", "HttpTimeout": -1, "RecordFile": "a", "ReplayFile": "b"`),
+			[]string{"Proxy", "HttpTimeout", "RecordFile"}},
+		{"digest", withLegacy(`"DigestTime": "9am", "DigestWeekday": "someday"`), []string{"DigestTime", "DigestWeekday"}},
+		{"health", withLegacy(`"HealthStaleAfter": -1, "HealthMaxFailures": -1`), []string{"HealthStaleAfter", "HealthMaxFailures"}},
+		{"notifiers", withLegacy(`"Notifiers": [
+			{"Type": "smtp", "From": "bot", "To": ["ops"], "Port": 70000, "TLSMode": "ssl", "Auth": "cram-md5"},
+			{"Type": "telegram"},
+			{"Type": "slack", "Url": "hooks.slack.com", "MinLevel": "debug"},
+			{"Type": "sms"},
+			null
+		]`), []string{"Notifiers[0].From", "Notifiers[0].To", "Notifiers[0].Port", "Notifiers[0].TLSMode", "Notifiers[0].Password",
+			"Notifiers[1].Token", "Notifiers[1].ChatID", "Notifiers[2].Url", "Notifiers[2].MinLevel", "Notifiers[3].Type", "Notifiers[4]"}},
+		{"duplicate notifiers", withLegacy(`"Notifiers": [
+			{"Type": "webhook", "Url": "https://example.com/hook"},
+			{"Type": "webhook", "Url": "https://example.com/hook", "MinLevel": "ERROR"},
+			{"Type": "webhook", "Url": "https://example.com/hook", "Name": "errors"}
+		]`), []string{"Notifiers[1].Name"}},
+		{"instances", withLegacy(`"Instances": [
+			{"Name": "main", "Coins": ["ada", "btc"]},
+			{"Name": "alt", "Coins": ["dot"], "AccessKey": "ak2", "SecretKey": "sk2", "AccountID": "1002", "ToMail": "alt@example.com"}
+		]`), nil},
+		{"instance errors", withLegacy(`"Instances": [
+			{"Name": "main", "Coins": ["ada"]},
+			{"Name": "main", "Coins": ["ada", "BTC", ""], "Strategy": "grid", "UpRatio": 0.9, "ToMail": "alt"},
+			{"Coins": []},
+			null
+		]`), []string{"Instances[1].Name", "Instances[1].Coins", "Instances[1].Coins", "Instances[1].Coins", "Instances[1].Strategy",
+			"Instances[1].ToMail", "Instances[1].PerfectRatio", "Instances[2].Name", "Instances[2].Coins", "Instances[3]"}},
+		{"instance credentials", withLegacy(`"AccessKey": "", "SecretKey": "", "AccountID": "", "Instances": [{"Name": "main", "Coins": ["ada"]}]`),
+			[]string{"Instances[0].AccessKey", "Instances[0].SecretKey", "Instances[0].AccountID"}},
+		{"same coin on another account", withLegacy(`"Instances": [
+			{"Name": "a", "Coins": ["ada"]},
+			{"Name": "b", "Coins": ["ada"], "AccountID": "1002"}
+		]`), nil},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := loadTestConfig(t, c.config)
+			if fields := errorFields(t, err); !reflect.DeepEqual(fields, c.fields) {
+				t.Errorf("error fields %q, want %q\n%v", fields, c.fields, err)
+			}
+		})
+	}
+}
+
+func TestValidateMessages(t *testing.T) {
+	_, err := loadTestConfig(t, withLegacy(`"AccessKey": "", "MarketRate": -1`))
+	want := "invalid config (2 errors): MarketRate: must be >= 0 requests/s (0 = default), got -1; AccessKey: is required"
+	if err == nil || err.Error() != want {
+		t.Errorf("error:\n%v\nwant:\n%s", err, want)
+	}
+
+	_, err = loadTestConfig(t, withLegacy(`"Instances": [{"Name": "main", "Coins": ["ada"], "PerfectRatio": 2}]`))
+	want = "invalid config (1 errors): Instances[0].PerfectRatio: must be inside (DownRatio, UpRatio) = (0.8, 1.2), got 2"
+	if err == nil || err.Error() != want {
+		t.Errorf("error:\n%v\nwant:\n%s", err, want)
+	}
+}
+
+func TestLoadLegacyConfig(t *testing.T) {
+	conf, err := loadTestConfig(t, legacyConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(conf.Instances) != 1 {
+		t.Fatalf("instances %v", conf.Instances)
+	}
+	inst := conf.Instances[0]
+	if inst.Name != "ada" || inst.AccessKey != "ak" || inst.AccountID != "1001" || inst.ToMail != "ops@example.com" ||
+		inst.Strategy != STRATEGY_SHANNON || inst.UpRatio != 1.2 {
+		t.Errorf("legacy instance %+v", *inst)
+	}
+
+	if len(conf.Notifiers) != 1 {
+		t.Fatalf("notifiers %v", conf.Notifiers)
+	}
+	nc := conf.Notifiers[0]
+	if nc.Type != NOTIFIER_SMTP || nc.From != "bot@example.com" || nc.Password != "pwd" || !reflect.DeepEqual(nc.To, []string{"ops@example.com"}) {
+		t.Errorf("legacy notifier %+v", *nc)
+	}
+
+	if conf.MarketRate != DEFAULT_MARKET_RATE || conf.TradeBurst != DEFAULT_TRADE_BURST || conf.DigestTime != DEFAULT_DIGEST_TIME ||
+		conf.HealthStaleAfter != DEFAULT_HEALTH_STALE_AFTER || conf.OutboxDir != DEFAULT_OUTBOX_DIR {
+		t.Errorf("defaults not filled: %v", conf)
+	}
+}
@@ -0,0 +1,267 @@
+package keystore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+)
+
+const (
+	KEYSTORE_VERSION = 1
+
+	// scrypt默认参数, 约32MB内存
+	SCRYPT_N = 1 << 15
+	SCRYPT_R = 8
+	SCRYPT_P = 1
+
+	// 打开时允许的scrypt参数上限, 防止被篡改的文件耗尽内存或CPU
+	SCRYPT_MAX_N    = 1 << 20
+	SCRYPT_MAX_MEM  = 1 << 30 // 128*N*r字节
+	SCRYPT_MAX_WORK = 1 << 26 // N*r*p
+
+	SALT_LEN = 16
+	KEY_LEN  = 32
+)
+
+var (
+	ErrWrongPassphrase = errors.New("keystore: wrong passphrase or corrupted keystore")
+	ErrKeyNotFound     = errors.New("keystore: key not found")
+)
+
+// API密钥
+type Credential struct {
+	AccessKey string `json:"AccessKey"`
+	SecretKey string `json:"SecretKey"`
+}
+
+type KdfParams struct {
+	N    int    `json:"n"`
+	R    int    `json:"r"`
+	P    int    `json:"p"`
+	Salt []byte `json:"salt"`
+}
+
+// 加密后的一条密钥
+type Entry struct {
+	Name       string    `json:"name"`
+	Created    time.Time `json:"created"`
+	Rotated    time.Time `json:"rotated"`
+	Nonce      []byte    `json:"nonce"`
+	Ciphertext []byte    `json:"ciphertext"`
+}
+
+// 密钥库文件, 口令经scrypt派生出AES-256-GCM密钥, 每条密钥单独加密
+type Keystore struct {
+	Version int       `json:"version"`
+	Kdf     string    `json:"kdf"`
+	Params  KdfParams `json:"kdfparams"`
+	Check   Entry     `json:"check"` // 加密的固定内容, 用于校验口令
+	Entries []*Entry  `json:"keys"`
+
+	path string
+	aead cipher.AEAD
+}
+
+var checkPlaintext = []byte("shannon keystore")
+
+// 新建密钥库
+// path: 密钥库文件路径
+// passphrase: 口令
+func Create(path string, passphrase string) (*Keystore, error) {
+	if _, err := os.Stat(path); err == nil {
+		return nil, fmt.Errorf("keystore: %s already exists", path)
+	}
+
+	salt := make([]byte, SALT_LEN)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	ks := &Keystore{
+		Version: KEYSTORE_VERSION,
+		Kdf:     "scrypt",
+		Params:  KdfParams{N: SCRYPT_N, R: SCRYPT_R, P: SCRYPT_P, Salt: salt},
+		path:    path,
+	}
+	if err := ks.unlock(passphrase); err != nil {
+		return nil, err
+	}
+
+	ks.Check = Entry{Name: "check", Created: time.Now()}
+	if err := ks.seal(&ks.Check, checkPlaintext); err != nil {
+		return nil, err
+	}
+
+	return ks, ks.Save()
+}
+
+// 打开并解锁密钥库
+// path: 密钥库文件路径
+// passphrase: 口令
+func Open(path string, passphrase string) (*Keystore, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	ks := &Keystore{path: path}
+	if err := json.Unmarshal(content, ks); err != nil {
+		return nil, err
+	}
+	if ks.Version != KEYSTORE_VERSION || ks.Kdf != "scrypt" {
+		return nil, fmt.Errorf("keystore: unsupported version %d kdf %s", ks.Version, ks.Kdf)
+	}
+
+	if err := ks.Params.validate(); err != nil {
+		return nil, err
+	}
+	if err := ks.unlock(passphrase); err != nil {
+		return nil, err
+	}
+	if _, err := ks.open(&ks.Check); err != nil {
+		return nil, err
+	}
+
+	return ks, nil
+}
+
+// 在派生密钥之前检查参数范围
+func (params *KdfParams) validate() error {
+	N, r, p := uint64(params.N), uint64(params.R), uint64(params.P)
+	switch {
+	case params.N <= 1 || params.N&(params.N-1) != 0 || params.N > SCRYPT_MAX_N:
+		return fmt.Errorf("keystore: kdf param n %d must be a power of 2 in (1, %d]", params.N, SCRYPT_MAX_N)
+	case params.R <= 0 || params.P <= 0 || r*p >= 1<<30:
+		return fmt.Errorf("keystore: kdf params r %d p %d must be > 0 and r*p < 2^30", params.R, params.P)
+	case 128*N*r > SCRYPT_MAX_MEM:
+		return fmt.Errorf("keystore: kdf params n %d r %d need more than %d bytes", params.N, params.R, SCRYPT_MAX_MEM)
+	case N*r*p > SCRYPT_MAX_WORK:
+		return fmt.Errorf("keystore: kdf params n %d r %d p %d are too expensive", params.N, params.R, params.P)
+	case len(params.Salt) == 0:
+		return errors.New("keystore: kdf param salt is empty")
+	}
+	return nil
+}
+
+func (ks *Keystore) unlock(passphrase string) error {
+	key, err := Scrypt(passphrase, ks.Params.Salt, ks.Params.N, ks.Params.R, ks.Params.P, KEY_LEN)
+	if err != nil {
+		return err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	ks.aead, err = cipher.NewGCM(block)
+	return err
+}
+
+// 加密到entry中, 用名字作为附加数据, 防止密文在条目间被调换
+func (ks *Keystore) seal(entry *Entry, plaintext []byte) error {
+	nonce := make([]byte, ks.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	entry.Nonce = nonce
+	entry.Ciphertext = ks.aead.Seal(nil, nonce, plaintext, []byte(entry.Name))
+	return nil
+}
+
+func (ks *Keystore) open(entry *Entry) ([]byte, error) {
+	plaintext, err := ks.aead.Open(nil, entry.Nonce, entry.Ciphertext, []byte(entry.Name))
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return plaintext, nil
+}
+
+func (ks *Keystore) find(name string) *Entry {
+	for _, entry := range ks.Entries {
+		if entry.Name == name {
+			return entry
+		}
+	}
+	return nil
+}
+
+// 获取解密后的密钥
+func (ks *Keystore) Get(name string) (*Credential, error) {
+	entry := ks.find(name)
+	if entry == nil {
+		return nil, ErrKeyNotFound
+	}
+
+	plaintext, err := ks.open(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	cred := &Credential{}
+	if err := json.Unmarshal(plaintext, cred); err != nil {
+		return nil, err
+	}
+	return cred, nil
+}
+
+// 新增或替换密钥, 名字已存在时视为轮换
+func (ks *Keystore) Put(name string, cred *Credential) error {
+	plaintext, err := json.Marshal(cred)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	entry := ks.find(name)
+	if entry == nil {
+		entry = &Entry{Name: name, Created: now}
+		ks.Entries = append(ks.Entries, entry)
+	} else {
+		entry.Rotated = now
+	}
+	if err := ks.seal(entry, plaintext); err != nil {
+		return err
+	}
+
+	return ks.Save()
+}
+
+// 删除密钥
+func (ks *Keystore) Remove(name string) error {
+	for i, entry := range ks.Entries {
+		if entry.Name == name {
+			ks.Entries = append(ks.Entries[:i], ks.Entries[i+1:]...)
+			return ks.Save()
+		}
+	}
+	return ErrKeyNotFound
+}
+
+// 所有密钥条目, 按名字排序, 不解密
+func (ks *Keystore) List() []*Entry {
+	res := make([]*Entry, len(ks.Entries))
+	copy(res, ks.Entries)
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
+
+// 写回文件, 先写临时文件再改名, 避免写一半时损坏密钥库
+func (ks *Keystore) Save() error {
+	content, err := json.MarshalIndent(ks, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmpPath := ks.path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, ks.path)
+}
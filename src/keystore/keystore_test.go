@@ -0,0 +1,117 @@
+package keystore
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKeystoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keystore.json")
+
+	ks, err := Create(path, "correct horse")
+	if err != nil {
+		t.Fatalf("Create: %s", err)
+	}
+	want := &Credential{AccessKey: "access-key", SecretKey: "secret-key"}
+	if err := ks.Put("default", want); err != nil {
+		t.Fatalf("Put: %s", err)
+	}
+
+	// 密文中不能出现明文
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, plain := range []string{want.AccessKey, want.SecretKey} {
+		if bytes.Contains(content, []byte(plain)) {
+			t.Errorf("keystore file contains plaintext %q", plain)
+		}
+	}
+
+	ks, err = Open(path, "correct horse")
+	if err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	got, err := ks.Get("default")
+	if err != nil {
+		t.Fatalf("Get: %s", err)
+	}
+	if *got != *want {
+		t.Errorf("Get = %+v, want %+v", got, want)
+	}
+
+	if _, err := ks.Get("missing"); err != ErrKeyNotFound {
+		t.Errorf("Get missing key: %v, want ErrKeyNotFound", err)
+	}
+}
+
+func TestKeystoreWrongPassphrase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keystore.json")
+
+	ks, err := Create(path, "correct horse")
+	if err != nil {
+		t.Fatalf("Create: %s", err)
+	}
+	if err := ks.Put("default", &Credential{AccessKey: "a", SecretKey: "s"}); err != nil {
+		t.Fatalf("Put: %s", err)
+	}
+
+	if _, err := Open(path, "battery staple"); err != ErrWrongPassphrase {
+		t.Errorf("Open with wrong passphrase: %v, want ErrWrongPassphrase", err)
+	}
+	if _, err := Create(path, "correct horse"); err == nil {
+		t.Errorf("Create over an existing keystore should fail")
+	}
+}
+
+func TestKeystoreOpenBadParams(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keystore.json")
+	ks, err := Create(path, "correct horse")
+	if err != nil {
+		t.Fatalf("Create: %s", err)
+	}
+
+	cases := []struct {
+		name    string
+		n, r, p int
+		salt    []byte
+		errText string
+	}{
+		{"n not power of 2", 3 << 10, 8, 1, ks.Params.Salt, "power of 2"},
+		{"n too large", 1 << 21, 1, 1, ks.Params.Salt, "power of 2"},
+		{"n overflow", -1 << 62, 8, 1, ks.Params.Salt, "power of 2"},
+		{"r zero", 1 << 10, 0, 1, ks.Params.Salt, "r*p"},
+		{"p negative", 1 << 10, 8, -1, ks.Params.Salt, "r*p"},
+		{"r*p too large", 2, 1 << 15, 1 << 15, ks.Params.Salt, "r*p"},
+		{"memory", 1 << 20, 16, 1, ks.Params.Salt, "bytes"},
+		{"work", 1 << 10, 1, 1 << 20, ks.Params.Salt, "expensive"},
+		{"empty salt", 1 << 10, 8, 1, nil, "salt"},
+	}
+	for _, c := range cases {
+		bad := *ks
+		bad.Params = KdfParams{N: c.n, R: c.r, P: c.p, Salt: c.salt}
+		content, err := json.Marshal(&bad)
+		if err != nil {
+			t.Fatal(err)
+		}
+		badPath := filepath.Join(t.TempDir(), "keystore.json")
+		if err := ioutil.WriteFile(badPath, content, 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		// 参数错误必须在派生密钥前返回
+		start := time.Now()
+		_, err = Open(badPath, "correct horse")
+		if err == nil || !strings.Contains(err.Error(), c.errText) {
+			t.Errorf("%s: Open = %v, want error containing %q", c.name, err, c.errText)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("%s: Open took %s", c.name, elapsed)
+		}
+	}
+}
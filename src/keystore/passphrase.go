@@ -0,0 +1,49 @@
+package keystore
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// 从终端读取一行, hidden为true时关闭回显
+func Prompt(prompt string, hidden bool) (string, error) {
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		return "", errors.New("keystore: no terminal to prompt for " + strings.TrimSpace(prompt))
+	}
+	defer tty.Close()
+
+	fmt.Fprint(os.Stderr, prompt)
+	if hidden {
+		if err := stty(tty, "-echo"); err == nil {
+			defer func() {
+				stty(tty, "echo")
+				fmt.Fprintln(os.Stderr)
+			}()
+		}
+	}
+
+	line, err := bufio.NewReader(tty).ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func stty(tty *os.File, arg string) error {
+	cmd := exec.Command("stty", arg)
+	cmd.Stdin = tty
+	return cmd.Run()
+}
+
+// 读取口令, 优先使用环境变量envName, 否则从终端提示输入
+func ReadPassphrase(envName string, prompt string) (string, error) {
+	if passphrase, ok := os.LookupEnv(envName); ok {
+		return passphrase, nil
+	}
+	return Prompt(prompt, true)
+}
@@ -0,0 +1,54 @@
+package keystore
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+// RFC 7914 第12节的测试向量, 第4组(N=1048576)需要1GB内存, 不在这里运行
+func TestScryptRFC7914(t *testing.T) {
+	cases := []struct {
+		password string
+		salt     string
+		N, r, p  int
+		want     string
+	}{
+		{"", "", 16, 1, 1,
+			"77d6576238657b203b19ca42c18a0497f16b4844e3074ae8dfdffa3fede21442" +
+				"fcd0069ded0948f8326a753a0fc81f17e8d3e0fb2e0d3628cf35e20c38d18906"},
+		{"password", "NaCl", 1024, 8, 16,
+			"fdbabe1c9d3472007856e7190d01e9fe7c6ad7cbc8237830e77376634b373162" +
+				"2eaf30d92e22a3886ff109279d9830dac727afb94a83ee6d8360cbdfa2cc0640"},
+		{"pleaseletmein", "SodiumChloride", 16384, 8, 1,
+			"7023bdcb3afd7348461c06cd81fd38ebfda8fbba904f8e3ea9b543f6545da1f2" +
+				"d5432955613f0fcf62d49705242a9af9e61e85dc0d651e40dfcf017b45575887"},
+	}
+	for _, c := range cases {
+		key, err := Scrypt(c.password, []byte(c.salt), c.N, c.r, c.p, 64)
+		if err != nil {
+			t.Errorf("Scrypt(%q, %q, %d, %d, %d): %s", c.password, c.salt, c.N, c.r, c.p, err)
+			continue
+		}
+		if got := hex.EncodeToString(key); got != c.want {
+			t.Errorf("Scrypt(%q, %q, %d, %d, %d) =\n%s\nwant\n%s", c.password, c.salt, c.N, c.r, c.p, got, c.want)
+		}
+	}
+}
+
+func TestScryptBadParams(t *testing.T) {
+	cases := []struct {
+		N, r, p int
+	}{
+		{0, 8, 1},
+		{1, 8, 1},
+		{1000, 8, 1},
+		{16, 0, 1},
+		{16, 8, 0},
+		{16, 1 << 20, 1 << 10},
+	}
+	for _, c := range cases {
+		if _, err := Scrypt("password", []byte("salt"), c.N, c.r, c.p, 32); err == nil {
+			t.Errorf("Scrypt with N=%d r=%d p=%d should fail", c.N, c.r, c.p)
+		}
+	}
+}
@@ -1,140 +1,269 @@
 package korok
 
 import (
+	"fmt"
 	"io"
+	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// 待落盘的页写满时Write的处理方式
+//
+// ASYNC_BLOCK: Write等待落盘协程腾出空间, 不丢日志, 磁盘慢时会拖慢调用方
+// ASYNC_DROP:  丢弃这一行并计数, 调用方不会被日志阻塞
+const (
+	ASYNC_BLOCK = "block"
+	ASYNC_DROP  = "drop"
+
+	ASYNC_MAX_PAGES      = 100  // 待落盘的页数上限
+	ASYNC_FLUSH_INTERVAL = 1000 //ms, 未写满的页也按这个间隔落盘
+)
+
 type AsyncWriter interface {
 	io.Writer
 	WriteFatal(p []byte)
+	Sync() error
 	Stop()
 }
 
+func checkPolicy(policy string) error {
+	switch policy {
+	case ASYNC_BLOCK, ASYNC_DROP:
+		return nil
+	}
+	return fmt.Errorf("unknown async policy %q, use %q or %q", policy, ASYNC_BLOCK, ASYNC_DROP)
+}
+
+// 落盘的目标, 即LogFile, 测试时替换
+type pageWriter interface {
+	Flush(data []byte) (int, error)
+	FlushFatal(data []byte) (int, error)
+	Sync() error
+}
+
 func NewAsyncLogging(conf *LogConf) *AsyncLogging {
+	policy := conf.Policy
+	if policy == "" {
+		policy = ASYNC_BLOCK
+	}
+	if err := checkPolicy(policy); err != nil {
+		panic(err)
+	}
+
+	lf := NewLogFile(conf)
+	alog := newAsyncLogging(lf, policy, conf.FlushThreshold)
+	alog.LogFile = lf
+	return alog
+}
+
+func newAsyncLogging(out pageWriter, policy string, pageSize int32) *AsyncLogging {
 	alog := &AsyncLogging{
-		LogFile:     NewLogFile(conf),
-		PagePool:    NewBufPoolWithSize(conf.FlushThreshold),
-		PageChannel: make(chan *Buffer, 100),
-		stopChannel: make(chan int, 1),
+		out:         out,
+		policy:      policy,
+		PagePool:    NewBufPoolWithSize(pageSize),
+		wakeChannel: make(chan struct{}, 1),
+		syncChannel: make(chan chan struct{}),
+		stopChannel: make(chan struct{}),
+		doneChannel: make(chan struct{}),
 	}
+	alog.cond = sync.NewCond(&alog.mu)
 	alog.StartRoutine()
 	return alog
 }
 
+// AsyncLogging: Buffer Lines in Pages, Flushed by One Goroutine.
+//
+// 页按写入顺序排队, Write只在mu上做内存拷贝, 不会持锁等待落盘
+// Stop之后Write直接同步写文件
 type AsyncLogging struct {
 	LogFile *LogFile
+	out     pageWriter
 
-	isStop      bool
-	stopChannel chan int
-	wait        sync.WaitGroup
+	mu       sync.Mutex
+	policy   string     // ASYNC_BLOCK, ASYNC_DROP
+	cond     *sync.Cond // 队列有空位或已停止时唤醒等待的Write
+	isStop   bool
+	FreePage *Buffer
+	pages    []*Buffer // 写满待落盘的页
+	PagePool *FixedSizeBufPool
 
-	mu sync.Mutex
+	wakeChannel chan struct{}
+	syncChannel chan chan struct{}
+	stopChannel chan struct{}
+	doneChannel chan struct{}
+	stopOnce    sync.Once
 
-	FreePage    *Buffer
-	PagePool    *FixedSizeBufPool
-	PageChannel chan *Buffer
+	droppedLines  uint64
+	droppedBytes  uint64
+	reportedLines uint64
 }
 
 func (alog *AsyncLogging) Write(logline []byte) (n int, err error) {
-
-	if alog.isStop {
-		return alog.LogFile.Flush(logline)
-	}
-
 	lineSize := len(logline)
 
 	alog.mu.Lock()
-	defer alog.mu.Unlock()
+	if alog.isStop {
+		alog.mu.Unlock()
+		return alog.writeStopped(logline)
+	}
 
 	if alog.FreePage == nil {
 		alog.FreePage = alog.PagePool.Get()
 	}
 
-	if lineSize >= alog.FreePage.AvailSize() {
-		alog.RenewCurrPageWithoutLock()
+	if lineSize >= alog.FreePage.AvailSize() && alog.FreePage.Length() != 0 {
+		for len(alog.pages) >= ASYNC_MAX_PAGES && !alog.isStop {
+			if alog.policy == ASYNC_DROP {
+				alog.mu.Unlock()
+				atomic.AddUint64(&alog.droppedLines, 1)
+				atomic.AddUint64(&alog.droppedBytes, uint64(lineSize))
+				return 0, nil
+			}
+			// Wait释放mu, 其他Write和落盘协程不会被卡住
+			alog.cond.Wait()
+		}
+		if alog.isStop {
+			alog.mu.Unlock()
+			return alog.writeStopped(logline)
+		}
+
+		alog.pages = append(alog.pages, alog.FreePage)
+		alog.FreePage = alog.PagePool.Get()
+		alog.wake()
 	}
 
 	alog.FreePage.AppendByteSlice(logline)
-	// FIXME
+	alog.mu.Unlock()
 	return lineSize, nil
 }
 
+// 等队列中的页落盘后再写, 保证先后顺序
+func (alog *AsyncLogging) writeStopped(logline []byte) (int, error) {
+	<-alog.doneChannel
+	return alog.out.Flush(logline)
+}
+
+// SetPolicy changes what Write does when ASYNC_MAX_PAGES pages are waiting.
+func (alog *AsyncLogging) SetPolicy(policy string) error {
+	if policy == "" {
+		policy = ASYNC_BLOCK
+	}
+	if err := checkPolicy(policy); err != nil {
+		return err
+	}
+
+	alog.mu.Lock()
+	alog.policy = policy
+	// 改为drop时唤醒等待的Write
+	alog.cond.Broadcast()
+	alog.mu.Unlock()
+	return nil
+}
+
 func (alog *AsyncLogging) WriteFatal(logline []byte) {
-	alog.LogFile.FlushFatal(logline)
+	alog.out.FlushFatal(logline)
 }
 
-func (alog *AsyncLogging) RenewCurrPageWithoutLock() {
-	if alog.FreePage == nil {
-		return
+// Dropped returns the lines and bytes dropped by the ASYNC_DROP policy.
+func (alog *AsyncLogging) Dropped() (lines uint64, bytes uint64) {
+	return atomic.LoadUint64(&alog.droppedLines), atomic.LoadUint64(&alog.droppedBytes)
+}
+
+func (alog *AsyncLogging) wake() {
+	select {
+	case alog.wakeChannel <- struct{}{}:
+	default:
+	}
+}
+
+// 取出待落盘的页, withCurrent时包括未写满的当前页
+func (alog *AsyncLogging) takePages(withCurrent bool) []*Buffer {
+	alog.mu.Lock()
+	defer alog.mu.Unlock()
+
+	pages := alog.pages
+	alog.pages = nil
+	if withCurrent && alog.FreePage != nil && alog.FreePage.Length() != 0 {
+		pages = append(pages, alog.FreePage)
+		alog.FreePage = nil
 	}
+	alog.cond.Broadcast()
+	return pages
+}
 
-	alog.PageChannel <- alog.FreePage
-	alog.FreePage = alog.PagePool.Get()
+func (alog *AsyncLogging) flushPages(withCurrent bool) {
+	for _, page := range alog.takePages(withCurrent) {
+		alog.WriteAndFreePage(page)
+	}
+	alog.reportDropped()
 }
 
 func (alog *AsyncLogging) WriteAndFreePage(page *Buffer) {
-	alog.LogFile.Flush(page.Bytes())
+	alog.out.Flush(page.Bytes())
 	alog.PagePool.Free(page)
 }
 
-func (alog *AsyncLogging) SyncFlush() {
-	defer alog.wait.Done()
-	for {
-		select {
-		case fullPage := <-alog.PageChannel:
-			alog.WriteAndFreePage(fullPage)
-		default:
-			alog.mu.Lock()
-			duePage := alog.FreePage
-			alog.FreePage = nil
-			alog.mu.Unlock()
-
-			if duePage != nil {
-				alog.WriteAndFreePage(duePage)
-			}
-
-			return
-		}
+// 有新丢弃的日志时在文件和stderr中记一行
+func (alog *AsyncLogging) reportDropped() {
+	lines, bytes := alog.Dropped()
+	if lines == alog.reportedLines {
+		return
 	}
+	line := fmt.Sprintf("%s korok: %d lines dropped, %d lines %d bytes in total\n",
+		time.Now().Format("01-02 15:04:05"), lines-alog.reportedLines, lines, bytes)
+	alog.reportedLines = lines
+	os.Stderr.WriteString(line)
+	alog.out.Flush([]byte(line))
 }
 
-func (alog *AsyncLogging) AsyncFlush() {
+func (alog *AsyncLogging) run() {
+	defer close(alog.doneChannel)
 
-	alog.wait.Add(1)
-	clocker := time.NewTicker(time.Duration(1000) * time.Millisecond)
+	clocker := time.NewTicker(time.Duration(ASYNC_FLUSH_INTERVAL) * time.Millisecond)
+	defer clocker.Stop()
 	for {
-		if alog.isStop == true {
-			return
-		}
-
 		select {
-		case <-alog.stopChannel:
-			if alog.isStop == true {
-				return
-			}
+		case <-alog.wakeChannel:
+			alog.flushPages(false)
 		case <-clocker.C:
-
-			alog.mu.Lock()
-			alog.RenewCurrPageWithoutLock()
-			alog.mu.Unlock()
-
-		case fullPage := <-alog.PageChannel:
-			alog.WriteAndFreePage(fullPage)
+			alog.flushPages(true)
+		case ack := <-alog.syncChannel:
+			alog.flushPages(true)
+			close(ack)
+		case <-alog.stopChannel:
+			alog.flushPages(true)
+			return
 		}
 	}
 }
 
 func (alog *AsyncLogging) StartRoutine() {
-	go func() {
-		defer alog.SyncFlush()
-		alog.AsyncFlush()
-	}()
+	go alog.run()
 }
 
+// Sync writes the buffered lines to the log files and syncs them to disk.
+func (alog *AsyncLogging) Sync() error {
+	ack := make(chan struct{})
+	select {
+	case alog.syncChannel <- ack:
+		<-ack
+	case <-alog.doneChannel:
+	}
+	return alog.out.Sync()
+}
+
+// Stop flushes the buffered lines, later lines are written synchronously.
 func (alog *AsyncLogging) Stop() {
-	alog.isStop = true
-	alog.stopChannel <- 1
-	alog.wait.Wait()
+	alog.stopOnce.Do(func() {
+		alog.mu.Lock()
+		alog.isStop = true
+		alog.cond.Broadcast()
+		alog.mu.Unlock()
+
+		close(alog.stopChannel)
+	})
+	<-alog.doneChannel
+	alog.out.Sync()
 }
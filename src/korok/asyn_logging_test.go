@@ -0,0 +1,239 @@
+package korok
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 记录写入内容的pageWriter, release关闭前Flush一直阻塞, 模拟很慢的磁盘
+type fakePageWriter struct {
+	release chan struct{}
+
+	mu    sync.Mutex
+	data  bytes.Buffer
+	fatal bytes.Buffer
+	syncs int
+}
+
+func newFakePageWriter(blocked bool) *fakePageWriter {
+	fw := &fakePageWriter{release: make(chan struct{})}
+	if !blocked {
+		close(fw.release)
+	}
+	return fw
+}
+
+func (fw *fakePageWriter) Flush(data []byte) (int, error) {
+	<-fw.release
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	return fw.data.Write(data)
+}
+
+func (fw *fakePageWriter) FlushFatal(data []byte) (int, error) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	return fw.fatal.Write(data)
+}
+
+func (fw *fakePageWriter) Sync() error {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	fw.syncs++
+	return nil
+}
+
+// 写入的日志行, 去掉丢弃日志的提示行
+func (fw *fakePageWriter) lines() []string {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	var res []string
+	for _, line := range strings.Split(strings.TrimSuffix(fw.data.String(), "\n"), "\n") {
+		if line != "" && !strings.Contains(line, "korok:") {
+			res = append(res, line)
+		}
+	}
+	return res
+}
+
+// 页大小64字节, 每行单独占一页
+const testPageSize = 64
+
+func testLine(i int) []byte {
+	return []byte(fmt.Sprintf("line %04d %s\n", i, strings.Repeat("x", 30)))
+}
+
+// 行按写入顺序排列, 允许中间有丢弃的行
+func checkOrdered(t *testing.T, lines []string) {
+	for i := 1; i < len(lines); i++ {
+		if lines[i] <= lines[i-1] {
+			t.Fatalf("line %q after %q", lines[i], lines[i-1])
+		}
+	}
+}
+
+func TestAsyncLoggingSync(t *testing.T) {
+	fw := newFakePageWriter(false)
+	alog := newAsyncLogging(fw, ASYNC_BLOCK, 4096)
+	defer alog.Stop()
+
+	for i := 0; i < 3; i++ {
+		alog.Write(testLine(i))
+	}
+	alog.WriteFatal([]byte("fatal\n"))
+	if err := alog.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 未写满的页在Sync时落盘
+	if lines := fw.lines(); len(lines) != 3 {
+		t.Errorf("lines after Sync %q", lines)
+	}
+	if fw.fatal.String() != "fatal\n" || fw.syncs != 1 {
+		t.Errorf("fatal %q syncs %d", fw.fatal.String(), fw.syncs)
+	}
+}
+
+func TestAsyncLoggingStop(t *testing.T) {
+	fw := newFakePageWriter(false)
+	alog := newAsyncLogging(fw, ASYNC_BLOCK, testPageSize)
+
+	n := 250
+	for i := 0; i < n; i++ {
+		alog.Write(testLine(i))
+	}
+	alog.Stop()
+
+	lines := fw.lines()
+	if len(lines) != n {
+		t.Fatalf("%d lines after Stop, want %d", len(lines), n)
+	}
+	checkOrdered(t, lines)
+
+	// 停止后同步写入
+	alog.Write(testLine(n))
+	if lines := fw.lines(); len(lines) != n+1 {
+		t.Errorf("%d lines after writing to a stopped logger, want %d", len(lines), n+1)
+	}
+	alog.Stop()
+}
+
+func TestAsyncLoggingDrop(t *testing.T) {
+	fw := newFakePageWriter(true)
+	alog := newAsyncLogging(fw, ASYNC_DROP, testPageSize)
+
+	// 落盘协程阻塞时, 排队的页超过ASYNC_MAX_PAGES后丢弃, Write不阻塞
+	n := ASYNC_MAX_PAGES * 3
+	written := 0
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < n; i++ {
+			if size, _ := alog.Write(testLine(i)); size != 0 {
+				written++
+			}
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Write blocked with the drop policy")
+	}
+
+	lines, bytes := alog.Dropped()
+	if lines == 0 || int(lines)+written != n || bytes != lines*uint64(len(testLine(0))) {
+		t.Fatalf("dropped %d lines %d bytes, written %d of %d", lines, bytes, written, n)
+	}
+	if written < ASYNC_MAX_PAGES {
+		t.Errorf("only %d lines written, the queue holds %d pages", written, ASYNC_MAX_PAGES)
+	}
+
+	close(fw.release)
+	alog.Stop()
+
+	got := fw.lines()
+	if len(got) != written {
+		t.Errorf("%d lines flushed, want %d", len(got), written)
+	}
+	checkOrdered(t, got)
+	// 丢弃的数量记在日志文件中
+	if !strings.Contains(fw.data.String(), fmt.Sprintf("korok: %d lines dropped", lines)) {
+		t.Error("dropped lines not reported in the log file")
+	}
+}
+
+func TestAsyncLoggingBlock(t *testing.T) {
+	fw := newFakePageWriter(true)
+	alog := newAsyncLogging(fw, ASYNC_BLOCK, testPageSize)
+
+	n := ASYNC_MAX_PAGES * 3
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < n; i++ {
+			alog.Write(testLine(i))
+		}
+	}()
+
+	// 队列满后Write等待落盘
+	select {
+	case <-done:
+		t.Fatal("Write should block while the queue is full")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(fw.release)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Write still blocked after the flusher is released")
+	}
+	alog.Stop()
+
+	if lines, _ := alog.Dropped(); lines != 0 {
+		t.Errorf("dropped %d lines with the block policy", lines)
+	}
+	got := fw.lines()
+	if len(got) != n {
+		t.Errorf("%d lines flushed, want %d", len(got), n)
+	}
+	checkOrdered(t, got)
+}
+
+func TestAsyncLoggingSetPolicy(t *testing.T) {
+	fw := newFakePageWriter(true)
+	alog := newAsyncLogging(fw, ASYNC_BLOCK, testPageSize)
+
+	n := ASYNC_MAX_PAGES * 3
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < n; i++ {
+			alog.Write(testLine(i))
+		}
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	// 改为drop后等待中的Write返回
+	if err := alog.SetPolicy(ASYNC_DROP); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Write still blocked after switching to the drop policy")
+	}
+	if lines, _ := alog.Dropped(); lines == 0 {
+		t.Error("no line dropped after switching to the drop policy")
+	}
+	if err := alog.SetPolicy("wait"); err == nil {
+		t.Error("SetPolicy should reject an unknown policy")
+	}
+
+	close(fw.release)
+	alog.Stop()
+}
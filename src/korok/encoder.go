@@ -0,0 +1,247 @@
+package korok
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	LOG_FORMAT_TEXT = "text"
+	LOG_FORMAT_JSON = "json"
+)
+
+const hexDigits = "0123456789abcdef"
+
+func checkFormat(format string) error {
+	if format != LOG_FORMAT_TEXT && format != LOG_FORMAT_JSON {
+		return fmt.Errorf("unknown log format %q, use %q or %q", format, LOG_FORMAT_TEXT, LOG_FORMAT_JSON)
+	}
+	return nil
+}
+
+// FieldLogger: Add key/value Fields to Text Log Buf, as " key=value".
+//
+func NewFieldLogger() *FieldLogger {
+	return &FieldLogger{}
+}
+
+type FieldLogger struct {
+}
+
+func (fl *FieldLogger) Handle(stream *Buffer, fields []interface{}) {
+	for i := 0; i < len(fields); i += 2 {
+		key, value := fieldAt(fields, i)
+		stream.AppendByte(' ')
+		stream.AppendString(key)
+		stream.AppendByte('=')
+
+		str := textValue(value)
+		if needQuote(str) {
+			stream.AppendString(strconv.Quote(str))
+		} else {
+			stream.AppendString(str)
+		}
+	}
+}
+
+// JsonLogger: Encode Whole Log Line as One Json Object.
+//
+func NewJsonLogger(svrName string) *JsonLogger {
+	return &JsonLogger{
+		svrName: svrName,
+		eventNames: map[int]string{
+			LOG_EVENT_NOTICE:  "NOTICE",
+			LOG_EVENT_ERROR:   "ERROR",
+			LOG_EVENT_FATAL:   "FATAL",
+			LOG_EVENT_WARNING: "WARNING",
+			LOG_EVENT_INFO:    "INFO",
+			LOG_EVENT_DEBUG:   "DEBUG",
+		},
+	}
+}
+
+// JsonLogger固定输出的字段
+var jsonHeaderKeys = map[string]bool{
+	"level":  true,
+	"time":   true,
+	"svr":    true,
+	"caller": true,
+	"logid":  true,
+	"msg":    true,
+}
+
+type JsonLogger struct {
+	svrName    string
+	eventNames map[int]string
+}
+
+func (jl *JsonLogger) Handle(stream *Buffer, logEvent int, logid uint32, file string, line int, msg string, fields []interface{}) {
+	stream.AppendString(`{"level":`)
+	appendJsonString(stream, jl.eventNames[logEvent])
+	stream.AppendString(`,"time":`)
+	appendJsonString(stream, time.Now().Format("2006-01-02T15:04:05.000000Z07:00"))
+	stream.AppendString(`,"svr":`)
+	appendJsonString(stream, jl.svrName)
+	stream.AppendString(`,"caller":"`)
+	appendJsonEscaped(stream, file)
+	stream.AppendByte(':')
+	stream.AppendInt(int64(line))
+	stream.AppendByte('"')
+	if logid != 0 {
+		stream.AppendString(`,"logid":`)
+		stream.AppendUint(uint64(logid))
+	}
+	stream.AppendString(`,"msg":`)
+	appendJsonString(stream, msg)
+
+	for i := 0; i < len(fields); i += 2 {
+		key, value := fieldAt(fields, i)
+		if jsonHeaderKeys[key] {
+			// 与固定字段重名时加前缀, 避免输出重复的key
+			key = "fields." + key
+		}
+		stream.AppendByte(',')
+		appendJsonString(stream, key)
+		stream.AppendByte(':')
+		appendJsonValue(stream, value)
+	}
+	stream.AppendByte('}')
+}
+
+// 取第i个key/value, key不是string或缺少value时照常输出, 方便发现调用错误
+func fieldAt(fields []interface{}, i int) (string, interface{}) {
+	key, ok := fields[i].(string)
+	if !ok {
+		key = "!BADKEY(" + fmt.Sprint(fields[i]) + ")"
+	}
+	if i+1 >= len(fields) {
+		return key, "!MISSING"
+	}
+	return key, fields[i+1]
+}
+
+func textValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "<nil>"
+	case string:
+		return v
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(value)
+}
+
+func needQuote(str string) bool {
+	if str == "" {
+		return true
+	}
+	for _, r := range str {
+		if r <= ' ' || r == '=' || r == '"' || r == utf8.RuneError {
+			return true
+		}
+	}
+	return false
+}
+
+func appendJsonValue(stream *Buffer, value interface{}) {
+	switch v := value.(type) {
+	case nil:
+		stream.AppendString("null")
+	case string:
+		appendJsonString(stream, v)
+	case bool:
+		stream.AppendString(strconv.FormatBool(v))
+	case int:
+		stream.AppendInt(int64(v))
+	case int32:
+		stream.AppendInt(int64(v))
+	case int64:
+		stream.AppendInt(v)
+	case uint:
+		stream.AppendUint(uint64(v))
+	case uint32:
+		stream.AppendUint(uint64(v))
+	case uint64:
+		stream.AppendUint(v)
+	case float32:
+		appendJsonFloat(stream, float64(v))
+	case float64:
+		appendJsonFloat(stream, v)
+	case time.Time:
+		appendJsonString(stream, v.Format(time.RFC3339Nano))
+	case time.Duration:
+		appendJsonString(stream, v.String())
+	case error:
+		appendJsonString(stream, v.Error())
+	case fmt.Stringer:
+		appendJsonString(stream, v.String())
+	default:
+		bs, err := json.Marshal(v)
+		if err != nil {
+			appendJsonString(stream, fmt.Sprint(v))
+			return
+		}
+		stream.AppendByteSlice(bs)
+	}
+}
+
+// json不支持NaN和Inf, 按字符串输出
+func appendJsonFloat(stream *Buffer, f float64) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		appendJsonString(stream, strconv.FormatFloat(f, 'f', -1, 64))
+		return
+	}
+	stream.AppendFloat(f)
+}
+
+func appendJsonString(stream *Buffer, str string) {
+	stream.AppendByte('"')
+	appendJsonEscaped(stream, str)
+	stream.AppendByte('"')
+}
+
+func appendJsonEscaped(stream *Buffer, str string) {
+	for i := 0; i < len(str); {
+		c := str[i]
+		if c >= utf8.RuneSelf {
+			r, size := utf8.DecodeRuneInString(str[i:])
+			if r == utf8.RuneError && size == 1 {
+				stream.AppendString(`�`)
+			} else {
+				stream.AppendString(str[i : i+size])
+			}
+			i += size
+			continue
+		}
+
+		switch c {
+		case '"', '\\':
+			stream.AppendByte('\\')
+			stream.AppendByte(c)
+		case '\n':
+			stream.AppendString(`\n`)
+		case '\r':
+			stream.AppendString(`\r`)
+		case '\t':
+			stream.AppendString(`\t`)
+		default:
+			if c < 0x20 {
+				stream.AppendString(`\u00`)
+				stream.AppendByte(hexDigits[c>>4])
+				stream.AppendByte(hexDigits[c&0xf])
+			} else {
+				stream.AppendByte(c)
+			}
+		}
+		i++
+	}
+}
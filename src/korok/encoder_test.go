@@ -0,0 +1,153 @@
+package korok
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+var jsonTimePattern = regexp.MustCompile(`"time":"[^"]+"`)
+
+type testStringer struct{}
+
+func (testStringer) String() string {
+	return "stringer \"value\""
+}
+
+type testStruct struct {
+	Coin  string  `json:"coin"`
+	Ratio float64 `json:"ratio"`
+}
+
+func jsonLines() []string {
+	jl := NewJsonLogger("shannon")
+	cases := []struct {
+		logEvent int
+		logid    uint32
+		file     string
+		line     int
+		msg      string
+		fields   []interface{}
+	}{
+		{LOG_EVENT_INFO, 0, "main.go", 42, "started", nil},
+		{LOG_EVENT_ERROR, 1234567, "coin_info.go", 108, "[ada] renew \"balance\" failed:\n\ttimeout", []interface{}{
+			"symbol", "adausdt",
+			"attempt", 3,
+			"price", 0.2875,
+			"amount", int64(-12),
+			"logid", uint32(7),
+			"ok", false,
+			"err", errors.New("dial tcp: i/o timeout"),
+			"elapsed", 1500 * time.Millisecond,
+			"at", time.Date(2026, 10, 19, 8, 30, 0, 0, time.UTC),
+			"nil", nil,
+		}},
+		{LOG_EVENT_WARNING, 1, `C:\shannon\auto_rebalance.go`, 7, "控制字符\x01\x1f 和 无效\xff编码", []interface{}{
+			"quote\"key", "back\\slash",
+			"nan", math.NaN(),
+			"inf", math.Inf(-1),
+			"stringer", testStringer{},
+			"struct", testStruct{Coin: "ada", Ratio: 1.05},
+			"list", []string{"a", "b"},
+			"msg", "field msg",
+			42, "bad key",
+			"missing",
+		}},
+	}
+
+	var lines []string
+	for _, c := range cases {
+		stream := &Buffer{}
+		jl.Handle(stream, c.logEvent, c.logid, c.file, c.line, c.msg, c.fields)
+		lines = append(lines, stream.String())
+	}
+	return lines
+}
+
+func TestJsonLoggerGolden(t *testing.T) {
+	lines := jsonLines()
+	got := jsonTimePattern.ReplaceAllString(strings.Join(lines, "\n")+"\n", `"time":"TIME"`)
+
+	golden := filepath.Join("testdata", "json_encoder.golden")
+	if *update {
+		if err := ioutil.WriteFile(golden, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("json lines:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestJsonLoggerValid(t *testing.T) {
+	lines := jsonLines()
+	for i, line := range lines {
+		if !json.Valid([]byte(line)) {
+			t.Errorf("line %d is not valid json: %s", i, line)
+		}
+	}
+
+	var record map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[1]), &record); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"level":   "ERROR",
+		"svr":     "shannon",
+		"caller":  "coin_info.go:108",
+		"logid":   float64(1234567),
+		"msg":     "[ada] renew \"balance\" failed:\n\ttimeout",
+		"symbol":  "adausdt",
+		"attempt": float64(3),
+		"err":     "dial tcp: i/o timeout",
+		"elapsed": "1.5s",
+		"nil":     nil,
+	}
+	for key, value := range want {
+		if record[key] != value {
+			t.Errorf("%s = %#v, want %#v", key, record[key], value)
+		}
+	}
+	if strings.Count(lines[1], `"logid":`) != 1 {
+		t.Errorf("duplicate logid key: %s", lines[1])
+	}
+	if record["fields.logid"] != float64(7) {
+		t.Errorf("fields.logid = %#v, want 7", record["fields.logid"])
+	}
+	if _, err := time.Parse("2006-01-02T15:04:05.000000Z07:00", record["time"].(string)); err != nil {
+		t.Errorf("time: %s", err)
+	}
+
+	// logid为0时不输出
+	record = nil
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := record["logid"]; ok {
+		t.Errorf("logid 0 should be omitted: %s", lines[0])
+	}
+
+	record = nil
+	if err := json.Unmarshal([]byte(lines[2]), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record["fields.msg"] != "field msg" {
+		t.Errorf("fields.msg = %#v, want field msg", record["fields.msg"])
+	}
+	if record["caller"] != `C:\shannon\auto_rebalance.go:7` || record["msg"] != "控制字符\x01\x1f 和 无效\uFFFD编码" {
+		t.Errorf("escaped caller %q msg %q", record["caller"], record["msg"])
+	}
+}
@@ -1,13 +1,171 @@
 package korok
 
+import "context"
+
 var globalLogger *Logger
 
+func Debug(msg string, v ...interface{}) {
+	globalLogger.Debug(0, msg, v...)
+}
+
+func Notice(msg string, v ...interface{}) {
+	globalLogger.Notice(0, msg, v...)
+}
+
 func Info(msg string, v ...interface{}) {
-	globalLogger.Info(6, msg, v...)
+	globalLogger.Info(0, msg, v...)
+}
+
+func Warn(msg string, v ...interface{}) {
+	globalLogger.Warn(0, msg, v...)
+}
+
+func Error(msg string, v ...interface{}) {
+	globalLogger.Error(0, msg, v...)
 }
 
+// Fatal logs, flushes the log files and exits the process with code 1.
 func Fatal(msg string, v ...interface{}) {
-	globalLogger.Fatal(6, msg, v...)
+	globalLogger.Fatal(0, msg, v...)
+}
+
+func Debugw(msg string, keysAndValues ...interface{}) {
+	globalLogger.Debugw(0, msg, keysAndValues...)
+}
+
+func Noticew(msg string, keysAndValues ...interface{}) {
+	globalLogger.Noticew(0, msg, keysAndValues...)
+}
+
+// Infow logs msg with key/value fields, e.g. Infow("rebalance", "coin", "ada", "ratio", 1.2).
+func Infow(msg string, keysAndValues ...interface{}) {
+	globalLogger.Infow(0, msg, keysAndValues...)
+}
+
+func Warnw(msg string, keysAndValues ...interface{}) {
+	globalLogger.Warnw(0, msg, keysAndValues...)
+}
+
+func Errorw(msg string, keysAndValues ...interface{}) {
+	globalLogger.Errorw(0, msg, keysAndValues...)
+}
+
+func Fatalw(msg string, keysAndValues ...interface{}) {
+	globalLogger.Fatalw(0, msg, keysAndValues...)
+}
+
+// The Ctx variants prefix the line with the log ID carried by ctx, see WithLogID.
+
+func DebugCtx(ctx context.Context, msg string, v ...interface{}) {
+	globalLogger.Debug(LogIDFromContext(ctx), msg, v...)
+}
+
+func NoticeCtx(ctx context.Context, msg string, v ...interface{}) {
+	globalLogger.Notice(LogIDFromContext(ctx), msg, v...)
+}
+
+func InfoCtx(ctx context.Context, msg string, v ...interface{}) {
+	globalLogger.Info(LogIDFromContext(ctx), msg, v...)
+}
+
+func WarnCtx(ctx context.Context, msg string, v ...interface{}) {
+	globalLogger.Warn(LogIDFromContext(ctx), msg, v...)
+}
+
+func ErrorCtx(ctx context.Context, msg string, v ...interface{}) {
+	globalLogger.Error(LogIDFromContext(ctx), msg, v...)
+}
+
+func DebugwCtx(ctx context.Context, msg string, keysAndValues ...interface{}) {
+	globalLogger.Debugw(LogIDFromContext(ctx), msg, keysAndValues...)
+}
+
+func NoticewCtx(ctx context.Context, msg string, keysAndValues ...interface{}) {
+	globalLogger.Noticew(LogIDFromContext(ctx), msg, keysAndValues...)
+}
+
+func InfowCtx(ctx context.Context, msg string, keysAndValues ...interface{}) {
+	globalLogger.Infow(LogIDFromContext(ctx), msg, keysAndValues...)
+}
+
+func WarnwCtx(ctx context.Context, msg string, keysAndValues ...interface{}) {
+	globalLogger.Warnw(LogIDFromContext(ctx), msg, keysAndValues...)
+}
+
+func ErrorwCtx(ctx context.Context, msg string, keysAndValues ...interface{}) {
+	globalLogger.Errorw(LogIDFromContext(ctx), msg, keysAndValues...)
+}
+
+// SetFormat switches the global logger between LOG_FORMAT_TEXT and LOG_FORMAT_JSON.
+func SetFormat(format string) error {
+	return globalLogger.SetFormat(format)
+}
+
+// SetLevel changes the level of the global logger at runtime.
+func SetLevel(level int) {
+	globalLogger.SetLevel(level)
+}
+
+func GetLevel() int {
+	return globalLogger.Level()
+}
+
+// SetRotation changes the rotation and retention of the global log files.
+func SetRotation(rotate string, maxBackups int, maxAge int, compress bool) error {
+	return globalLogger.SetRotation(rotate, maxBackups, maxAge, compress)
+}
+
+// ConfigureSinks replaces the sinks of the global logger.
+func ConfigureSinks(confs []*SinkConf) error {
+	return globalLogger.ConfigureSinks(confs)
+}
+
+// RecentLines returns the last n lines kept by the ring sink, nil if there
+// is no ring sink.
+func RecentLines(n int) []string {
+	ring := globalLogger.Ring()
+	if ring == nil {
+		return nil
+	}
+	return ring.Lines(n)
+}
+
+// SetSampling rate-limits the lines of every callsite of the global logger.
+func SetSampling(conf *SampleConf) {
+	globalLogger.SetSampling(conf)
+}
+
+// Sampled returns how many lines the global logger dropped by sampling.
+func Sampled() uint64 {
+	return globalLogger.Sampled()
+}
+
+// SetPolicy sets what the global log files do when lines pile up.
+func SetPolicy(policy string) error {
+	return globalLogger.SetPolicy(policy)
+}
+
+// Dropped returns the lines and bytes dropped by the global log files.
+func Dropped() (lines uint64, bytes uint64) {
+	return globalLogger.Dropped()
+}
+
+// Sync writes out the lines buffered by the global logger.
+func Sync() error {
+	return globalLogger.Sync()
+}
+
+// Stop flushes the global logger, call it before the process exits.
+func Stop() {
+	globalLogger.Stop()
+}
+
+// FlushOnPanic flushes the global logger when a goroutine panics, use it as
+// defer korok.FlushOnPanic().
+func FlushOnPanic() {
+	if r := recover(); r != nil {
+		globalLogger.panicked(r)
+	}
 }
 
 func init() {
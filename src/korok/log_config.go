@@ -7,6 +7,17 @@ type LogConf struct {
 	FileSize       int64
 	FlushThreshold int32
 	CallerSkip     int
+	Format         string // LOG_FORMAT_TEXT, LOG_FORMAT_JSON
+
+	Rotate     string // ROTATE_HOURLY, ROTATE_DAILY, ROTATE_SIZE
+	MaxBackups int    // 保留的备份数, 0不限制
+	MaxAge     int    // 备份保留的小时数, 0不限制
+	Compress   bool   // gzip压缩备份
+
+	Policy string // ASYNC_BLOCK, ASYNC_DROP, 日志积压时的处理方式
+
+	// 输出目标, 为空时只写日志文件
+	Sinks []*SinkConf
 }
 
 func NewLogConf() *LogConf {
@@ -17,6 +28,9 @@ func NewLogConf() *LogConf {
 		FileSize:       2000000000,
 		FlushThreshold: 4000 * 1000,
 		CallerSkip:     5,
+		Format:         LOG_FORMAT_TEXT,
+		Rotate:         ROTATE_HOURLY,
+		Policy:         ASYNC_BLOCK,
 	}
 }
 
@@ -43,3 +57,27 @@ func (conf *LogConf) SetFlushThreshold(ts int32) {
 func (conf *LogConf) SetCallerSkip(skip int) {
 	conf.CallerSkip = skip
 }
+
+func (conf *LogConf) SetFormat(format string) {
+	conf.Format = format
+}
+
+func (conf *LogConf) SetRotate(rotate string) {
+	conf.Rotate = rotate
+}
+
+func (conf *LogConf) SetMaxBackups(n int) {
+	conf.MaxBackups = n
+}
+
+func (conf *LogConf) SetMaxAge(hours int) {
+	conf.MaxAge = hours
+}
+
+func (conf *LogConf) SetCompress(compress bool) {
+	conf.Compress = compress
+}
+
+func (conf *LogConf) SetPolicy(policy string) {
+	conf.Policy = policy
+}
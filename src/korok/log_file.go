@@ -1,8 +1,13 @@
 package korok
 
 import (
+	"compress/gzip"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
@@ -11,11 +16,35 @@ const (
 	CUT_CHECK_INTERVAL = 20
 )
 
+// 切分方式, 任何方式下文件超过FileSize都会切分
+const (
+	ROTATE_HOURLY = "hourly"
+	ROTATE_DAILY  = "daily"
+	ROTATE_SIZE   = "size"
+)
+
+func checkRotate(rotate string) error {
+	if rotate != ROTATE_HOURLY && rotate != ROTATE_DAILY && rotate != ROTATE_SIZE {
+		return fmt.Errorf("unknown log rotate %q, use %q, %q or %q", rotate, ROTATE_HOURLY, ROTATE_DAILY, ROTATE_SIZE)
+	}
+	return nil
+}
+
 func NewLogFile(conf *LogConf) *LogFile {
 	lf := &LogFile{
-		FileName: conf.Name,
-		FilePath: conf.FilePath,
-		FileSize: conf.FileSize,
+		FileName:   conf.Name,
+		FilePath:   conf.FilePath,
+		FileSize:   conf.FileSize,
+		Rotate:     conf.Rotate,
+		MaxBackups: conf.MaxBackups,
+		MaxAge:     time.Duration(conf.MaxAge) * time.Hour,
+		Compress:   conf.Compress,
+	}
+	if lf.Rotate == "" {
+		lf.Rotate = ROTATE_HOURLY
+	}
+	if err := checkRotate(lf.Rotate); err != nil {
+		panic(err)
 	}
 	lf.Init()
 	return lf
@@ -26,9 +55,17 @@ type LogFile struct {
 	FilePath string
 	FileSize int64
 
+	Rotate     string
+	MaxBackups int           // 保留的备份数, 0不限制, 由cleanMu保护
+	MaxAge     time.Duration // 备份保留时间, 0不限制, 由cleanMu保护
+	Compress   bool          // 后台gzip压缩切分出的备份, 由cleanMu保护
+
 	SinceLastCheck int
 	LastCheckTime  time.Time
 
+	// 当前文件所属的周期的开始时间, 切分时用于备份文件名
+	PeriodStart time.Time
+
 	NormalFileName string
 	FatalFileName  string
 
@@ -36,6 +73,30 @@ type LogFile struct {
 
 	NormalFile *os.File
 	FatalFile  *os.File
+
+	// 压缩和清理在后台串行执行
+	cleanMu sync.Mutex
+}
+
+// 修改切分和保留策略, 下次检查时生效
+func (lf *LogFile) SetRotation(rotate string, maxBackups int, maxAge time.Duration, compress bool) error {
+	if rotate == "" {
+		rotate = ROTATE_HOURLY
+	}
+	if err := checkRotate(rotate); err != nil {
+		return err
+	}
+
+	lf.FileMu.Lock()
+	defer lf.FileMu.Unlock()
+	lf.Rotate = rotate
+
+	lf.cleanMu.Lock()
+	lf.MaxBackups = maxBackups
+	lf.MaxAge = maxAge
+	lf.Compress = compress
+	lf.cleanMu.Unlock()
+	return nil
 }
 
 func (lf *LogFile) Init() {
@@ -60,11 +121,34 @@ func (lf *LogFile) Init() {
 	lf.FatalFile = file
 
 	lf.LastCheckTime = time.Now().Local()
+	lf.PeriodStart = lf.LastCheckTime
+	if stat, err := lf.NormalFile.Stat(); err == nil && stat.Size() > 0 {
+		// 续写上次进程留下的文件, 周期从文件的修改时间算起
+		lf.PeriodStart = stat.ModTime().Local()
+	}
 }
 
 func (lf *LogFile) CloseFile() {
-	lf.NormalFile.Close()
-	lf.FatalFile.Close()
+	closeFile(lf.NormalFile)
+	closeFile(lf.FatalFile)
+}
+
+// 打开失败时会退化到stderr, 不能关闭
+func closeFile(file *os.File) {
+	if file != nil && file != os.Stderr {
+		file.Close()
+	}
+}
+
+// 周期的标识, 用于判断是否跨周期以及备份文件名
+func (lf *LogFile) periodKey(t time.Time) string {
+	switch lf.Rotate {
+	case ROTATE_DAILY:
+		return t.Format("20060102")
+	case ROTATE_SIZE:
+		return t.Format("20060102150405")
+	}
+	return t.Format("2006010215")
 }
 
 func (lf *LogFile) NeedCut() bool {
@@ -76,49 +160,32 @@ func (lf *LogFile) NeedCut() bool {
 		return false
 	}
 
-	fileStat, err := lf.NormalFile.Stat()
-	if err != nil {
-		return false
-	}
-
-	defer func() {
-		lf.LastCheckTime = time.Now().Local()
-	}()
-
 	now := time.Now().Local()
-	if now.Hour()-lf.LastCheckTime.Hour() != 0 {
-		return true
-	}
+	lf.LastCheckTime = now
 
-	if fileStat.Size() > lf.FileSize {
+	// 比较完整的日期, 同一小时不同天也要切分
+	if lf.Rotate != ROTATE_SIZE && lf.periodKey(now) != lf.periodKey(lf.PeriodStart) {
 		return true
 	}
 
-	return false
+	fileStat, err := lf.NormalFile.Stat()
+	if err != nil {
+		return false
+	}
+	return fileStat.Size() > lf.FileSize
 }
 
-func (lf *LogFile) AutoCut() {
+func (lf *LogFile) autoCutWithoutLock() {
 	if !lf.NeedCut() {
 		return
 	}
 
-	lf.FileMu.Lock()
-	defer lf.FileMu.Unlock()
-
 	lf.CloseFile()
 
-	timeStamp := fmt.Sprintf("%d%02d%02d%02d",
-		lf.LastCheckTime.Year(),
-		int(lf.LastCheckTime.Month()),
-		lf.LastCheckTime.Day(),
-		lf.LastCheckTime.Hour())
+	timeStamp := lf.periodKey(lf.PeriodStart)
 	tryIndex := 0
 	backupNormalFileName := fmt.Sprintf("%s.%s", lf.NormalFileName, timeStamp)
-	for {
-		_, err := os.Stat(backupNormalFileName)
-		if os.IsNotExist(err) {
-			break
-		}
+	for lf.backupExists(backupNormalFileName) {
 		tryIndex = tryIndex + 1
 		backupNormalFileName = fmt.Sprintf("%s.%s_%d", lf.NormalFileName, timeStamp, tryIndex)
 	}
@@ -128,12 +195,165 @@ func (lf *LogFile) AutoCut() {
 		backupFatalFileName = fmt.Sprintf("%s_%d", backupFatalFileName, tryIndex)
 	}
 
-	os.Rename(lf.NormalFileName, backupNormalFileName)
-	os.Rename(lf.FatalFileName, backupFatalFileName)
+	var errs []string
+	var backups []string
+	if err := os.Rename(lf.NormalFileName, backupNormalFileName); err != nil {
+		errs = append(errs, err.Error())
+	} else {
+		backups = append(backups, backupNormalFileName)
+	}
+	if err := os.Rename(lf.FatalFileName, backupFatalFileName); err != nil {
+		errs = append(errs, err.Error())
+	} else {
+		backups = append(backups, backupFatalFileName)
+	}
+
+	lf.NormalFile = lf.reopen(lf.NormalFileName, &errs)
+	lf.FatalFile = lf.reopen(lf.FatalFileName, &errs)
+	lf.PeriodStart = lf.LastCheckTime
+
+	if len(errs) != 0 {
+		// 不能通过logger自己输出, 写到stderr和新的日志文件
+		line := fmt.Sprintf("%s korok: rotate %s failed: %s\n",
+			time.Now().Format("01-02 15:04:05"), lf.NormalFileName, strings.Join(errs, "; "))
+		os.Stderr.WriteString(line)
+		if lf.NormalFile != os.Stderr {
+			lf.NormalFile.WriteString(line)
+		}
+	}
 
-	lf.NormalFile, _ = lf.OpenOrCreateFile(lf.NormalFileName)
-	lf.FatalFile, _ = lf.OpenOrCreateFile(lf.FatalFileName)
+	go lf.clean(backups)
+}
 
+// 压缩后的备份也算已存在
+func (lf *LogFile) backupExists(name string) bool {
+	for _, n := range []string{name, name + ".gz"} {
+		if _, err := os.Stat(n); !os.IsNotExist(err) {
+			return true
+		}
+	}
+	return false
+}
+
+func (lf *LogFile) reopen(fileName string, errs *[]string) *os.File {
+	file, err := lf.OpenOrCreateFile(fileName)
+	if err != nil {
+		*errs = append(*errs, err.Error()+", write to stderr")
+		return os.Stderr
+	}
+	return file
+}
+
+func (lf *LogFile) AutoCut() {
+	lf.FileMu.Lock()
+	defer lf.FileMu.Unlock()
+	lf.autoCutWithoutLock()
+}
+
+// 压缩新切分出的备份, 然后按数量和时间清理旧备份
+func (lf *LogFile) clean(backups []string) {
+	lf.cleanMu.Lock()
+	defer lf.cleanMu.Unlock()
+
+	if lf.Compress {
+		for _, backup := range backups {
+			if err := compressFile(backup); err != nil {
+				fmt.Fprintf(os.Stderr, "korok: compress %s failed: %s\n", backup, err)
+			}
+		}
+	}
+
+	lf.removeOldBackups(lf.NormalFileName, lf.FatalFileName)
+	lf.removeOldBackups(lf.FatalFileName, "")
+}
+
+func compressFile(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	stat, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	tmp := name + ".gz.tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	gw := gzip.NewWriter(dst)
+	_, err = io.Copy(gw, src)
+	if err == nil {
+		err = gw.Close()
+	}
+	if err == nil {
+		err = dst.Close()
+	} else {
+		dst.Close()
+	}
+	// 保留原文件的修改时间, MaxAge从切分时算起而不是压缩时
+	if err == nil {
+		err = os.Chtimes(tmp, stat.ModTime(), stat.ModTime())
+	}
+	if err == nil {
+		err = os.Rename(tmp, name+".gz")
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Remove(name)
+}
+
+// 备份文件名为 <base>.<时间>[_n][.gz], exclude是另一类日志的前缀
+func (lf *LogFile) removeOldBackups(base string, exclude string) {
+	if lf.MaxBackups <= 0 && lf.MaxAge <= 0 {
+		return
+	}
+
+	matches, err := filepath.Glob(base + ".*")
+	if err != nil {
+		return
+	}
+
+	type backup struct {
+		name    string
+		modTime time.Time
+	}
+	var backups []backup
+	for _, name := range matches {
+		if exclude != "" && strings.HasPrefix(name, exclude) {
+			continue
+		}
+		if strings.HasSuffix(name, ".tmp") {
+			continue
+		}
+		stat, err := os.Stat(name)
+		if err != nil || stat.IsDir() {
+			continue
+		}
+		backups = append(backups, backup{name: name, modTime: stat.ModTime()})
+	}
+
+	// 新的在前
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].modTime.After(backups[j].modTime)
+	})
+
+	now := time.Now()
+	for i, b := range backups {
+		expired := lf.MaxAge > 0 && now.Sub(b.modTime) > lf.MaxAge
+		exceeded := lf.MaxBackups > 0 && i >= lf.MaxBackups
+		if !expired && !exceeded {
+			continue
+		}
+		if err := os.Remove(b.name); err != nil {
+			fmt.Fprintf(os.Stderr, "korok: remove old log %s failed: %s\n", b.name, err)
+		}
+	}
 }
 
 func (lf *LogFile) OpenOrCreateFile(fileName string) (*os.File, error) {
@@ -142,8 +362,10 @@ func (lf *LogFile) OpenOrCreateFile(fileName string) (*os.File, error) {
 }
 
 func (lf *LogFile) Flush(data []byte) (int, error) {
+	lf.FileMu.Lock()
+	defer lf.FileMu.Unlock()
 
-	lf.AutoCut()
+	lf.autoCutWithoutLock()
 
 	len, err := lf.NormalFile.Write(data)
 
@@ -158,3 +380,20 @@ func (lf *LogFile) FlushFatal(data []byte) (int, error) {
 
 	return len, err
 }
+
+// 把已写入的内容刷到磁盘
+func (lf *LogFile) Sync() error {
+	lf.FileMu.Lock()
+	defer lf.FileMu.Unlock()
+
+	var firstErr error
+	for _, file := range []*os.File{lf.NormalFile, lf.FatalFile} {
+		if file == nil || file == os.Stderr {
+			continue
+		}
+		if err := file.Sync(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
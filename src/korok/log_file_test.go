@@ -0,0 +1,240 @@
+package korok
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func newTestLogFile(t *testing.T, rotate string) *LogFile {
+	conf := NewLogConf()
+	conf.SetFilePath(t.TempDir())
+	conf.SetRotate(rotate)
+	lf := NewLogFile(conf)
+	t.Cleanup(func() {
+		lf.FileMu.Lock()
+		lf.CloseFile()
+		lf.FileMu.Unlock()
+		// 等待后台清理结束, 再删除临时目录
+		lf.cleanMu.Lock()
+		lf.cleanMu.Unlock()
+	})
+	return lf
+}
+
+func readFile(t *testing.T, name string) string {
+	content, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func waitFile(t *testing.T, name string) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := os.Stat(name); err == nil {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("%s not created", name)
+}
+
+func backupNames(t *testing.T, lf *LogFile) []string {
+	matches, err := filepath.Glob(lf.NormalFileName + ".*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, name := range matches {
+		if name != lf.FatalFileName {
+			names = append(names, filepath.Base(name))
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestLogFileDailyRotate(t *testing.T) {
+	lf := newTestLogFile(t, ROTATE_DAILY)
+	lf.Flush([]byte("yesterday\n"))
+	lf.FlushFatal([]byte("yesterday fatal\n"))
+
+	// 模拟跨天: 当前文件属于昨天的周期
+	yesterday := time.Now().Local().AddDate(0, 0, -1)
+	lf.PeriodStart = yesterday
+	lf.SinceLastCheck = 0
+	lf.Flush([]byte("today\n"))
+
+	backup := lf.NormalFileName + "." + yesterday.Format("20060102")
+	if got := readFile(t, backup); got != "yesterday\n" {
+		t.Errorf("backup %q", got)
+	}
+	if got := readFile(t, lf.FatalFileName+"."+yesterday.Format("20060102")); got != "yesterday fatal\n" {
+		t.Errorf("fatal backup %q", got)
+	}
+	if got := readFile(t, lf.NormalFileName); got != "today\n" {
+		t.Errorf("current file %q", got)
+	}
+	if lf.periodKey(lf.PeriodStart) != lf.periodKey(time.Now().Local()) {
+		t.Errorf("period start %s not moved to today", lf.PeriodStart)
+	}
+
+	// 同一天内不切分, 只在每CUT_CHECK_INTERVAL次写入时检查
+	for i := 0; i < CUT_CHECK_INTERVAL*2; i++ {
+		lf.Flush([]byte("x\n"))
+	}
+	if names := backupNames(t, lf); len(names) != 2 {
+		t.Errorf("backups %v, want only the rotated ones", names)
+	}
+}
+
+func TestLogFileRotateNameConflict(t *testing.T) {
+	lf := newTestLogFile(t, ROTATE_HOURLY)
+	lastHour := time.Now().Local().Add(-time.Hour)
+	key := lastHour.Format("2006010215")
+	// 已有同名的压缩备份, 例如进程重启后同一周期再次切分
+	ioutil.WriteFile(lf.NormalFileName+"."+key+".gz", nil, 0644)
+
+	lf.Flush([]byte("a\n"))
+	lf.PeriodStart = lastHour
+	lf.SinceLastCheck = 0
+	lf.Flush([]byte("b\n"))
+
+	if got := readFile(t, lf.NormalFileName+"."+key+"_1"); got != "a\n" {
+		t.Errorf("backup %q", got)
+	}
+	waitFile(t, lf.FatalFileName+"."+key+"_1")
+}
+
+func TestLogFileSizeRotate(t *testing.T) {
+	lf := newTestLogFile(t, ROTATE_SIZE)
+	lf.FileSize = 10
+	lf.Flush([]byte("0123456789ab\n"))
+	lf.SinceLastCheck = 0
+	lf.Flush([]byte("next\n"))
+
+	names := backupNames(t, lf)
+	if len(names) != 2 || readFile(t, filepath.Join(lf.FilePath, names[0])) != "0123456789ab\n" {
+		t.Errorf("backups %v", names)
+	}
+}
+
+// 创建修改时间为age之前的备份, 内容为文件名
+func writeBackup(t *testing.T, name string, age time.Duration) {
+	if err := ioutil.WriteFile(name, []byte(name), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Now().Add(-age)
+	if err := os.Chtimes(name, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLogFileRetention(t *testing.T) {
+	lf := newTestLogFile(t, ROTATE_HOURLY)
+	for i, key := range []string{"2026101905", "2026101904", "2026101903", "2026101902"} {
+		age := time.Duration(i+1) * time.Hour
+		writeBackup(t, lf.NormalFileName+"."+key, age)
+		writeBackup(t, lf.FatalFileName+"."+key, age)
+	}
+	writeBackup(t, lf.NormalFileName+".2026101901.gz", 5*time.Hour)
+	writeBackup(t, lf.NormalFileName+".2026101900.gz.tmp", 10*time.Hour)
+
+	// 按数量: 普通日志和.wf各自保留3个
+	lf.SetRotation(ROTATE_HOURLY, 3, 0, false)
+	lf.clean(nil)
+	want := []string{
+		"shannon.log.2026101900.gz.tmp",
+		"shannon.log.2026101903", "shannon.log.2026101904", "shannon.log.2026101905",
+		"shannon.log.wf.2026101903", "shannon.log.wf.2026101904", "shannon.log.wf.2026101905",
+	}
+	if names := backupNames(t, lf); !equalStrings(names, want) {
+		t.Errorf("backups after MaxBackups:\n%v\nwant:\n%v", names, want)
+	}
+
+	// 按时间: 超过2.5小时的删除
+	lf.SetRotation(ROTATE_HOURLY, 0, 150*time.Minute, false)
+	lf.clean(nil)
+	want = []string{
+		"shannon.log.2026101900.gz.tmp",
+		"shannon.log.2026101904", "shannon.log.2026101905",
+		"shannon.log.wf.2026101904", "shannon.log.wf.2026101905",
+	}
+	if names := backupNames(t, lf); !equalStrings(names, want) {
+		t.Errorf("backups after MaxAge:\n%v\nwant:\n%v", names, want)
+	}
+}
+
+func TestLogFileCompress(t *testing.T) {
+	lf := newTestLogFile(t, ROTATE_HOURLY)
+	backup := lf.NormalFileName + ".2026101905"
+	writeBackup(t, backup, 3*time.Hour)
+	stat, _ := os.Stat(backup)
+
+	lf.SetRotation(ROTATE_HOURLY, 0, 0, true)
+	lf.clean([]string{backup})
+
+	if _, err := os.Stat(backup); !os.IsNotExist(err) {
+		t.Errorf("%s should be removed after compression", backup)
+	}
+	gzStat, err := os.Stat(backup + ".gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 压缩后保留原来的修改时间, MaxAge按切分时间计算
+	if !gzStat.ModTime().Equal(stat.ModTime()) {
+		t.Errorf("compressed mtime %s, want %s", gzStat.ModTime(), stat.ModTime())
+	}
+
+	file, err := os.Open(backup + ".gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	gr, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadAll(gr)
+	if err != nil || string(content) != backup {
+		t.Errorf("decompressed %q (%v)", content, err)
+	}
+
+	lf.SetRotation(ROTATE_HOURLY, 0, 2*time.Hour, true)
+	lf.clean(nil)
+	if _, err := os.Stat(backup + ".gz"); !os.IsNotExist(err) {
+		t.Error("compressed backup older than MaxAge should be removed")
+	}
+}
+
+func TestLogFileRotateCompress(t *testing.T) {
+	lf := newTestLogFile(t, ROTATE_DAILY)
+	lf.SetRotation(ROTATE_DAILY, 0, 0, true)
+	lf.Flush([]byte("yesterday\n"))
+
+	yesterday := time.Now().Local().AddDate(0, 0, -1)
+	lf.PeriodStart = yesterday
+	lf.SinceLastCheck = 0
+	lf.Flush([]byte("today\n"))
+
+	waitFile(t, lf.NormalFileName+"."+yesterday.Format("20060102")+".gz")
+	waitFile(t, lf.FatalFileName+"."+yesterday.Format("20060102")+".gz")
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
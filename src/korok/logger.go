@@ -2,9 +2,10 @@ package korok
 
 import (
 	"fmt"
-	"io"
 	"os"
 	"runtime"
+	"runtime/debug"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -16,8 +17,43 @@ const (
 	LOG_EVENT_WARNING = 2
 	LOG_EVENT_INFO    = 3
 	LOG_EVENT_DEBUG   = 4
+
+	// Fatal is logged whatever the level is, then the process exits.
+	LOG_EVENT_FATAL = 5
 )
 
+var levelNames = map[int]string{
+	LOG_EVENT_NOTICE:  "notice",
+	LOG_EVENT_ERROR:   "error",
+	LOG_EVENT_WARNING: "warning",
+	LOG_EVENT_INFO:    "info",
+	LOG_EVENT_DEBUG:   "debug",
+}
+
+// ParseLevel maps notice, error, warning (warn), info and debug to a level.
+func ParseLevel(name string) (int, error) {
+	name = strings.ToLower(name)
+	if name == "warn" {
+		name = "warning"
+	}
+	for level, levelName := range levelNames {
+		if levelName == name {
+			return level, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %q, use debug, info, warning, error or notice", name)
+}
+
+func LevelName(level int) string {
+	if name, ok := levelNames[level]; ok {
+		return name
+	}
+	return fmt.Sprintf("level(%d)", level)
+}
+
+// 测试时替换
+var exit = os.Exit
+
 // LogIdLogger: Add LogId Info to Log Buf.
 //
 func NewLogIdLogger() *LogIdLogger {
@@ -51,9 +87,10 @@ type CallerLogger struct {
 	depth int
 }
 
-func (cl *CallerLogger) Handle(stream *Buffer) {
-	// TODO
-	_, file, line, ok := runtime.Caller(cl.depth)
+// Caller must be called at the same stack depth as Handle used to be.
+// pc identifies the callsite for sampling.
+func (cl *CallerLogger) Caller() (uintptr, string, int) {
+	pc, file, line, ok := runtime.Caller(cl.depth)
 	if !ok {
 		file = "???"
 		line = 0
@@ -65,7 +102,10 @@ func (cl *CallerLogger) Handle(stream *Buffer) {
 			break
 		}
 	}
+	return pc, file, line
+}
 
+func (cl *CallerLogger) Handle(stream *Buffer, file string, line int) {
 	stream.AppendByte('[')
 	stream.AppendString(file)
 	stream.AppendByte(':')
@@ -140,7 +180,8 @@ func (tl *TimeLogger) Handle(stream *Buffer) {
 func NewEventLogger() *EventLogger {
 	return &EventLogger{
 		Notice:  []byte("NOTICE: "),
-		Error:   []byte("FATAL: "),
+		Error:   []byte("ERROR: "),
+		Fatal:   []byte("FATAL: "),
 		Warning: []byte("WARNING: "),
 		Info:    []byte("INFO: "),
 		Debug:   []byte("DEBUG: "),
@@ -150,6 +191,7 @@ func NewEventLogger() *EventLogger {
 type EventLogger struct {
 	Notice  []byte
 	Error   []byte
+	Fatal   []byte
 	Warning []byte
 	Info    []byte
 	Debug   []byte
@@ -166,6 +208,8 @@ func (el *EventLogger) Handle(stream *Buffer, logEvent int) {
 		stream.AppendByteSlice(el.Warning)
 	} else if logEvent == LOG_EVENT_DEBUG {
 		stream.AppendByteSlice(el.Debug)
+	} else if logEvent == LOG_EVENT_FATAL {
+		stream.AppendByteSlice(el.Fatal)
 	}
 }
 
@@ -175,13 +219,14 @@ func (el *EventLogger) Handle(stream *Buffer, logEvent int) {
 func NewSuger() *Logger {
 	//return New("Suger", os.Stderr, 3)
 	log := &Logger{
-		out:           os.Stderr,
+		conf:          NewLogConf(),
 		callerSkip:    3,
 		svrName:       "Suger",
 		level:         3,
 		LogStreamPool: NewBufPoolWithSize(100),
 	}
 	log.InitHandler()
+	log.ConfigureSinks([]*SinkConf{NewSinkConf(SINK_STDERR)})
 	return log
 }
 
@@ -190,15 +235,27 @@ func NewMario() *Logger {
 	return NewLogger(conf)
 }
 
+// NewLogger writes to conf.Sinks, or only to the log files if it is empty.
 func NewLogger(conf *LogConf) *Logger {
 	log := &Logger{
-		out:           NewAsyncLogging(conf),
+		conf:          conf,
 		callerSkip:    conf.CallerSkip,
 		svrName:       conf.Name,
-		level:         conf.Level,
+		level:         int32(conf.Level),
 		LogStreamPool: NewBufPoolWithSize(100),
 	}
 	log.InitHandler()
+	if err := log.SetFormat(conf.Format); err != nil {
+		panic(err)
+	}
+
+	sinks := conf.Sinks
+	if len(sinks) == 0 {
+		sinks = []*SinkConf{NewSinkConf(SINK_FILE)}
+	}
+	if err := log.ConfigureSinks(sinks); err != nil {
+		panic(err)
+	}
 	return log
 }
 
@@ -208,13 +265,27 @@ type Logger struct {
 	svrNameEntry *SvrNameLogger
 	callerEntry  *CallerLogger
 	logidEntry   *LogIdLogger
+	fieldEntry   *FieldLogger
+	jsonEntry    *JsonLogger
+
+	// 1: LOG_FORMAT_JSON, 0: LOG_FORMAT_TEXT
+	jsonFormat int32
 
-	out        io.Writer
+	conf       *LogConf
 	callerSkip int
 	svrName    string
-	level      int
+	level      int32
 
-	mu sync.Mutex
+	// []*sinkEntry, 替换时整体替换
+	sinks atomic.Value
+
+	// *Sampler, nil时不采样
+	sampler atomic.Value
+
+	// ConfigureSinks时复用已打开的文件和内存日志
+	mu       sync.Mutex
+	fileSink *FileSink
+	ring     *RingSink
 
 	LogStreamPool *FixedSizeBufPool
 }
@@ -226,31 +297,252 @@ func (l *Logger) InitHandler() {
 	l.svrNameEntry = NewSvrNameLogger(l.svrName)
 	l.callerEntry = NewCallerLogger(l.callerSkip)
 	l.logidEntry = NewLogIdLogger()
+	l.fieldEntry = NewFieldLogger()
+	l.jsonEntry = NewJsonLogger(l.svrName)
+}
+
+// SetFormat switches between LOG_FORMAT_TEXT and LOG_FORMAT_JSON, "" means text.
+func (l *Logger) SetFormat(format string) error {
+	if format == "" {
+		format = LOG_FORMAT_TEXT
+	}
+	if err := checkFormat(format); err != nil {
+		return err
+	}
+
+	var jsonFormat int32
+	if format == LOG_FORMAT_JSON {
+		jsonFormat = 1
+	}
+	atomic.StoreInt32(&l.jsonFormat, jsonFormat)
+	return nil
+}
+
+// complete drops the line if its callsite is sampled out, then writes it.
+func (l *Logger) complete(logid uint32, logEvent int, context string, fields []interface{}) {
+	pc, file, line := l.callerEntry.Caller()
+
+	if sampler := l.loadSampler(); sampler != nil {
+		ok, summary := sampler.allow(pc, file, line, logid, logEvent, context, fields)
+		if summary != nil {
+			l.writeSummary(summary)
+		}
+		if !ok {
+			return
+		}
+	}
+	l.write(logid, logEvent, file, line, context, fields)
+}
+
+// write encodes the line once per format used by the sinks, and writes it
+// to every sink accepting logEvent.
+func (l *Logger) write(logid uint32, logEvent int, file string, line int, context string, fields []interface{}) {
+	var text, json *Buffer
+	for _, entry := range l.loadSinks() {
+		if !entry.enabled(logEvent) {
+			continue
+		}
+
+		var stream *Buffer
+		if l.isJson(entry.format) {
+			if json == nil {
+				json = l.LogStreamPool.Get()
+				l.jsonEntry.Handle(json, logEvent, logid, file, line, context, fields)
+				json.AppendByte('\n')
+			}
+			stream = json
+		} else {
+			if text == nil {
+				text = l.LogStreamPool.Get()
+				l.encodeText(text, logid, logEvent, file, line, context, fields)
+			}
+			stream = text
+		}
+		entry.sink.Write(logEvent, stream.Bytes())
+	}
+
+	if text != nil {
+		l.LogStreamPool.Free(text)
+	}
+	if json != nil {
+		l.LogStreamPool.Free(json)
+	}
 }
 
-func (l *Logger) complete(logid uint32, logEvent int, context string) *Buffer {
-	stream := l.LogStreamPool.Get()
+func (l *Logger) isJson(format string) bool {
+	if format == "" {
+		return atomic.LoadInt32(&l.jsonFormat) == 1
+	}
+	return format == LOG_FORMAT_JSON
+}
 
+func (l *Logger) encodeText(stream *Buffer, logid uint32, logEvent int, file string, line int, context string, fields []interface{}) {
 	l.eventEntry.Handle(stream, logEvent)
 	l.timeEntry.Handle(stream)
 	l.svrNameEntry.Handle(stream)
-	l.callerEntry.Handle(stream)
-	//l.logidEntry.Handle(stream, logid)
+	l.callerEntry.Handle(stream, file, line)
+	if logid != 0 {
+		l.logidEntry.Handle(stream, logid)
+	}
 
 	stream.AppendString(context)
+	l.fieldEntry.Handle(stream, fields)
 	stream.AppendByte('\n')
+}
+
+func (l *Logger) loadSampler() *Sampler {
+	sampler, _ := l.sampler.Load().(*Sampler)
+	return sampler
+}
+
+// 汇总行输出到原来的调用点
+func (l *Logger) writeSummary(summary *sampleSummary) {
+	l.write(summary.logid, summary.logEvent, summary.file, summary.line, summary.message(), summary.fields)
+}
+
+// SetSampling rate-limits the lines of every callsite, nil or conf.First <= 0
+// turns sampling off. The old sampler writes its pending summaries, it is
+// kept if conf does not change.
+func (l *Logger) SetSampling(conf *SampleConf) {
+	if conf != nil && conf.First <= 0 {
+		conf = nil
+	}
+
+	l.mu.Lock()
+	old := l.loadSampler()
+	if old != nil && conf != nil && old.conf == *conf {
+		l.mu.Unlock()
+		return
+	}
+	var sampler *Sampler
+	if conf != nil {
+		sampler = NewSampler(conf, l.writeSummary)
+		// 计数延续, 作为指标时不会减少
+		if old != nil {
+			sampler.suppressed = old.Suppressed()
+		}
+	}
+	l.sampler.Store(sampler)
+	l.mu.Unlock()
+
+	if old != nil {
+		old.Stop()
+	}
+}
+
+// Sampled returns how many lines the current sampler dropped.
+func (l *Logger) Sampled() uint64 {
+	if sampler := l.loadSampler(); sampler != nil {
+		return sampler.Suppressed()
+	}
+	return 0
+}
 
-	return stream
+func (l *Logger) loadSinks() []*sinkEntry {
+	sinks, _ := l.sinks.Load().([]*sinkEntry)
+	return sinks
+}
+
+// ConfigureSinks replaces the sinks of the logger. The log files and the ring
+// buffer already opened are reused, other removed sinks are stopped.
+func (l *Logger) ConfigureSinks(confs []*SinkConf) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var entries []*sinkEntry
+	var created []Sink
+	fail := func(err error) error {
+		for _, sink := range created {
+			sink.Stop()
+		}
+		return err
+	}
+
+	fileSink, ring := l.fileSink, l.ring
+	for _, conf := range confs {
+		if conf.Format != "" {
+			if err := checkFormat(conf.Format); err != nil {
+				return fail(err)
+			}
+		}
+
+		var sink Sink
+		switch conf.Type {
+		case SINK_FILE:
+			if fileSink == nil {
+				fileSink = NewFileSink(l.conf)
+				created = append(created, fileSink)
+			}
+			sink = fileSink
+		case SINK_STDERR:
+			sink = NewStderrSink()
+		case SINK_SYSLOG:
+			syslog, err := NewSyslogSink(conf.Address, conf.Tag)
+			if err != nil {
+				return fail(err)
+			}
+			created = append(created, syslog)
+			sink = syslog
+		case SINK_RING:
+			if ring == nil {
+				ring = NewRingSink(conf.Size)
+			}
+			sink = ring
+		default:
+			return fail(fmt.Errorf("unknown log sink %q", conf.Type))
+		}
+		entries = append(entries, &sinkEntry{sink: sink, level: conf.Level, format: conf.Format})
+	}
+
+	old := l.loadSinks()
+	l.sinks.Store(entries)
+
+	used := make(map[Sink]bool)
+	for _, entry := range entries {
+		used[entry.sink] = true
+	}
+	for _, entry := range old {
+		if !used[entry.sink] {
+			used[entry.sink] = true
+			entry.sink.Stop()
+		}
+	}
+
+	if fileSink != nil && !used[fileSink] {
+		fileSink = nil
+	}
+	l.fileSink = fileSink
+	l.ring = ring
+	return nil
+}
+
+// Ring returns the in-memory sink, nil if not configured.
+func (l *Logger) Ring() *RingSink {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.ring
+}
+
+// SetLevel changes the level at runtime, lines above level are dropped.
+func (l *Logger) SetLevel(level int) {
+	atomic.StoreInt32(&l.level, int32(level))
+}
+
+func (l *Logger) Level() int {
+	return int(atomic.LoadInt32(&l.level))
 }
 
 func (l *Logger) LogWithEvent(event int, logid uint32, content string) {
-	logBuffer := l.complete(logid, event, content)
-	l.out.Write(logBuffer.Bytes())
-	l.LogStreamPool.Free(logBuffer)
+	l.complete(logid, event, content, nil)
+}
+
+// LogWithFields logs msg followed by keysAndValues, pairs like "coin", "ada".
+func (l *Logger) LogWithFields(event int, logid uint32, msg string, keysAndValues []interface{}) {
+	l.complete(logid, event, msg, keysAndValues)
 }
 
 func (l *Logger) Debug(logid uint32, msg string, v ...interface{}) {
-	if l.level < LOG_EVENT_DEBUG {
+	if l.Level() < LOG_EVENT_DEBUG {
 		return
 	}
 
@@ -258,7 +550,7 @@ func (l *Logger) Debug(logid uint32, msg string, v ...interface{}) {
 }
 
 func (l *Logger) Notice(logid uint32, msg string, v ...interface{}) {
-	if l.level < LOG_EVENT_NOTICE {
+	if l.Level() < LOG_EVENT_NOTICE {
 		return
 	}
 
@@ -266,7 +558,7 @@ func (l *Logger) Notice(logid uint32, msg string, v ...interface{}) {
 }
 
 func (l *Logger) Info(logid uint32, msg string, v ...interface{}) {
-	if l.level < LOG_EVENT_INFO {
+	if l.Level() < LOG_EVENT_INFO {
 		return
 	}
 
@@ -274,28 +566,160 @@ func (l *Logger) Info(logid uint32, msg string, v ...interface{}) {
 }
 
 func (l *Logger) Warn(logid uint32, msg string, v ...interface{}) {
-	if l.level < LOG_EVENT_WARNING {
+	if l.Level() < LOG_EVENT_WARNING {
 		return
 	}
 
 	l.LogWithEvent(LOG_EVENT_WARNING, logid, fmt.Sprintf(msg, v...))
 }
 
+func (l *Logger) Error(logid uint32, msg string, v ...interface{}) {
+	if l.Level() < LOG_EVENT_ERROR {
+		return
+	}
+
+	l.LogWithEvent(LOG_EVENT_ERROR, logid, fmt.Sprintf(msg, v...))
+}
+
+// Fatal logs, flushes and exits the process with code 1.
 func (l *Logger) Fatal(logid uint32, msg string, v ...interface{}) {
-	if l.level < LOG_EVENT_ERROR {
+	l.LogWithEvent(LOG_EVENT_FATAL, logid, fmt.Sprintf(msg, v...))
+	l.Stop()
+	exit(1)
+}
+
+func (l *Logger) Debugw(logid uint32, msg string, keysAndValues ...interface{}) {
+	if l.Level() < LOG_EVENT_DEBUG {
+		return
+	}
+
+	l.LogWithFields(LOG_EVENT_DEBUG, logid, msg, keysAndValues)
+}
+
+func (l *Logger) Noticew(logid uint32, msg string, keysAndValues ...interface{}) {
+	if l.Level() < LOG_EVENT_NOTICE {
 		return
 	}
 
-	logBuffer := l.complete(logid, LOG_EVENT_ERROR, fmt.Sprintf(msg, v...))
-	l.out.Write(logBuffer.Bytes())
-	if alog, ok := l.out.(AsyncWriter); ok {
-		alog.WriteFatal(logBuffer.Bytes())
+	l.LogWithFields(LOG_EVENT_NOTICE, logid, msg, keysAndValues)
+}
+
+func (l *Logger) Infow(logid uint32, msg string, keysAndValues ...interface{}) {
+	if l.Level() < LOG_EVENT_INFO {
+		return
 	}
-	l.LogStreamPool.Free(logBuffer)
+
+	l.LogWithFields(LOG_EVENT_INFO, logid, msg, keysAndValues)
+}
+
+func (l *Logger) Warnw(logid uint32, msg string, keysAndValues ...interface{}) {
+	if l.Level() < LOG_EVENT_WARNING {
+		return
+	}
+
+	l.LogWithFields(LOG_EVENT_WARNING, logid, msg, keysAndValues)
 }
 
+func (l *Logger) Errorw(logid uint32, msg string, keysAndValues ...interface{}) {
+	if l.Level() < LOG_EVENT_ERROR {
+		return
+	}
+
+	l.LogWithFields(LOG_EVENT_ERROR, logid, msg, keysAndValues)
+}
+
+func (l *Logger) Fatalw(logid uint32, msg string, keysAndValues ...interface{}) {
+	l.LogWithFields(LOG_EVENT_FATAL, logid, msg, keysAndValues)
+	l.Stop()
+	exit(1)
+}
+
+// SetRotation changes how the log files are rotated and how many backups are
+// kept, maxAge in hours, 0 means no limit. Without a file sink the settings
+// are kept for the log files opened later by ConfigureSinks.
+func (l *Logger) SetRotation(rotate string, maxBackups int, maxAge int, compress bool) error {
+	if rotate != "" {
+		if err := checkRotate(rotate); err != nil {
+			return err
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.conf.SetRotate(rotate)
+	l.conf.SetMaxBackups(maxBackups)
+	l.conf.SetMaxAge(maxAge)
+	l.conf.SetCompress(compress)
+	if l.fileSink == nil {
+		return nil
+	}
+	return l.fileSink.Async.LogFile.SetRotation(rotate, maxBackups, time.Duration(maxAge)*time.Hour, compress)
+}
+
+// SetPolicy sets what the log files do when lines pile up, ASYNC_BLOCK or
+// ASYNC_DROP.
+func (l *Logger) SetPolicy(policy string) error {
+	if policy != "" {
+		if err := checkPolicy(policy); err != nil {
+			return err
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.conf.SetPolicy(policy)
+	if l.fileSink == nil {
+		return nil
+	}
+	return l.fileSink.Async.SetPolicy(policy)
+}
+
+// Dropped returns the lines and bytes dropped by the log files.
+func (l *Logger) Dropped() (lines uint64, bytes uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.fileSink == nil {
+		return 0, 0
+	}
+	return l.fileSink.Async.Dropped()
+}
+
+// Sync writes out the lines buffered by every sink.
+func (l *Logger) Sync() error {
+	var firstErr error
+	for _, entry := range l.loadSinks() {
+		if err := entry.sink.Sync(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Stop flushes and stops every sink, later lines are written synchronously
+// to the log files.
 func (l *Logger) Stop() {
-	if alog, ok := l.out.(AsyncWriter); ok {
-		alog.Stop()
+	if sampler := l.loadSampler(); sampler != nil {
+		sampler.Stop()
+	}
+	for _, entry := range l.loadSinks() {
+		entry.sink.Stop()
+	}
+}
+
+// FlushOnPanic logs a recovered panic with its stack, stops the sinks so no
+// line is lost, and panics again. Defer it first thing in every goroutine.
+func (l *Logger) FlushOnPanic() {
+	// recover只在被defer的函数中直接调用时生效
+	if r := recover(); r != nil {
+		l.panicked(r)
 	}
 }
+
+func (l *Logger) panicked(r interface{}) {
+	l.LogWithEvent(LOG_EVENT_FATAL, 0, fmt.Sprintf("panic: %v\n%s", r, debug.Stack()))
+	l.Stop()
+	panic(r)
+}
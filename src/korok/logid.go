@@ -0,0 +1,36 @@
+package korok
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+type logIDKey struct{}
+
+// 进程内递增, 以启动时间为起点, 重启后不容易与之前的ID重复
+var lastLogID = uint32(time.Now().UnixNano())
+
+// NewLogID returns a new non-zero log ID.
+func NewLogID() uint32 {
+	for {
+		if id := atomic.AddUint32(&lastLogID, 1); id != 0 {
+			return id
+		}
+	}
+}
+
+// WithLogID returns a context carrying logid, lines logged with it are
+// prefixed by [logid N].
+func WithLogID(ctx context.Context, logid uint32) context.Context {
+	return context.WithValue(ctx, logIDKey{}, logid)
+}
+
+// LogIDFromContext returns the log ID of ctx, or 0 if none.
+func LogIDFromContext(ctx context.Context) uint32 {
+	if ctx == nil {
+		return 0
+	}
+	logid, _ := ctx.Value(logIDKey{}).(uint32)
+	return logid
+}
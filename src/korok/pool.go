@@ -37,6 +37,10 @@ func (b *Buffer) AppendUint(i uint64) {
 	b.bs = strconv.AppendUint(b.bs, i, 10)
 }
 
+func (b *Buffer) AppendFloat(f float64) {
+	b.bs = strconv.AppendFloat(b.bs, f, 'f', -1, 64)
+}
+
 func (b *Buffer) Bytes() []byte {
 	return b.bs
 }
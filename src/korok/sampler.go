@@ -0,0 +1,197 @@
+package korok
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	SAMPLE_WINDOW        = 60 //s, 每个调用点按分钟计数
+	SAMPLE_CHECK_FREQ    = 10 //s, 检查窗口结束的间隔
+	DEFAULT_SAMPLE_FIRST = 10
+)
+
+// 采样配置, 交易所故障时同一行日志每500ms一条, 按调用点限流
+type SampleConf struct {
+	First      int // 每个调用点每分钟完整输出的行数, <=0时不采样
+	Thereafter int // 超过First后每Thereafter行输出一行, 0只计数
+	Level      int // 只采样不高于Level的日志, Fatal从不采样
+}
+
+func NewSampleConf() *SampleConf {
+	return &SampleConf{
+		First: DEFAULT_SAMPLE_FIRST,
+		Level: LOG_EVENT_WARNING,
+	}
+}
+
+// 一个调用点在当前窗口的计数
+type callsite struct {
+	file  string
+	line  int
+	start time.Time
+	count int
+
+	// 被丢弃的行数和最后一行, 窗口结束时汇总输出
+	suppressed int
+	logid      uint32
+	logEvent   int
+	context    string
+	fields     []interface{}
+}
+
+// 窗口结束时输出的汇总行
+type sampleSummary struct {
+	file     string
+	line     int
+	logid    uint32
+	logEvent int
+	context  string
+	fields   []interface{}
+	repeated int
+}
+
+// Sampler: Rate-limit Log Lines per Callsite.
+//
+func NewSampler(conf *SampleConf, emit func(*sampleSummary)) *Sampler {
+	s := &Sampler{
+		conf:        *conf,
+		emit:        emit,
+		sites:       make(map[uintptr]*callsite),
+		stopChannel: make(chan struct{}),
+		now:         time.Now,
+	}
+	go s.run()
+	return s
+}
+
+type Sampler struct {
+	conf SampleConf
+	emit func(*sampleSummary)
+
+	mu    sync.Mutex
+	sites map[uintptr]*callsite
+
+	suppressed  uint64
+	stopChannel chan struct{}
+	stopOnce    sync.Once
+
+	// 当前时间, 测试时替换
+	now func() time.Time
+}
+
+// allow returns whether the line is written, and the summary of the last
+// window of the callsite if it just ended.
+func (s *Sampler) allow(pc uintptr, file string, line int, logid uint32, logEvent int, context string, fields []interface{}) (bool, *sampleSummary) {
+	if logEvent == LOG_EVENT_FATAL || logEvent > s.conf.Level {
+		return true, nil
+	}
+
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var summary *sampleSummary
+	site, ok := s.sites[pc]
+	if !ok {
+		site = &callsite{file: file, line: line, start: now}
+		s.sites[pc] = site
+	} else if now.Sub(site.start) >= time.Duration(SAMPLE_WINDOW)*time.Second {
+		summary = site.reset(now)
+	}
+
+	site.count++
+	if site.count <= s.conf.First {
+		return true, summary
+	}
+	if s.conf.Thereafter > 0 && (site.count-s.conf.First)%s.conf.Thereafter == 0 {
+		return true, summary
+	}
+
+	site.suppressed++
+	site.logid = logid
+	site.logEvent = logEvent
+	site.context = context
+	site.fields = fields
+	atomic.AddUint64(&s.suppressed, 1)
+	return false, summary
+}
+
+// 开始新窗口, 返回上个窗口的汇总, 没有丢弃时返回nil
+func (site *callsite) reset(now time.Time) *sampleSummary {
+	var summary *sampleSummary
+	if site.suppressed != 0 {
+		summary = &sampleSummary{
+			file:     site.file,
+			line:     site.line,
+			logid:    site.logid,
+			logEvent: site.logEvent,
+			context:  site.context,
+			fields:   site.fields,
+			repeated: site.suppressed,
+		}
+	}
+
+	site.start = now
+	site.count = 0
+	site.suppressed = 0
+	site.context = ""
+	site.fields = nil
+	return summary
+}
+
+// 汇总已结束的窗口, 清理不再输出的调用点, all时汇总所有窗口
+func (s *Sampler) expire(all bool) []*sampleSummary {
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var summaries []*sampleSummary
+	for pc, site := range s.sites {
+		if !all && now.Sub(site.start) < time.Duration(SAMPLE_WINDOW)*time.Second {
+			continue
+		}
+		if summary := site.reset(now); summary != nil {
+			summaries = append(summaries, summary)
+		} else {
+			delete(s.sites, pc)
+		}
+	}
+	return summaries
+}
+
+func (s *Sampler) run() {
+	clocker := time.NewTicker(time.Duration(SAMPLE_CHECK_FREQ) * time.Second)
+	defer clocker.Stop()
+	for {
+		select {
+		case <-clocker.C:
+			for _, summary := range s.expire(false) {
+				s.emit(summary)
+			}
+		case <-s.stopChannel:
+			return
+		}
+	}
+}
+
+// Suppressed returns how many lines were dropped by sampling.
+func (s *Sampler) Suppressed() uint64 {
+	return atomic.LoadUint64(&s.suppressed)
+}
+
+// Stop writes the summaries of the unfinished windows.
+func (s *Sampler) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stopChannel)
+		for _, summary := range s.expire(true) {
+			s.emit(summary)
+		}
+	})
+}
+
+func (summary *sampleSummary) message() string {
+	return fmt.Sprintf("%s (message repeated %d times in last minute)", summary.context, summary.repeated)
+}
@@ -0,0 +1,170 @@
+package korok
+
+import (
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.t
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+// 不启动后台goroutine的Sampler, 窗口结束由测试调用expire
+func newTestSampler(conf *SampleConf) (*Sampler, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2026, 10, 19, 8, 30, 0, 0, time.Local)}
+	return &Sampler{
+		conf:        *conf,
+		emit:        func(*sampleSummary) {},
+		sites:       make(map[uintptr]*callsite),
+		stopChannel: make(chan struct{}),
+		now:         clock.now,
+	}, clock
+}
+
+// 同一调用点写n行, 返回输出的行号(从1开始)和最后一个汇总
+func logLines(s *Sampler, pc uintptr, n int) (allowed []int, summary *sampleSummary) {
+	for i := 1; i <= n; i++ {
+		ok, sum := s.allow(pc, "coin_info.go", int(pc), uint32(i), LOG_EVENT_ERROR, "renew failed", []interface{}{"n", i})
+		if ok {
+			allowed = append(allowed, i)
+		}
+		if sum != nil {
+			summary = sum
+		}
+	}
+	return allowed, summary
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSamplerFirstThereafter(t *testing.T) {
+	cases := []struct {
+		first      int
+		thereafter int
+		want       []int
+	}{
+		{3, 0, []int{1, 2, 3}},
+		{3, 4, []int{1, 2, 3, 7, 11}},
+		{0, 5, []int{5, 10}},
+	}
+	for _, c := range cases {
+		s, _ := newTestSampler(&SampleConf{First: c.first, Thereafter: c.thereafter, Level: LOG_EVENT_WARNING})
+		allowed, summary := logLines(s, 1, 12)
+		if !equalInts(allowed, c.want) {
+			t.Errorf("First %d Thereafter %d: allowed %v, want %v", c.first, c.thereafter, allowed, c.want)
+		}
+		if summary != nil {
+			t.Errorf("summary %+v before the window ends", summary)
+		}
+		if s.Suppressed() != uint64(12-len(c.want)) {
+			t.Errorf("suppressed %d, want %d", s.Suppressed(), 12-len(c.want))
+		}
+	}
+}
+
+func TestSamplerPerCallsite(t *testing.T) {
+	s, _ := newTestSampler(&SampleConf{First: 2, Level: LOG_EVENT_WARNING})
+
+	// 调用点之间各自计数
+	if allowed, _ := logLines(s, 1, 5); !equalInts(allowed, []int{1, 2}) {
+		t.Errorf("callsite 1 allowed %v", allowed)
+	}
+	if allowed, _ := logLines(s, 2, 5); !equalInts(allowed, []int{1, 2}) {
+		t.Errorf("callsite 2 allowed %v", allowed)
+	}
+
+	// 高于Level的日志和Fatal不采样
+	for i := 0; i < 5; i++ {
+		if ok, _ := s.allow(3, "main.go", 3, 0, LOG_EVENT_INFO, "info", nil); !ok {
+			t.Fatal("INFO is above the sample level and should not be sampled")
+		}
+		if ok, _ := s.allow(4, "main.go", 4, 0, LOG_EVENT_FATAL, "fatal", nil); !ok {
+			t.Fatal("FATAL should never be sampled")
+		}
+	}
+	if s.Suppressed() != 6 {
+		t.Errorf("suppressed %d, want 6", s.Suppressed())
+	}
+}
+
+func TestSamplerWindowSummary(t *testing.T) {
+	s, clock := newTestSampler(&SampleConf{First: 2, Level: LOG_EVENT_WARNING})
+	logLines(s, 1, 5)
+
+	// 窗口内不汇总
+	clock.advance(time.Duration(SAMPLE_WINDOW)*time.Second - time.Second)
+	if summaries := s.expire(false); len(summaries) != 0 {
+		t.Errorf("summaries %v before the window ends", summaries)
+	}
+
+	// 下一个窗口的第一行带上个窗口的汇总, 计数重新开始
+	clock.advance(time.Second)
+	allowed, summary := logLines(s, 1, 3)
+	if !equalInts(allowed, []int{1, 2}) {
+		t.Errorf("allowed %v in the new window", allowed)
+	}
+	if summary == nil || summary.repeated != 3 || summary.logid != 5 || summary.file != "coin_info.go" || summary.line != 1 {
+		t.Fatalf("summary %+v, want 3 repeated with the last logid 5", summary)
+	}
+	if msg := summary.message(); msg != "renew failed (message repeated 3 times in last minute)" {
+		t.Errorf("message %q", msg)
+	}
+}
+
+func TestSamplerExpire(t *testing.T) {
+	s, clock := newTestSampler(&SampleConf{First: 1, Level: LOG_EVENT_WARNING})
+	logLines(s, 1, 4) // 丢弃3行
+	logLines(s, 2, 1) // 没有丢弃
+
+	clock.advance(time.Duration(SAMPLE_WINDOW) * time.Second)
+	summaries := s.expire(false)
+	if len(summaries) != 1 || summaries[0].line != 1 || summaries[0].repeated != 3 {
+		t.Fatalf("summaries %+v, want only callsite 1", summaries)
+	}
+	// 没有丢弃的调用点被清理, 有丢弃的开始新窗口
+	if _, ok := s.sites[2]; ok {
+		t.Error("idle callsite 2 not removed")
+	}
+	if site, ok := s.sites[1]; !ok || site.suppressed != 0 || !site.start.Equal(clock.now()) {
+		t.Errorf("callsite 1 after expire %+v", site)
+	}
+
+	// 汇总过的窗口在下次检查时没有新的丢弃, 也被清理
+	clock.advance(time.Duration(SAMPLE_WINDOW) * time.Second)
+	if summaries := s.expire(false); len(summaries) != 0 || len(s.sites) != 0 {
+		t.Errorf("summaries %v sites %d", summaries, len(s.sites))
+	}
+}
+
+func TestSamplerStop(t *testing.T) {
+	var emitted []*sampleSummary
+	s := NewSampler(&SampleConf{First: 1, Level: LOG_EVENT_WARNING}, func(summary *sampleSummary) {
+		emitted = append(emitted, summary)
+	})
+	logLines(s, 1, 3)
+
+	// 停止时输出未结束窗口的汇总
+	s.Stop()
+	s.Stop()
+	if len(emitted) != 1 || emitted[0].repeated != 2 {
+		t.Errorf("emitted %+v, want one summary with 2 repeated", emitted)
+	}
+}
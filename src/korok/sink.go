@@ -0,0 +1,270 @@
+package korok
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	SINK_FILE   = "file"
+	SINK_STDERR = "stderr"
+	SINK_SYSLOG = "syslog"
+	SINK_RING   = "ring"
+)
+
+const (
+	DEFAULT_RING_SIZE  = 1000
+	DEFAULT_SYSLOG_TAG = "shannon"
+)
+
+// Sink: Log BackEnd, Receives Encoded Lines.
+//
+type Sink interface {
+	Write(logEvent int, line []byte) error
+	Sync() error // 缓冲的日志写出后返回
+	Stop()
+}
+
+// 一个输出目标的配置
+type SinkConf struct {
+	Type   string // SINK_FILE, SINK_STDERR, SINK_SYSLOG, SINK_RING
+	Level  int    // 高于Level的日志不输出到这个目标, Logger的Level对所有目标生效
+	Format string // 为空时跟随Logger的格式
+
+	Address string // syslog: 本地socket路径, 为空时自动查找
+	Tag     string // syslog: 程序名
+	Size    int    // ring: 保留的行数
+}
+
+func NewSinkConf(sinkType string) *SinkConf {
+	return &SinkConf{
+		Type:  sinkType,
+		Level: LOG_EVENT_DEBUG,
+	}
+}
+
+type sinkEntry struct {
+	sink   Sink
+	level  int
+	format string
+}
+
+func (se *sinkEntry) enabled(logEvent int) bool {
+	return logEvent == LOG_EVENT_FATAL || logEvent <= se.level
+}
+
+// FileSink: Write to Log File Asynchronously, Errors also go to the .wf File.
+//
+func NewFileSink(conf *LogConf) *FileSink {
+	return &FileSink{
+		Async: NewAsyncLogging(conf),
+	}
+}
+
+type FileSink struct {
+	Async *AsyncLogging
+}
+
+func (fs *FileSink) Write(logEvent int, line []byte) error {
+	_, err := fs.Async.Write(line)
+	if logEvent == LOG_EVENT_ERROR || logEvent == LOG_EVENT_FATAL {
+		fs.Async.WriteFatal(line)
+	}
+	return err
+}
+
+func (fs *FileSink) Sync() error {
+	return fs.Async.Sync()
+}
+
+func (fs *FileSink) Stop() {
+	fs.Async.Stop()
+}
+
+// StderrSink: Write to os.Stderr Synchronously.
+//
+func NewStderrSink() *StderrSink {
+	return &StderrSink{}
+}
+
+type StderrSink struct {
+	mu sync.Mutex
+}
+
+func (ss *StderrSink) Write(logEvent int, line []byte) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	_, err := os.Stderr.Write(line)
+	return err
+}
+
+func (ss *StderrSink) Sync() error {
+	return nil
+}
+
+func (ss *StderrSink) Stop() {
+}
+
+// SyslogSink: Send to Local Syslog Daemon, One Datagram per Line.
+//
+func NewSyslogSink(address string, tag string) (*SyslogSink, error) {
+	if tag == "" {
+		tag = DEFAULT_SYSLOG_TAG
+	}
+	ss := &SyslogSink{
+		address: address,
+		tag:     tag,
+		pid:     os.Getpid(),
+	}
+	if err := ss.connect(); err != nil {
+		return nil, err
+	}
+	return ss, nil
+}
+
+type SyslogSink struct {
+	mu sync.Mutex
+
+	address string
+	tag     string
+	pid     int
+	conn    net.Conn
+}
+
+var syslogAddresses = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+func (ss *SyslogSink) connect() error {
+	addresses := syslogAddresses
+	if ss.address != "" {
+		addresses = []string{ss.address}
+	}
+
+	var lastErr error
+	for _, address := range addresses {
+		for _, network := range []string{"unixgram", "unix"} {
+			conn, err := net.Dial(network, address)
+			if err == nil {
+				ss.conn = conn
+				return nil
+			}
+			lastErr = err
+		}
+	}
+	return fmt.Errorf("connect syslog failed: %s", lastErr)
+}
+
+// facility user, 按日志级别对应severity
+func syslogPriority(logEvent int) int {
+	const facilityUser = 1
+	severity := 6
+	switch logEvent {
+	case LOG_EVENT_FATAL:
+		severity = 2
+	case LOG_EVENT_ERROR:
+		severity = 3
+	case LOG_EVENT_WARNING:
+		severity = 4
+	case LOG_EVENT_NOTICE:
+		severity = 5
+	case LOG_EVENT_DEBUG:
+		severity = 7
+	}
+	return facilityUser*8 + severity
+}
+
+func (ss *SyslogSink) Write(logEvent int, line []byte) error {
+	msg := fmt.Sprintf("<%d>%s %s[%d]: %s", syslogPriority(logEvent),
+		time.Now().Format(time.Stamp), ss.tag, ss.pid, strings.TrimRight(string(line), "\n"))
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	// syslog重启后连接失效, 重连一次
+	for i := 0; i < 2; i++ {
+		if ss.conn == nil {
+			if err := ss.connect(); err != nil {
+				return err
+			}
+		}
+		_, err := ss.conn.Write([]byte(msg))
+		if err == nil {
+			return nil
+		}
+		ss.conn.Close()
+		ss.conn = nil
+		if i == 1 {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ss *SyslogSink) Sync() error {
+	return nil
+}
+
+func (ss *SyslogSink) Stop() {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if ss.conn != nil {
+		ss.conn.Close()
+		ss.conn = nil
+	}
+}
+
+// RingSink: Keep the Last Lines in Memory, for Admin API.
+//
+func NewRingSink(size int) *RingSink {
+	if size <= 0 {
+		size = DEFAULT_RING_SIZE
+	}
+	return &RingSink{
+		lines: make([]string, size),
+	}
+}
+
+type RingSink struct {
+	mu    sync.Mutex
+	lines []string
+	next  int
+	full  bool
+}
+
+func (rs *RingSink) Write(logEvent int, line []byte) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	rs.lines[rs.next] = strings.TrimRight(string(line), "\n")
+	rs.next = (rs.next + 1) % len(rs.lines)
+	if rs.next == 0 {
+		rs.full = true
+	}
+	return nil
+}
+
+// Lines returns the last n lines, oldest first, n <= 0 means all.
+func (rs *RingSink) Lines(n int) []string {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	var res []string
+	if rs.full {
+		res = append(res, rs.lines[rs.next:]...)
+	}
+	res = append(res, rs.lines[:rs.next]...)
+	if n > 0 && n < len(res) {
+		res = res[len(res)-n:]
+	}
+	return res
+}
+
+func (rs *RingSink) Sync() error {
+	return nil
+}
+
+func (rs *RingSink) Stop() {
+}
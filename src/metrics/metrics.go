@@ -0,0 +1,404 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 指标类型, 按Prometheus文本格式输出
+const (
+	TYPE_COUNTER   = "counter"
+	TYPE_GAUGE     = "gauge"
+	TYPE_HISTOGRAM = "histogram"
+
+	CONTENT_TYPE = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+// 接口耗时的默认分桶, 单位秒
+var DEFAULT_BUCKETS = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+var (
+	familiesMu sync.Mutex
+	families   = make(map[string]family)
+)
+
+type family interface {
+	write(w *bufio.Writer)
+}
+
+// 注册指标, 重名时panic, 只在初始化时调用
+func register(name string, f family) {
+	familiesMu.Lock()
+	defer familiesMu.Unlock()
+	if _, ok := families[name]; ok {
+		panic(fmt.Sprintf("metric %s registered twice", name))
+	}
+	families[name] = f
+}
+
+// 一组同名指标, 按标签值区分
+type vec struct {
+	name   string
+	help   string
+	typ    string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+// 一组标签值对应的数据
+type series struct {
+	values []string
+
+	mu     sync.Mutex
+	value  float64
+	counts []uint64 // histogram: 每个分桶的计数, 不累加
+	sum    float64
+	count  uint64
+}
+
+func newVec(name string, help string, typ string, labels []string) *vec {
+	v := &vec{
+		name:   name,
+		help:   help,
+		typ:    typ,
+		labels: labels,
+		series: make(map[string]*series),
+	}
+	return v
+}
+
+func (v *vec) with(buckets int, values []string) *series {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metric %s wants %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+
+	key := strings.Join(values, "\xff")
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{values: append([]string(nil), values...)}
+		if buckets > 0 {
+			s.counts = make([]uint64, buckets)
+		}
+		v.series[key] = s
+	}
+	return s
+}
+
+// 按标签值排序, 输出稳定
+func (v *vec) sorted() []*series {
+	v.mu.Lock()
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	res := make([]*series, 0, len(keys))
+	for _, key := range keys {
+		res = append(res, v.series[key])
+	}
+	v.mu.Unlock()
+	return res
+}
+
+func (v *vec) writeHeader(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", v.name, escapeHelp(v.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.name, v.typ)
+}
+
+func (v *vec) write(w *bufio.Writer) {
+	v.writeHeader(w)
+	for _, s := range v.sorted() {
+		s.mu.Lock()
+		value := s.value
+		s.mu.Unlock()
+		writeSample(w, v.name, v.labels, s.values, "", value)
+	}
+}
+
+// CounterVec: Counters Partitioned by Labels.
+//
+func NewCounterVec(name string, help string, labels ...string) *CounterVec {
+	v := newVec(name, help, TYPE_COUNTER, labels)
+	register(name, v)
+	return &CounterVec{vec: v}
+}
+
+type CounterVec struct {
+	vec *vec
+}
+
+func (cv *CounterVec) With(values ...string) *Counter {
+	return &Counter{series: cv.vec.with(0, values)}
+}
+
+type Counter struct {
+	series *series
+}
+
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add panics if v < 0, counters only go up.
+func (c *Counter) Add(v float64) {
+	if v < 0 {
+		panic("counter can not decrease")
+	}
+	c.series.mu.Lock()
+	c.series.value += v
+	c.series.mu.Unlock()
+}
+
+// GaugeVec: Gauges Partitioned by Labels.
+//
+func NewGaugeVec(name string, help string, labels ...string) *GaugeVec {
+	v := newVec(name, help, TYPE_GAUGE, labels)
+	register(name, v)
+	return &GaugeVec{vec: v}
+}
+
+type GaugeVec struct {
+	vec *vec
+}
+
+func (gv *GaugeVec) With(values ...string) *Gauge {
+	return &Gauge{series: gv.vec.with(0, values)}
+}
+
+type Gauge struct {
+	series *series
+}
+
+func (g *Gauge) Set(v float64) {
+	g.series.mu.Lock()
+	g.series.value = v
+	g.series.mu.Unlock()
+}
+
+func (g *Gauge) Add(v float64) {
+	g.series.mu.Lock()
+	g.series.value += v
+	g.series.mu.Unlock()
+}
+
+// HistogramVec: Histograms Partitioned by Labels.
+//
+// buckets: 升序的分桶上限, 为空时使用DEFAULT_BUCKETS
+func NewHistogramVec(name string, help string, buckets []float64, labels ...string) *HistogramVec {
+	if len(buckets) == 0 {
+		buckets = DEFAULT_BUCKETS
+	}
+	if !sort.Float64sAreSorted(buckets) {
+		panic(fmt.Sprintf("buckets of metric %s are not sorted", name))
+	}
+	hv := &HistogramVec{
+		vec:     newVec(name, help, TYPE_HISTOGRAM, labels),
+		buckets: buckets,
+	}
+	register(name, hv)
+	return hv
+}
+
+type HistogramVec struct {
+	vec     *vec
+	buckets []float64
+}
+
+func (hv *HistogramVec) With(values ...string) *Histogram {
+	return &Histogram{
+		series:  hv.vec.with(len(hv.buckets), values),
+		buckets: hv.buckets,
+	}
+}
+
+func (hv *HistogramVec) write(w *bufio.Writer) {
+	v := hv.vec
+	v.writeHeader(w)
+	for _, s := range v.sorted() {
+		s.mu.Lock()
+		counts := append([]uint64(nil), s.counts...)
+		sum, count := s.sum, s.count
+		s.mu.Unlock()
+
+		var cumulative uint64
+		for i, bound := range hv.buckets {
+			cumulative += counts[i]
+			writeSample(w, v.name+"_bucket", v.labels, s.values, formatFloat(bound), float64(cumulative))
+		}
+		writeSample(w, v.name+"_bucket", v.labels, s.values, "+Inf", float64(count))
+		writeSample(w, v.name+"_sum", v.labels, s.values, "", sum)
+		writeSample(w, v.name+"_count", v.labels, s.values, "", float64(count))
+	}
+}
+
+type Histogram struct {
+	series  *series
+	buckets []float64
+}
+
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.buckets, v)
+	h.series.mu.Lock()
+	// 大于所有上限的只计入+Inf
+	if i < len(h.buckets) {
+		h.series.counts[i]++
+	}
+	h.series.sum += v
+	h.series.count++
+	h.series.mu.Unlock()
+}
+
+// 读取时才计算的指标, 用于已有的计数
+type funcMetric struct {
+	name string
+	help string
+	typ  string
+	fn   func() float64
+}
+
+func (fm *funcMetric) write(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", fm.name, escapeHelp(fm.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", fm.name, fm.typ)
+	writeSample(w, fm.name, nil, nil, "", fm.fn())
+}
+
+// NewGaugeFunc exposes the value returned by fn as a gauge.
+func NewGaugeFunc(name string, help string, fn func() float64) {
+	register(name, &funcMetric{name: name, help: help, typ: TYPE_GAUGE, fn: fn})
+}
+
+// NewCounterFunc exposes the value returned by fn as a counter, fn must not
+// decrease.
+func NewCounterFunc(name string, help string, fn func() float64) {
+	register(name, &funcMetric{name: name, help: help, typ: TYPE_COUNTER, fn: fn})
+}
+
+// 读取时才计算的一组带标签的指标
+type funcVec struct {
+	name   string
+	help   string
+	typ    string
+	labels []string
+	fn     func() []LabeledValue
+}
+
+// LabeledValue is one series returned by the fn of a func vec.
+type LabeledValue struct {
+	Values []string
+	Value  float64
+}
+
+func (fv *funcVec) write(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", fv.name, escapeHelp(fv.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", fv.name, fv.typ)
+	list := fv.fn()
+	sort.Slice(list, func(i, j int) bool {
+		return strings.Join(list[i].Values, "\xff") < strings.Join(list[j].Values, "\xff")
+	})
+	for _, lv := range list {
+		if len(lv.Values) != len(fv.labels) {
+			continue
+		}
+		writeSample(w, fv.name, fv.labels, lv.Values, "", lv.Value)
+	}
+}
+
+// NewGaugeVecFunc exposes the series returned by fn as gauges.
+func NewGaugeVecFunc(name string, help string, fn func() []LabeledValue, labels ...string) {
+	register(name, &funcVec{name: name, help: help, typ: TYPE_GAUGE, labels: labels, fn: fn})
+}
+
+// NewCounterVecFunc exposes the series returned by fn as counters, values
+// must not decrease.
+func NewCounterVecFunc(name string, help string, fn func() []LabeledValue, labels ...string) {
+	register(name, &funcVec{name: name, help: help, typ: TYPE_COUNTER, labels: labels, fn: fn})
+}
+
+func writeSample(w *bufio.Writer, name string, labels []string, values []string, le string, value float64) {
+	w.WriteString(name)
+	if len(labels) != 0 || le != "" {
+		w.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", label, escapeLabel(values[i]))
+		}
+		if le != "" {
+			if len(labels) != 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "le=\"%s\"", le)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(value))
+	w.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer("\\", `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer("\\", `\\`, "\n", `\n`, "\"", `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+// WriteText writes every registered metric in the Prometheus text format,
+// sorted by name.
+func WriteText(w io.Writer) error {
+	familiesMu.Lock()
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	list := make([]family, 0, len(names))
+	for _, name := range names {
+		list = append(list, families[name])
+	}
+	familiesMu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, f := range list {
+		f.write(bw)
+	}
+	return bw.Flush()
+}
+
+// Handler serves WriteText, mount it on /metrics.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", CONTENT_TYPE)
+		WriteText(w)
+	})
+}
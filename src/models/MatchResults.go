@@ -0,0 +1,22 @@
+package models
+
+type MatchResult struct {
+	ID           int64  `json:"id"`            // 成交记录ID
+	OrderID      int64  `json:"order-id"`      // 订单ID
+	MatchID      int64  `json:"match-id"`      // 撮合ID
+	Symbol       string `json:"symbol"`        // 交易对
+	Type         string `json:"type"`          // 订单类型
+	Source       string `json:"source"`        // 订单来源
+	Price        string `json:"price"`         // 成交价格
+	FilledAmount string `json:"filled-amount"` // 成交数量
+	FilledFees   string `json:"filled-fees"`   // 成交手续费
+	FeeCurrency  string `json:"fee-currency"`  // 手续费币种
+	CreatedAt    int64  `json:"created-at"`    // 成交时间, 单位毫秒
+}
+
+type MatchResultsReturn struct {
+	Status  string        `json:"status"` // 请求状态
+	Data    []MatchResult `json:"data"`   // 成交明细
+	ErrCode string        `json:"err-code"`
+	ErrMsg  string        `json:"err-msg"`
+}
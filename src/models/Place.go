@@ -1,5 +1,7 @@
 package models
 
+import "fmt"
+
 type PlaceRequestParams struct {
 	AccountID string `json:"account-id"` // 账户ID
 	Amount    string `json:"amount"`     // 限价表示下单数量, 市价买单时表示买多少钱, 市价卖单时表示卖多少币
@@ -15,3 +17,13 @@ type PlaceReturn struct {
 	ErrCode string `json:"err-code"`
 	ErrMsg  string `json:"err-msg"`
 }
+
+// 日志中隐藏账户ID
+func (p PlaceRequestParams) String() string {
+	accountID := p.AccountID
+	if len(accountID) > 2 {
+		accountID = "***" + accountID[len(accountID)-2:]
+	}
+	return fmt.Sprintf("{AccountID:%s Amount:%s Price:%s Source:%s Symbol:%s Type:%s}",
+		accountID, p.Amount, p.Price, p.Source, p.Symbol, p.Type)
+}
@@ -0,0 +1,45 @@
+package notify
+
+import (
+	"fmt"
+
+	"config"
+)
+
+// 按配置创建所有通知渠道
+func NewFromConfig(confs []*config.NotifierConfig) (*Fanout, error) {
+	fanout := NewFanout()
+	for i, nc := range confs {
+		level, err := ParseLevel(nc.MinLevel)
+		if err != nil {
+			return nil, fmt.Errorf("Notifiers[%d].MinLevel: %s", i, err)
+		}
+
+		var notifier Notifier
+		switch nc.Type {
+		case config.NOTIFIER_SMTP:
+			notifier = NewSmtpNotifier(SmtpConfig{
+				Host:               nc.Host,
+				Port:               nc.Port,
+				TLSMode:            nc.TLSMode,
+				Auth:               nc.Auth,
+				Username:           nc.Username,
+				Password:           nc.Password,
+				From:               nc.From,
+				To:                 nc.To,
+				InsecureSkipVerify: nc.InsecureSkipVerify,
+			})
+		case config.NOTIFIER_WEBHOOK:
+			notifier = NewWebhookNotifier(nc.Url)
+		case config.NOTIFIER_SLACK:
+			notifier = NewSlackNotifier(nc.Url)
+		case config.NOTIFIER_TELEGRAM:
+			notifier = NewTelegramNotifier(nc.Url, nc.Token, nc.ChatID)
+		default:
+			return nil, fmt.Errorf("Notifiers[%d].Type: %q is not supported", i, nc.Type)
+		}
+
+		fanout.Channels = append(fanout.Channels, &Channel{Notifier: notifier, MinLevel: level, ID: nc.ChannelID()})
+	}
+	return fanout, nil
+}
@@ -0,0 +1,129 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	HTTP_NOTIFY_TIMEOUT = 10000 //ms
+)
+
+var httpClient = &http.Client{Timeout: time.Duration(HTTP_NOTIFY_TIMEOUT) * time.Millisecond}
+
+// POST json到url, 非2xx响应视为失败
+func postJson(ctx context.Context, url string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode/100 != 2 {
+		respBody, _ := ioutil.ReadAll(io.LimitReader(response.Body, 512))
+		return fmt.Errorf("http status %d: %s", response.StatusCode, respBody)
+	}
+	io.Copy(ioutil.Discard, response.Body)
+	return nil
+}
+
+// 通用webhook, POST如下json:
+// {"level": "NOTICE", "tag": "...", "title": "...", "body": "...", "time": "..."}
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{Url: url}
+}
+
+type WebhookNotifier struct {
+	Url string
+}
+
+func (wn *WebhookNotifier) Name() string {
+	return "webhook"
+}
+
+func (wn *WebhookNotifier) Notify(ctx context.Context, msg *Message) error {
+	return postJson(ctx, wn.Url, map[string]string{
+		"level": LevelName(msg.Level),
+		"tag":   msg.Tag,
+		"title": msg.Title,
+		"body":  msg.Body,
+		"time":  msg.Time.Format(time.RFC3339),
+	})
+}
+
+// Slack incoming webhook
+func NewSlackNotifier(url string) *SlackNotifier {
+	return &SlackNotifier{Url: url}
+}
+
+type SlackNotifier struct {
+	Url string
+}
+
+func (sn *SlackNotifier) Name() string {
+	return "slack"
+}
+
+func (sn *SlackNotifier) Notify(ctx context.Context, msg *Message) error {
+	text := fmt.Sprintf("*[%s] %s*\n```%s```", LevelName(msg.Level), msg.Title, msg.Body)
+	return postJson(ctx, sn.Url, map[string]string{"text": text})
+}
+
+const DEFAULT_TELEGRAM_API = "https://api.telegram.org"
+
+// Telegram bot API
+// apiUrl: API地址, 为空时使用官方地址
+func NewTelegramNotifier(apiUrl string, token string, chatID string) *TelegramNotifier {
+	if apiUrl == "" {
+		apiUrl = DEFAULT_TELEGRAM_API
+	}
+	return &TelegramNotifier{ApiUrl: apiUrl, Token: token, ChatID: chatID}
+}
+
+type TelegramNotifier struct {
+	ApiUrl string
+	Token  string
+	ChatID string
+}
+
+func (tn *TelegramNotifier) Name() string {
+	return "telegram"
+}
+
+// telegram单条消息最长4096字符
+const TELEGRAM_MAX_TEXT = 4096
+
+func (tn *TelegramNotifier) Notify(ctx context.Context, msg *Message) error {
+	text := []rune(msg.Text())
+	if len(text) > TELEGRAM_MAX_TEXT {
+		text = text[:TELEGRAM_MAX_TEXT]
+	}
+	url := fmt.Sprintf("%s/bot%s/sendMessage", tn.ApiUrl, tn.Token)
+	err := postJson(ctx, url, map[string]string{
+		"chat_id": tn.ChatID,
+		"text":    string(text),
+	})
+	if err != nil {
+		// 错误信息中的url带有token, 需要隐藏
+		return fmt.Errorf("sendMessage to chat %s: %s", tn.ChatID, strings.Replace(err.Error(), tn.Token, "***", -1))
+	}
+	return nil
+}
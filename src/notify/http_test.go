@@ -0,0 +1,147 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 本地webhook, 记录收到的请求
+type captured struct {
+	Path        string
+	ContentType string
+	Payload     map[string]string
+}
+
+func newCaptureServer(t *testing.T, status int, reply func(r *http.Request) string) (*httptest.Server, *[]captured) {
+	var got []captured
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := captured{Path: r.URL.Path, ContentType: r.Header.Get("Content-Type")}
+		if err := json.NewDecoder(r.Body).Decode(&c.Payload); err != nil {
+			t.Errorf("decode payload: %s", err)
+		}
+		got = append(got, c)
+		w.WriteHeader(status)
+		if reply != nil {
+			w.Write([]byte(reply(r)))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &got
+}
+
+func testMessage() *Message {
+	return &Message{
+		Level: LEVEL_WARN,
+		Tag:   "main",
+		Title: "ada Rebalance Happend",
+		Body:  "ratio 1.2",
+		Time:  time.Date(2026, 10, 19, 8, 30, 0, 0, time.UTC),
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	srv, got := newCaptureServer(t, http.StatusOK, nil)
+
+	if err := NewWebhookNotifier(srv.URL+"/hook").Notify(context.Background(), testMessage()); err != nil {
+		t.Fatalf("Notify: %s", err)
+	}
+	if len(*got) != 1 {
+		t.Fatalf("got %d requests, want 1", len(*got))
+	}
+	c := (*got)[0]
+	want := map[string]string{
+		"level": "WARN",
+		"tag":   "main",
+		"title": "ada Rebalance Happend",
+		"body":  "ratio 1.2",
+		"time":  "2026-10-19T08:30:00Z",
+	}
+	if c.Path != "/hook" || c.ContentType != "application/json" {
+		t.Errorf("path %s content type %s", c.Path, c.ContentType)
+	}
+	for key, value := range want {
+		if c.Payload[key] != value {
+			t.Errorf("payload[%s] = %q, want %q", key, c.Payload[key], value)
+		}
+	}
+}
+
+func TestSlackNotifier(t *testing.T) {
+	srv, got := newCaptureServer(t, http.StatusOK, nil)
+
+	if err := NewSlackNotifier(srv.URL).Notify(context.Background(), testMessage()); err != nil {
+		t.Fatalf("Notify: %s", err)
+	}
+	want := "*[WARN] ada Rebalance Happend*\n```ratio 1.2```"
+	if len(*got) != 1 || (*got)[0].Payload["text"] != want {
+		t.Errorf("payload %v, want text %q", *got, want)
+	}
+}
+
+func TestTelegramNotifier(t *testing.T) {
+	srv, got := newCaptureServer(t, http.StatusOK, nil)
+
+	msg := testMessage()
+	msg.Body = strings.Repeat("长", TELEGRAM_MAX_TEXT)
+	if err := NewTelegramNotifier(srv.URL, "123:secret", "42").Notify(context.Background(), msg); err != nil {
+		t.Fatalf("Notify: %s", err)
+	}
+	if len(*got) != 1 {
+		t.Fatalf("got %d requests, want 1", len(*got))
+	}
+	c := (*got)[0]
+	if c.Path != "/bot123:secret/sendMessage" {
+		t.Errorf("path %s", c.Path)
+	}
+	if c.Payload["chat_id"] != "42" {
+		t.Errorf("chat_id %q", c.Payload["chat_id"])
+	}
+	// 超长的消息按字符截断
+	if n := len([]rune(c.Payload["text"])); n != TELEGRAM_MAX_TEXT {
+		t.Errorf("text has %d runes, want %d", n, TELEGRAM_MAX_TEXT)
+	}
+	if !strings.HasPrefix(c.Payload["text"], "[WARN] ada Rebalance Happend\n\n") {
+		t.Errorf("text %q", c.Payload["text"][:40])
+	}
+}
+
+func TestTelegramRedactsToken(t *testing.T) {
+	// 服务端在错误响应中回显url
+	srv, _ := newCaptureServer(t, http.StatusUnauthorized, func(r *http.Request) string {
+		return "bad token in " + r.URL.Path
+	})
+
+	err := NewTelegramNotifier(srv.URL, "123:secret", "42").Notify(context.Background(), testMessage())
+	if err == nil {
+		t.Fatal("Notify should fail on 401")
+	}
+	if strings.Contains(err.Error(), "123:secret") {
+		t.Errorf("error leaks the token: %s", err)
+	}
+	if !strings.Contains(err.Error(), "401") || !strings.Contains(err.Error(), "/bot***/sendMessage") {
+		t.Errorf("error %q should keep the status and the redacted path", err)
+	}
+
+	// 连接失败时错误中带完整url
+	srv.Close()
+	err = NewTelegramNotifier(srv.URL, "123:secret", "42").Notify(context.Background(), testMessage())
+	if err == nil || strings.Contains(err.Error(), "123:secret") {
+		t.Errorf("error %v should hide the token", err)
+	}
+}
+
+func TestPostJsonStatus(t *testing.T) {
+	srv, _ := newCaptureServer(t, http.StatusInternalServerError, func(r *http.Request) string {
+		return "boom"
+	})
+
+	err := NewWebhookNotifier(srv.URL).Notify(context.Background(), testMessage())
+	if err == nil || err.Error() != "http status 500: boom" {
+		t.Errorf("error %v, want http status 500: boom", err)
+	}
+}
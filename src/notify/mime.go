@@ -0,0 +1,112 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	tagPattern   = regexp.MustCompile(`<[a-zA-Z/][^>]*>`)
+	blankPattern = regexp.MustCompile(`\n{3,}`)
+)
+
+// 正文是否带有html标签
+func isHTML(body string) bool {
+	return tagPattern.MatchString(body)
+}
+
+// html正文, 没有单独提供时由Body转换: 带标签的按行加<br>, 纯文本转义后放入<pre>
+func (msg *Message) HTMLBody() string {
+	if msg.HTML != "" {
+		return msg.HTML
+	}
+	if isHTML(msg.Body) {
+		return strings.Replace(msg.Body, "\n", "<br>\n", -1)
+	}
+	return "<pre>" + html.EscapeString(msg.Body) + "</pre>"
+}
+
+// 纯文本正文, 去掉html标签
+func (msg *Message) PlainBody() string {
+	if !isHTML(msg.Body) {
+		return msg.Body
+	}
+	text := tagPattern.ReplaceAllString(msg.Body, "")
+	return blankPattern.ReplaceAllString(html.UnescapeString(text), "\n\n")
+}
+
+// 生成Message-ID, 域名取发件人地址的域名
+func newMessageID(from string) string {
+	domain := "localhost"
+	if at := strings.LastIndex(from, "@"); at >= 0 && at+1 < len(from) {
+		domain = strings.Trim(from[at+1:], "> ")
+	}
+
+	buf := make([]byte, 12)
+	rand.Read(buf)
+	return fmt.Sprintf("<%d.%s@%s>", time.Now().UnixNano(), hex.EncodeToString(buf), domain)
+}
+
+func writeQuotedPrintable(mw *multipart.Writer, contentType string, content string) error {
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Transfer-Encoding", "quoted-printable")
+
+	part, err := mw.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	qp := quotedprintable.NewWriter(part)
+	if _, err := qp.Write([]byte(strings.Replace(content, "\n", "\r\n", -1))); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// 构建multipart/alternative邮件, 同时带纯文本和html正文, 主题按RFC 2047编码
+func BuildMailMessage(from string, to []string, msg *Message) ([]byte, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+
+	date := msg.Time
+	if date.IsZero() {
+		date = time.Now()
+	}
+
+	headers := []struct{ key, value string }{
+		{"From", from},
+		{"To", strings.Join(to, ", ")},
+		{"Subject", mime.QEncoding.Encode("utf-8", msg.Title)},
+		{"Date", date.Format(time.RFC1123Z)},
+		{"Message-ID", newMessageID(from)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "multipart/alternative; boundary=" + mw.Boundary()},
+	}
+	var head bytes.Buffer
+	for _, h := range headers {
+		head.WriteString(h.key + ": " + h.value + "\r\n")
+	}
+	head.WriteString("\r\n")
+
+	if err := writeQuotedPrintable(mw, "text/plain; charset=utf-8", msg.PlainBody()); err != nil {
+		return nil, err
+	}
+	if err := writeQuotedPrintable(mw, "text/html; charset=utf-8", msg.HTMLBody()); err != nil {
+		return nil, err
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	return append(head.Bytes(), buf.Bytes()...), nil
+}
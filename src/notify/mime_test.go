@@ -0,0 +1,133 @@
+package notify
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+var (
+	boundaryPattern  = regexp.MustCompile(`[0-9a-f]{60}`)
+	messageIDPattern = regexp.MustCompile(`<\d+\.[0-9a-f]{24}@example\.com>`)
+)
+
+func mailMessage() *Message {
+	return &Message{
+		Level: LEVEL_WARN,
+		Tag:   "main",
+		Title: "ada 再平衡 完成",
+		Body:  "<b>ratio</b> 1.2 > 1.1\n持仓: 100 ada = 30 usdt",
+		Time:  time.Date(2026, 10, 19, 8, 30, 0, 0, time.FixedZone("CST", 8*3600)),
+	}
+}
+
+func TestBuildMailMessageGolden(t *testing.T) {
+	content, err := BuildMailMessage("bot@example.com", []string{"a@example.com", "b@example.com"}, mailMessage())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 边界和Message-ID是随机的, 比较前替换成固定值
+	got := boundaryPattern.ReplaceAll(content, []byte("BOUNDARY"))
+	got = messageIDPattern.ReplaceAll(got, []byte("<MESSAGE-ID@example.com>"))
+
+	golden := filepath.Join("testdata", "mail.golden")
+	if *update {
+		if err := ioutil.WriteFile(golden, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("mail message:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestBuildMailMessageParse(t *testing.T) {
+	msg := mailMessage()
+	content, err := BuildMailMessage("bot@example.com", []string{"a@example.com"}, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := mail.ReadMessage(bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rawSubject := parsed.Header.Get("Subject")
+	if !strings.HasPrefix(rawSubject, "=?utf-8?q?") {
+		t.Errorf("Subject %q is not Q-encoded", rawSubject)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(rawSubject)
+	if err != nil || subject != msg.Title {
+		t.Errorf("Subject decoded %q (%v), want %q", subject, err, msg.Title)
+	}
+	if date, err := parsed.Header.Date(); err != nil || !date.Equal(msg.Time) {
+		t.Errorf("Date %s (%v), want %s", date, err, msg.Time)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type %s (%v)", mediaType, err)
+	}
+
+	want := []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", "ratio 1.2 > 1.1\r\n持仓: 100 ada = 30 usdt"},
+		{"text/html; charset=utf-8", "<b>ratio</b> 1.2 > 1.1<br>\r\n持仓: 100 ada = 30 usdt"},
+	}
+	mr := multipart.NewReader(parsed.Body, params["boundary"])
+	for i, w := range want {
+		part, err := mr.NextRawPart()
+		if err != nil {
+			t.Fatalf("part %d: %s", i, err)
+		}
+		if ct := part.Header.Get("Content-Type"); ct != w.contentType {
+			t.Errorf("part %d Content-Type %s, want %s", i, ct, w.contentType)
+		}
+		body, err := ioutil.ReadAll(quotedprintable.NewReader(part))
+		if err != nil {
+			t.Fatalf("part %d: %s", i, err)
+		}
+		if string(body) != w.body {
+			t.Errorf("part %d body %q, want %q", i, body, w.body)
+		}
+	}
+	if _, err := mr.NextPart(); err == nil {
+		t.Error("unexpected third part")
+	}
+}
+
+func TestMessageBodies(t *testing.T) {
+	cases := []struct {
+		msg   Message
+		plain string
+		html  string
+	}{
+		{Message{Body: "a < b & c"}, "a < b & c", "<pre>a &lt; b &amp; c</pre>"},
+		{Message{Body: "<p>x &amp; y</p>\n\n\n\n<p>z</p>"}, "x & y\n\nz", "<p>x &amp; y</p><br>\n<br>\n<br>\n<br>\n<p>z</p>"},
+		{Message{Body: "plain", HTML: "<i>rich</i>"}, "plain", "<i>rich</i>"},
+	}
+	for _, c := range cases {
+		if got := c.msg.PlainBody(); got != c.plain {
+			t.Errorf("PlainBody(%q) = %q, want %q", c.msg.Body, got, c.plain)
+		}
+		if got := c.msg.HTMLBody(); got != c.html {
+			t.Errorf("HTMLBody(%q) = %q, want %q", c.msg.Body, got, c.html)
+		}
+	}
+}
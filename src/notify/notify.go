@@ -0,0 +1,110 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// 通知级别
+const (
+	LEVEL_INFO = iota
+	LEVEL_NOTICE
+	LEVEL_WARN
+	LEVEL_ERROR
+)
+
+var levelNames = []string{"INFO", "NOTICE", "WARN", "ERROR"}
+
+func LevelName(level int) string {
+	if level < 0 || level >= len(levelNames) {
+		return "UNKNOWN"
+	}
+	return levelNames[level]
+}
+
+// 解析级别名, 不区分大小写, 空字符串为INFO
+func ParseLevel(name string) (int, error) {
+	if name == "" {
+		return LEVEL_INFO, nil
+	}
+	for level, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			return level, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown level %q, use one of %s", name, strings.Join(levelNames, "/"))
+}
+
+// 一条通知
+type Message struct {
+	Level int
+	Tag   string // 实例标签
+	Title string
+	Body  string
+	HTML  string // html正文, 为空时由Body生成
+	Time  time.Time
+
+	// 邮件收件人, 为空时使用渠道默认的收件人, 其它渠道忽略
+	MailTo []string
+
+	// 产生通知的请求的logid, 发件箱投递时的日志带上同一个logid
+	LogID uint32
+}
+
+// 通知渠道
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, msg *Message) error
+}
+
+// 带最低级别的渠道, 低于MinLevel的通知不发送
+type Channel struct {
+	Notifier
+	MinLevel int
+
+	// 发件箱中的渠道标识, 重启和调整配置顺序后不变
+	ID string
+}
+
+// 把通知分发到多个渠道
+func NewFanout(channels ...*Channel) *Fanout {
+	return &Fanout{Channels: channels}
+}
+
+type Fanout struct {
+	Channels []*Channel
+}
+
+func (fo *Fanout) Name() string {
+	return "fanout"
+}
+
+// 发往所有满足级别的渠道, 某个渠道失败不影响其它渠道, 返回所有失败原因
+func (fo *Fanout) Notify(ctx context.Context, msg *Message) error {
+	if msg.Time.IsZero() {
+		msg.Time = time.Now()
+	}
+
+	var errs []string
+	for _, ch := range fo.Channels {
+		if msg.Level < ch.MinLevel {
+			continue
+		}
+		if err := ch.Notify(ctx, msg); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", ch.Name(), err))
+		}
+	}
+
+	if len(errs) != 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// 纯文本格式的通知内容, 供webhook类渠道使用
+func (msg *Message) Text() string {
+	return fmt.Sprintf("[%s] %s\n\n%s", LevelName(msg.Level), msg.Title, msg.Body)
+}
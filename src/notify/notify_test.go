@@ -0,0 +1,81 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// 记录收到的通知, err不为nil时返回失败
+type fakeNotifier struct {
+	name string
+	err  error
+	got  []*Message
+}
+
+func (fn *fakeNotifier) Name() string {
+	return fn.name
+}
+
+func (fn *fakeNotifier) Notify(ctx context.Context, msg *Message) error {
+	fn.got = append(fn.got, msg)
+	return fn.err
+}
+
+func TestFanoutMinLevel(t *testing.T) {
+	all := &fakeNotifier{name: "all"}
+	errorsOnly := &fakeNotifier{name: "errors"}
+	fanout := NewFanout(
+		&Channel{Notifier: all, MinLevel: LEVEL_INFO},
+		&Channel{Notifier: errorsOnly, MinLevel: LEVEL_ERROR},
+	)
+
+	for _, level := range []int{LEVEL_INFO, LEVEL_NOTICE, LEVEL_WARN, LEVEL_ERROR} {
+		if err := fanout.Notify(context.Background(), &Message{Level: level, Title: LevelName(level)}); err != nil {
+			t.Fatalf("Notify: %s", err)
+		}
+	}
+	if len(all.got) != 4 {
+		t.Errorf("channel all got %d messages, want 4", len(all.got))
+	}
+	if len(errorsOnly.got) != 1 || errorsOnly.got[0].Level != LEVEL_ERROR {
+		t.Errorf("channel errors got %v, want only the ERROR message", errorsOnly.got)
+	}
+	if all.got[0].Time.IsZero() {
+		t.Errorf("Notify should set the message time")
+	}
+}
+
+func TestFanoutErrors(t *testing.T) {
+	ok := &fakeNotifier{name: "ok"}
+	fanout := NewFanout(
+		&Channel{Notifier: &fakeNotifier{name: "smtp", err: errors.New("dial timeout")}},
+		&Channel{Notifier: ok},
+		&Channel{Notifier: &fakeNotifier{name: "slack", err: errors.New("http status 500")}},
+	)
+
+	err := fanout.Notify(context.Background(), &Message{Level: LEVEL_ERROR})
+	if err == nil {
+		t.Fatal("Notify should fail when a channel fails")
+	}
+	want := "smtp: dial timeout; slack: http status 500"
+	if err.Error() != want {
+		t.Errorf("error %q, want %q", err, want)
+	}
+	// 失败的渠道不影响其它渠道
+	if len(ok.got) != 1 {
+		t.Errorf("channel ok got %d messages, want 1", len(ok.got))
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for name, want := range map[string]int{"": LEVEL_INFO, "notice": LEVEL_NOTICE, "WARN": LEVEL_WARN, "Error": LEVEL_ERROR} {
+		if level, err := ParseLevel(name); err != nil || level != want {
+			t.Errorf("ParseLevel(%q) = %d, %v, want %d", name, level, err, want)
+		}
+	}
+	if _, err := ParseLevel("fatal"); err == nil || !strings.Contains(err.Error(), "INFO/NOTICE/WARN/ERROR") {
+		t.Errorf("ParseLevel(fatal) error %v", err)
+	}
+}
@@ -0,0 +1,326 @@
+package notify
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"korok"
+)
+
+const (
+	OUTBOX_CHECK_INTERVAL = 1000    //ms
+	OUTBOX_SEND_TIMEOUT   = 30000   //ms
+	OUTBOX_BACKOFF_BASE   = 10000   //ms
+	OUTBOX_BACKOFF_MAX    = 1800000 //ms
+	OUTBOX_MAX_AGE        = 24      //h
+	OUTBOX_DEDUPE_WINDOW  = 10      //min
+)
+
+// 待发送的通知, 每个渠道一条, 落盘为outbox目录下的一个json文件
+type OutboxEntry struct {
+	ID          string    `json:"id"`
+	Channel     string    `json:"channel"`
+	DedupeKey   string    `json:"dedupe_key"`
+	Message     *Message  `json:"message"`
+	Created     time.Time `json:"created"`
+	Attempts    int       `json:"attempts"`
+	NextAttempt time.Time `json:"next_attempt"`
+	LastError   string    `json:"last_error,omitempty"`
+}
+
+// 通知发件箱: 通知先写入磁盘, 由后台goroutine按渠道发送, 失败时指数退避重试,
+// 进程重启后继续发送未完成的通知
+// dir: 发件箱目录
+// fanout: 实际发送的渠道
+func NewOutbox(dir string, fanout *Fanout) (*Outbox, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	ob := &Outbox{
+		Dir:       dir,
+		channels:  make(map[string]*Channel),
+		pending:   make(map[string]*OutboxEntry),
+		delivered: make(map[string]time.Time),
+		wake:      make(chan struct{}, 1),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	for _, ch := range fanout.Channels {
+		key := ch.ID
+		if key == "" {
+			key = ch.Name()
+		}
+		if _, ok := ob.channels[key]; ok {
+			return nil, fmt.Errorf("duplicate notify channel %s", key)
+		}
+		ob.channels[key] = ch
+		ob.order = append(ob.order, key)
+	}
+
+	if err := ob.load(); err != nil {
+		return nil, err
+	}
+	return ob, nil
+}
+
+type Outbox struct {
+	Dir string
+
+	channels map[string]*Channel
+	order    []string
+
+	mu        sync.Mutex
+	seq       int64
+	pending   map[string]*OutboxEntry
+	delivered map[string]time.Time
+
+	wake chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+func (ob *Outbox) Name() string {
+	return "outbox"
+}
+
+func dedupeKey(channel string, msg *Message) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "%s\x00%d\x00%s\x00%s\x00%s\x00%s", channel, msg.Level, msg.Tag, strings.Join(msg.MailTo, ","), msg.Title, msg.Body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// 放入发件箱, 不等待发送结果; 与待发送或最近已发送的通知完全相同时丢弃
+func (ob *Outbox) Notify(ctx context.Context, msg *Message) error {
+	if msg.Time.IsZero() {
+		msg.Time = time.Now()
+	}
+
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	now := time.Now()
+	var errs []string
+	for _, key := range ob.order {
+		if msg.Level < ob.channels[key].MinLevel {
+			continue
+		}
+
+		dkey := dedupeKey(key, msg)
+		if ob.isDuplicateWithoutLock(dkey, now) {
+			korok.InfoCtx(ctx, "[Outbox] drop duplicate notify to %s: %s", key, msg.Title)
+			continue
+		}
+
+		ob.seq++
+		entry := &OutboxEntry{
+			ID:          fmt.Sprintf("%d-%06d", now.UnixNano(), ob.seq),
+			Channel:     key,
+			DedupeKey:   dkey,
+			Message:     msg,
+			Created:     now,
+			NextAttempt: now,
+		}
+		if err := ob.save(entry); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", key, err))
+			continue
+		}
+		ob.pending[entry.ID] = entry
+	}
+
+	select {
+	case ob.wake <- struct{}{}:
+	default:
+	}
+
+	if len(errs) != 0 {
+		return fmt.Errorf("outbox save failed: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (ob *Outbox) isDuplicateWithoutLock(dkey string, now time.Time) bool {
+	for _, entry := range ob.pending {
+		if entry.DedupeKey == dkey {
+			return true
+		}
+	}
+	if sent, ok := ob.delivered[dkey]; ok && now.Sub(sent) < time.Duration(OUTBOX_DEDUPE_WINDOW)*time.Minute {
+		return true
+	}
+	return false
+}
+
+// 待发送的通知数
+func (ob *Outbox) Pending() int {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	return len(ob.pending)
+}
+
+func (ob *Outbox) entryPath(id string) string {
+	return filepath.Join(ob.Dir, id+".json")
+}
+
+func (ob *Outbox) save(entry *OutboxEntry) error {
+	content, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	path := ob.entryPath(entry.ID)
+	if err := ioutil.WriteFile(path+".tmp", content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+func (ob *Outbox) load() error {
+	files, err := filepath.Glob(filepath.Join(ob.Dir, "*.json"))
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		entry := &OutboxEntry{}
+		if err := json.Unmarshal(content, entry); err != nil || entry.Message == nil {
+			korok.Error("[Outbox] skip broken entry %s: %v", file, err)
+			continue
+		}
+		// 渠道被删除或改名时留在磁盘上, 恢复配置后重启继续发送
+		if _, ok := ob.channels[entry.Channel]; !ok {
+			korok.Error("[Outbox] channel %s of %s is not configured, keep it on disk: %s", entry.Channel, file, entry.Message.Title)
+			continue
+		}
+		ob.pending[entry.ID] = entry
+	}
+	if len(ob.pending) != 0 {
+		korok.Info("[Outbox] %d pending notify loaded from %s", len(ob.pending), ob.Dir)
+	}
+	return nil
+}
+
+func (ob *Outbox) remove(entry *OutboxEntry) {
+	os.Remove(ob.entryPath(entry.ID))
+	delete(ob.pending, entry.ID)
+}
+
+// 到期的通知, 按创建时间排序; force为true时忽略退避时间
+func (ob *Outbox) dueEntries(now time.Time, force bool) []*OutboxEntry {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	var due []*OutboxEntry
+	for _, entry := range ob.pending {
+		if force || !entry.NextAttempt.After(now) {
+			due = append(due, entry)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].ID < due[j].ID })
+
+	for dkey, sent := range ob.delivered {
+		if now.Sub(sent) >= time.Duration(OUTBOX_DEDUPE_WINDOW)*time.Minute {
+			delete(ob.delivered, dkey)
+		}
+	}
+	return due
+}
+
+func backoff(attempts int) time.Duration {
+	d := time.Duration(OUTBOX_BACKOFF_BASE) * time.Millisecond
+	for i := 1; i < attempts && d < time.Duration(OUTBOX_BACKOFF_MAX)*time.Millisecond; i++ {
+		d *= 2
+	}
+	if max := time.Duration(OUTBOX_BACKOFF_MAX) * time.Millisecond; d > max {
+		d = max
+	}
+	return d
+}
+
+func (ob *Outbox) deliver(ctx context.Context, entry *OutboxEntry) {
+	ctx = korok.WithLogID(ctx, entry.Message.LogID)
+	ch := ob.channels[entry.Channel]
+
+	sendCtx, cancel := context.WithTimeout(ctx, time.Duration(OUTBOX_SEND_TIMEOUT)*time.Millisecond)
+	err := ch.Notify(sendCtx, entry.Message)
+	cancel()
+
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	now := time.Now()
+	if err == nil {
+		korok.InfoCtx(ctx, "[Outbox] %s delivered after %d retries: %s", entry.Channel, entry.Attempts, entry.Message.Title)
+		ob.delivered[entry.DedupeKey] = now
+		ob.remove(entry)
+		return
+	}
+
+	entry.Attempts++
+	entry.LastError = err.Error()
+	if now.Sub(entry.Created) > time.Duration(OUTBOX_MAX_AGE)*time.Hour {
+		korok.ErrorCtx(ctx, "[Outbox] %s give up after %d attempts: %s, last error: %s", entry.Channel, entry.Attempts, entry.Message.Title, err)
+		ob.remove(entry)
+		return
+	}
+
+	entry.NextAttempt = now.Add(backoff(entry.Attempts))
+	korok.ErrorCtx(ctx, "[Outbox] %s attempt %d failed, retry at %s: %s", entry.Channel, entry.Attempts, entry.NextAttempt.Format("15:04:05"), err)
+	if err := ob.save(entry); err != nil {
+		korok.ErrorCtx(ctx, "[Outbox] save %s failed: %s", entry.ID, err)
+	}
+}
+
+func (ob *Outbox) RunDeliverRoutine() {
+	go ob.Deliver()
+}
+
+func (ob *Outbox) Deliver() {
+	defer close(ob.done)
+
+	clocker := time.NewTicker(time.Duration(OUTBOX_CHECK_INTERVAL) * time.Millisecond)
+	defer clocker.Stop()
+	for {
+		select {
+		case <-ob.stop:
+			return
+		case <-clocker.C:
+		case <-ob.wake:
+		}
+
+		for _, entry := range ob.dueEntries(time.Now(), false) {
+			ob.deliver(context.Background(), entry)
+		}
+	}
+}
+
+// 停止后台发送, 并在ctx结束前尽量发送完所有待发送的通知, 发送失败的留在磁盘上, 下次启动后继续发送
+func (ob *Outbox) Close(ctx context.Context) error {
+	close(ob.stop)
+	<-ob.done
+
+	for _, entry := range ob.dueEntries(time.Now(), true) {
+		if ctx.Err() != nil {
+			break
+		}
+		ob.deliver(ctx, entry)
+	}
+
+	if pending := ob.Pending(); pending != 0 {
+		return fmt.Errorf("%d notify still pending in %s", pending, ob.Dir)
+	}
+	return nil
+}
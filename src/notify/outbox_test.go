@@ -0,0 +1,267 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestOutbox(t *testing.T, dir string, notifiers ...*fakeNotifier) *Outbox {
+	fanout := NewFanout()
+	for _, fn := range notifiers {
+		fanout.Channels = append(fanout.Channels, &Channel{Notifier: fn, ID: fn.name})
+	}
+	ob, err := NewOutbox(dir, fanout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ob
+}
+
+func outboxFiles(t *testing.T, dir string) []string {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+// 同步发送到期的通知, 不启动后台goroutine
+func deliverDue(ob *Outbox, now time.Time) {
+	for _, entry := range ob.dueEntries(now, false) {
+		ob.deliver(context.Background(), entry)
+	}
+}
+
+func TestOutboxDuplicateNotify(t *testing.T) {
+	fn := &fakeNotifier{name: "a"}
+	ob := newTestOutbox(t, t.TempDir(), fn)
+
+	msg := &Message{Level: LEVEL_WARN, Title: "t", Body: "b"}
+	for i := 0; i < 3; i++ {
+		if err := ob.Notify(context.Background(), msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ob.Pending() != 1 {
+		t.Fatalf("pending %d, want 1: duplicate of a pending notify must be dropped", ob.Pending())
+	}
+
+	deliverDue(ob, time.Now())
+	if len(fn.got) != 1 || ob.Pending() != 0 {
+		t.Fatalf("got %d pending %d after delivery", len(fn.got), ob.Pending())
+	}
+
+	// 已发送的在去重窗口内也丢弃
+	ob.Notify(context.Background(), msg)
+	if ob.Pending() != 0 {
+		t.Errorf("pending %d, want 0: duplicate of a delivered notify must be dropped", ob.Pending())
+	}
+	// 内容不同的不是重复
+	ob.Notify(context.Background(), &Message{Level: LEVEL_WARN, Title: "t", Body: "other"})
+	if ob.Pending() != 1 {
+		t.Errorf("pending %d, want 1", ob.Pending())
+	}
+}
+
+func TestOutboxDedupeWindow(t *testing.T) {
+	ob := newTestOutbox(t, t.TempDir(), &fakeNotifier{name: "a"})
+
+	window := time.Duration(OUTBOX_DEDUPE_WINDOW) * time.Minute
+	sent := time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)
+	dkey := dedupeKey("a", &Message{Title: "t"})
+	ob.delivered[dkey] = sent
+
+	cases := []struct {
+		now  time.Time
+		want bool
+	}{
+		{sent, true},
+		{sent.Add(window - time.Second), true},
+		{sent.Add(window), false},
+		{sent.Add(time.Hour), false},
+	}
+	for _, c := range cases {
+		if got := ob.isDuplicateWithoutLock(dkey, c.now); got != c.want {
+			t.Errorf("isDuplicate at +%s = %v, want %v", c.now.Sub(sent), got, c.want)
+		}
+	}
+	if ob.isDuplicateWithoutLock(dedupeKey("b", &Message{Title: "t"}), sent) {
+		t.Error("same message on another channel is not a duplicate")
+	}
+
+	// 过期的记录在取到期通知时清理
+	ob.dueEntries(sent.Add(window-time.Second), false)
+	if _, ok := ob.delivered[dkey]; !ok {
+		t.Error("delivered record removed before the window ends")
+	}
+	ob.dueEntries(sent.Add(window), false)
+	if _, ok := ob.delivered[dkey]; ok {
+		t.Error("delivered record kept after the window ends")
+	}
+}
+
+func TestOutboxBackoff(t *testing.T) {
+	cases := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, 10 * time.Second},
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{3, 40 * time.Second},
+		{4, 80 * time.Second},
+		{8, 1280 * time.Second},
+		{9, 30 * time.Minute},
+		{10, 30 * time.Minute},
+		{1000, 30 * time.Minute},
+	}
+	for _, c := range cases {
+		if got := backoff(c.attempts); got != c.want {
+			t.Errorf("backoff(%d) = %s, want %s", c.attempts, got, c.want)
+		}
+	}
+}
+
+func TestOutboxRetry(t *testing.T) {
+	dir := t.TempDir()
+	fn := &fakeNotifier{name: "a", err: errors.New("http status 502")}
+	ob := newTestOutbox(t, dir, fn)
+
+	ob.Notify(context.Background(), &Message{Title: "t"})
+	now := time.Now()
+	deliverDue(ob, now)
+
+	entry := ob.dueEntries(now, true)[0]
+	if entry.Attempts != 1 || entry.LastError != "http status 502" {
+		t.Errorf("entry after failure %+v", entry)
+	}
+	if entry.NextAttempt.Before(now.Add(backoff(1))) {
+		t.Errorf("next attempt %s is before the backoff", entry.NextAttempt)
+	}
+
+	// 退避期间不重试
+	deliverDue(ob, now.Add(time.Second))
+	if len(fn.got) != 1 {
+		t.Errorf("retried %d times during backoff", len(fn.got)-1)
+	}
+
+	fn.err = nil
+	deliverDue(ob, entry.NextAttempt)
+	if len(fn.got) != 2 || ob.Pending() != 0 || len(outboxFiles(t, dir)) != 0 {
+		t.Errorf("got %d pending %d files %v after retry", len(fn.got), ob.Pending(), outboxFiles(t, dir))
+	}
+}
+
+func TestOutboxGiveUp(t *testing.T) {
+	dir := t.TempDir()
+	fn := &fakeNotifier{name: "a", err: errors.New("dial timeout")}
+	ob := newTestOutbox(t, dir, fn)
+
+	ob.Notify(context.Background(), &Message{Title: "fresh"})
+	ob.Notify(context.Background(), &Message{Title: "old"})
+	for _, entry := range ob.dueEntries(time.Now(), true) {
+		if entry.Message.Title == "old" {
+			entry.Created = time.Now().Add(-time.Duration(OUTBOX_MAX_AGE)*time.Hour - time.Minute)
+		}
+	}
+
+	deliverDue(ob, time.Now())
+	due := ob.dueEntries(time.Now(), true)
+	if len(due) != 1 || due[0].Message.Title != "fresh" {
+		t.Fatalf("pending %v, want only the fresh notify", due)
+	}
+	if files := outboxFiles(t, dir); len(files) != 1 || !strings.HasSuffix(files[0], due[0].ID+".json") {
+		t.Errorf("files %v, the given up entry must be removed from disk", files)
+	}
+}
+
+func TestOutboxReload(t *testing.T) {
+	dir := t.TempDir()
+	a := &fakeNotifier{name: "a", err: errors.New("down")}
+	b := &fakeNotifier{name: "b", err: errors.New("down")}
+	ob := newTestOutbox(t, dir, a, b)
+
+	ob.Notify(context.Background(), &Message{Level: LEVEL_ERROR, Title: "t", LogID: 42})
+	deliverDue(ob, time.Now())
+
+	ioutil.WriteFile(filepath.Join(dir, "broken.json"), []byte("{"), 0600)
+	ioutil.WriteFile(filepath.Join(dir, "empty.json"), []byte(`{"id":"empty","channel":"a"}`), 0600)
+
+	// 重启后渠道b被删除
+	reloaded := newTestOutbox(t, dir, &fakeNotifier{name: "a"})
+	due := reloaded.dueEntries(time.Now(), true)
+	if len(due) != 1 {
+		t.Fatalf("reloaded %d entries, want 1", len(due))
+	}
+	entry := due[0]
+	if entry.Channel != "a" || entry.Attempts != 1 || entry.LastError != "down" ||
+		entry.Message.Title != "t" || entry.Message.LogID != 42 || entry.NextAttempt.IsZero() {
+		t.Errorf("reloaded entry %+v", entry)
+	}
+
+	// 未配置渠道的通知和损坏的文件都留在磁盘上
+	if files := outboxFiles(t, dir); len(files) != 4 {
+		t.Errorf("files %v, want 4", files)
+	}
+
+	// 重启后待发送的通知仍参与去重
+	reloaded.Notify(context.Background(), &Message{Level: LEVEL_ERROR, Title: "t"})
+	if reloaded.Pending() != 1 {
+		t.Errorf("pending %d, want 1", reloaded.Pending())
+	}
+}
+
+func TestOutboxDuplicateChannel(t *testing.T) {
+	fanout := NewFanout(
+		&Channel{Notifier: &fakeNotifier{name: "a"}, ID: "smtp-1"},
+		&Channel{Notifier: &fakeNotifier{name: "b"}, ID: "smtp-1"},
+	)
+	if _, err := NewOutbox(t.TempDir(), fanout); err == nil || !strings.Contains(err.Error(), "duplicate") {
+		t.Errorf("error %v, want duplicate notify channel", err)
+	}
+}
+
+func TestOutboxClose(t *testing.T) {
+	dir := t.TempDir()
+	ok := &fakeNotifier{name: "ok", err: errors.New("down")}
+	down := &fakeNotifier{name: "down", err: errors.New("down")}
+	ob := newTestOutbox(t, dir, ok, down)
+
+	// 先失败一次, 让通知处于退避中
+	ob.Notify(context.Background(), &Message{Title: "t"})
+	deliverDue(ob, time.Now())
+	ok.err = nil
+
+	ob.RunDeliverRoutine()
+	err := ob.Close(context.Background())
+	if err == nil || err.Error() != "1 notify still pending in "+dir {
+		t.Errorf("Close error %v, want 1 notify still pending", err)
+	}
+	if len(ok.got) != 2 {
+		t.Errorf("Close should flush the entry in backoff, got %d attempts", len(ok.got))
+	}
+	if files := outboxFiles(t, dir); len(files) != 1 {
+		t.Errorf("files %v, the failed entry must stay on disk", files)
+	}
+}
+
+func TestOutboxCloseCanceled(t *testing.T) {
+	fn := &fakeNotifier{name: "a", err: errors.New("down")}
+	ob := newTestOutbox(t, t.TempDir(), fn)
+	ob.Notify(context.Background(), &Message{Title: "t"})
+	deliverDue(ob, time.Now())
+	fn.err = nil
+
+	// ctx已结束时不再发送, 通知留到下次启动
+	ob.RunDeliverRoutine()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := ob.Close(ctx); err == nil || ob.Pending() != 1 || len(fn.got) != 1 {
+		t.Errorf("Close error %v pending %d attempts %d", err, ob.Pending(), len(fn.got))
+	}
+}
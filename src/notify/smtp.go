@@ -0,0 +1,181 @@
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+const (
+	DEFAULT_SMTP_HOST = "smtp.gmail.com"
+	DEFAULT_SMTP_PORT = 587
+	SMTP_TIMEOUT      = 30000 //ms
+)
+
+// TLS模式
+const (
+	SMTP_TLS_STARTTLS = "starttls" // 明文连接后升级, 一般是587端口
+	SMTP_TLS_IMPLICIT = "tls"      // 直接TLS连接, 一般是465端口
+	SMTP_TLS_NONE     = "none"     // 不加密, 只用于本地测试
+)
+
+// 认证方式
+const (
+	SMTP_AUTH_PLAIN   = "plain"
+	SMTP_AUTH_CRAMMD5 = "cram-md5"
+	SMTP_AUTH_NONE    = "none"
+)
+
+// 邮件通知
+func NewSmtpNotifier(conf SmtpConfig) *SmtpNotifier {
+	if conf.Host == "" {
+		conf.Host = DEFAULT_SMTP_HOST
+	}
+	if conf.TLSMode == "" {
+		conf.TLSMode = SMTP_TLS_STARTTLS
+	}
+	if conf.Port == 0 {
+		conf.Port = DEFAULT_SMTP_PORT
+		if conf.TLSMode == SMTP_TLS_IMPLICIT {
+			conf.Port = 465
+		}
+	}
+	if conf.Auth == "" {
+		conf.Auth = SMTP_AUTH_PLAIN
+		if conf.Password == "" {
+			conf.Auth = SMTP_AUTH_NONE
+		}
+	}
+	if conf.Username == "" {
+		conf.Username = conf.From
+	}
+	return &SmtpNotifier{Conf: conf}
+}
+
+type SmtpConfig struct {
+	Host     string
+	Port     int
+	TLSMode  string // starttls, tls, none
+	Auth     string // plain, cram-md5, none
+	Username string // 默认为From
+	Password string
+	From     string
+	To       []string // 默认收件人
+
+	InsecureSkipVerify bool
+}
+
+type SmtpNotifier struct {
+	Conf SmtpConfig
+}
+
+func (sn *SmtpNotifier) Name() string {
+	return "smtp"
+}
+
+func (sn *SmtpNotifier) Notify(ctx context.Context, msg *Message) error {
+	to := msg.MailTo
+	if len(to) == 0 {
+		to = sn.Conf.To
+	}
+	if len(to) == 0 {
+		return errors.New("no recipient")
+	}
+
+	content, err := BuildMailMessage(sn.Conf.From, to, msg)
+	if err != nil {
+		return err
+	}
+
+	return sn.send(ctx, to, content)
+}
+
+func (sn *SmtpNotifier) dial(ctx context.Context) (net.Conn, error) {
+	addr := net.JoinHostPort(sn.Conf.Host, strconv.Itoa(sn.Conf.Port))
+	dialer := &net.Dialer{Timeout: time.Duration(SMTP_TIMEOUT) * time.Millisecond}
+
+	if sn.Conf.TLSMode == SMTP_TLS_IMPLICIT {
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: sn.tlsConfig()}
+		return tlsDialer.DialContext(ctx, "tcp", addr)
+	}
+	return dialer.DialContext(ctx, "tcp", addr)
+}
+
+func (sn *SmtpNotifier) tlsConfig() *tls.Config {
+	return &tls.Config{
+		ServerName:         sn.Conf.Host,
+		InsecureSkipVerify: sn.Conf.InsecureSkipVerify,
+	}
+}
+
+func (sn *SmtpNotifier) auth() smtp.Auth {
+	switch sn.Conf.Auth {
+	case SMTP_AUTH_PLAIN:
+		return smtp.PlainAuth("", sn.Conf.Username, sn.Conf.Password, sn.Conf.Host)
+	case SMTP_AUTH_CRAMMD5:
+		return smtp.CRAMMD5Auth(sn.Conf.Username, sn.Conf.Password)
+	}
+	return nil
+}
+
+func (sn *SmtpNotifier) send(ctx context.Context, to []string, content []byte) error {
+	conn, err := sn.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(time.Duration(SMTP_TIMEOUT) * time.Millisecond)
+	}
+	conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, sn.Conf.Host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if sn.Conf.TLSMode == SMTP_TLS_STARTTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return errors.New("server does not support STARTTLS")
+		}
+		if err := client.StartTLS(sn.tlsConfig()); err != nil {
+			return fmt.Errorf("STARTTLS: %s", err)
+		}
+	}
+
+	if auth := sn.auth(); auth != nil {
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("AUTH: %s", err)
+		}
+	}
+
+	if err := client.Mail(sn.Conf.From); err != nil {
+		return fmt.Errorf("MAIL FROM: %s", err)
+	}
+	for _, rcpt := range to {
+		if err := client.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("RCPT TO %s: %s", rcpt, err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("DATA: %s", err)
+	}
+	if _, err := w.Write(content); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("DATA: %s", err)
+	}
+
+	return client.Quit()
+}
@@ -0,0 +1,296 @@
+package notify
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"math/big"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	fakeUser      = "bot@example.com"
+	fakePassword  = "app-password"
+	fakeChallenge = "<1896.697170952@fake.example.com>"
+)
+
+// 本地的假SMTP服务, 只处理一个连接, 记录会话
+type fakeSmtp struct {
+	addr     string
+	port     int
+	implicit bool // 直接TLS
+	starttls bool // 是否支持STARTTLS
+
+	done chan *smtpSession
+}
+
+type smtpSession struct {
+	TLS      bool
+	Auth     string // PLAIN, CRAM-MD5
+	User     string
+	Password string
+	AuthOk   bool
+	From     string
+	To       []string
+	Data     string
+	Err      error
+}
+
+func newTestTLSConfig(t *testing.T) *tls.Config {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+}
+
+func startFakeSmtp(t *testing.T, implicit bool, starttls bool) *fakeSmtp {
+	tlsConfig := newTestTLSConfig(t)
+	var ln net.Listener
+	var err error
+	if implicit {
+		ln, err = tls.Listen("tcp", "127.0.0.1:0", tlsConfig)
+	} else {
+		ln, err = net.Listen("tcp", "127.0.0.1:0")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	fs := &fakeSmtp{
+		addr:     ln.Addr().String(),
+		port:     ln.Addr().(*net.TCPAddr).Port,
+		implicit: implicit,
+		starttls: starttls,
+		done:     make(chan *smtpSession, 1),
+	}
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(10 * time.Second))
+		session := &smtpSession{TLS: implicit}
+		session.Err = fs.serve(conn, tlsConfig, session)
+		fs.done <- session
+	}()
+	return fs
+}
+
+func (fs *fakeSmtp) serve(conn net.Conn, tlsConfig *tls.Config, session *smtpSession) error {
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 fake.example.com ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return err
+		}
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch verb {
+		case "EHLO", "HELO":
+			tp.PrintfLine("250-fake.example.com")
+			if fs.starttls && !session.TLS {
+				tp.PrintfLine("250-STARTTLS")
+			}
+			tp.PrintfLine("250 AUTH PLAIN CRAM-MD5")
+		case "STARTTLS":
+			tp.PrintfLine("220 ready to start TLS")
+			tlsConn := tls.Server(conn, tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return err
+			}
+			conn = tlsConn
+			tp = textproto.NewConn(conn)
+			session.TLS = true
+		case "AUTH":
+			fs.auth(tp, line, session)
+		case "MAIL":
+			session.From = strings.TrimPrefix(line, "MAIL FROM:")
+			tp.PrintfLine("250 ok")
+		case "RCPT":
+			session.To = append(session.To, strings.TrimPrefix(line, "RCPT TO:"))
+			tp.PrintfLine("250 ok")
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+			lines, err := tp.ReadDotLines()
+			if err != nil {
+				return err
+			}
+			session.Data = strings.Join(lines, "\n")
+			tp.PrintfLine("250 queued")
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			return nil
+		default:
+			tp.PrintfLine("502 unknown command")
+		}
+	}
+}
+
+func (fs *fakeSmtp) auth(tp *textproto.Conn, line string, session *smtpSession) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		tp.PrintfLine("501 syntax error")
+		return
+	}
+	session.Auth = strings.ToUpper(fields[1])
+	switch session.Auth {
+	case "PLAIN":
+		if len(fields) != 3 {
+			tp.PrintfLine("501 initial response required")
+			return
+		}
+		decoded, _ := base64.StdEncoding.DecodeString(fields[2])
+		parts := strings.Split(string(decoded), "\x00")
+		if len(parts) == 3 {
+			session.User, session.Password = parts[1], parts[2]
+		}
+		session.AuthOk = session.User == fakeUser && session.Password == fakePassword
+	case "CRAM-MD5":
+		tp.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte(fakeChallenge)))
+		reply, _ := tp.ReadLine()
+		decoded, _ := base64.StdEncoding.DecodeString(reply)
+		parts := strings.Fields(string(decoded))
+		if len(parts) == 2 {
+			mac := hmac.New(md5.New, []byte(fakePassword))
+			mac.Write([]byte(fakeChallenge))
+			session.User = parts[0]
+			session.AuthOk = parts[0] == fakeUser && parts[1] == hex.EncodeToString(mac.Sum(nil))
+		}
+	}
+	if session.AuthOk {
+		tp.PrintfLine("235 authenticated")
+	} else {
+		tp.PrintfLine("535 bad credentials")
+	}
+}
+
+func (fs *fakeSmtp) session(t *testing.T) *smtpSession {
+	select {
+	case session := <-fs.done:
+		return session
+	case <-time.After(10 * time.Second):
+		t.Fatal("fake smtp server got no session")
+	}
+	return nil
+}
+
+func smtpConf(fs *fakeSmtp, tlsMode string, auth string, password string) SmtpConfig {
+	return SmtpConfig{
+		Host:               "127.0.0.1",
+		Port:               fs.port,
+		TLSMode:            tlsMode,
+		Auth:               auth,
+		Username:           fakeUser,
+		Password:           password,
+		From:               fakeUser,
+		To:                 []string{"ops@example.com"},
+		InsecureSkipVerify: true,
+	}
+}
+
+func TestSmtpModes(t *testing.T) {
+	cases := []struct {
+		name     string
+		implicit bool
+		starttls bool
+		tlsMode  string
+		auth     string
+	}{
+		{"none without auth", false, false, SMTP_TLS_NONE, SMTP_AUTH_NONE},
+		{"none with plain", false, false, SMTP_TLS_NONE, SMTP_AUTH_PLAIN},
+		{"starttls with plain", false, true, SMTP_TLS_STARTTLS, SMTP_AUTH_PLAIN},
+		{"starttls with cram-md5", false, true, SMTP_TLS_STARTTLS, SMTP_AUTH_CRAMMD5},
+		{"implicit tls with plain", true, false, SMTP_TLS_IMPLICIT, SMTP_AUTH_PLAIN},
+		{"implicit tls with cram-md5", true, false, SMTP_TLS_IMPLICIT, SMTP_AUTH_CRAMMD5},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			fs := startFakeSmtp(t, c.implicit, c.starttls)
+			sn := NewSmtpNotifier(smtpConf(fs, c.tlsMode, c.auth, fakePassword))
+
+			msg := testMessage()
+			msg.MailTo = []string{"a@example.com", "b@example.com"}
+			if err := sn.Notify(context.Background(), msg); err != nil {
+				t.Fatalf("Notify: %s", err)
+			}
+
+			session := fs.session(t)
+			if session.Err != nil {
+				t.Fatalf("server: %s", session.Err)
+			}
+			if wantTLS := c.tlsMode != SMTP_TLS_NONE; session.TLS != wantTLS {
+				t.Errorf("TLS %v, want %v", session.TLS, wantTLS)
+			}
+			wantAuth := map[string]string{SMTP_AUTH_PLAIN: "PLAIN", SMTP_AUTH_CRAMMD5: "CRAM-MD5"}[c.auth]
+			if session.Auth != wantAuth || (wantAuth != "" && !session.AuthOk) {
+				t.Errorf("auth %q ok %v, want %q", session.Auth, session.AuthOk, wantAuth)
+			}
+			if session.From != "<"+fakeUser+">" {
+				t.Errorf("MAIL FROM %s", session.From)
+			}
+			if strings.Join(session.To, ",") != "<a@example.com>,<b@example.com>" {
+				t.Errorf("RCPT TO %v, MailTo should override the default recipients", session.To)
+			}
+			if !strings.Contains(session.Data, "Subject: ada Rebalance Happend") {
+				t.Errorf("DATA without subject:\n%s", session.Data)
+			}
+		})
+	}
+}
+
+func TestSmtpErrors(t *testing.T) {
+	// 服务端不支持STARTTLS时不能降级为明文
+	fs := startFakeSmtp(t, false, false)
+	err := NewSmtpNotifier(smtpConf(fs, SMTP_TLS_STARTTLS, SMTP_AUTH_PLAIN, fakePassword)).Notify(context.Background(), testMessage())
+	if err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Errorf("error %v, want STARTTLS not supported", err)
+	}
+
+	fs = startFakeSmtp(t, true, false)
+	err = NewSmtpNotifier(smtpConf(fs, SMTP_TLS_IMPLICIT, SMTP_AUTH_CRAMMD5, "wrong")).Notify(context.Background(), testMessage())
+	if err == nil || !strings.HasPrefix(err.Error(), "AUTH: 535") {
+		t.Errorf("error %v, want AUTH: 535", err)
+	}
+
+	sn := NewSmtpNotifier(SmtpConfig{From: fakeUser, Host: "127.0.0.1", Port: fs.port})
+	if err := sn.Notify(context.Background(), testMessage()); err == nil || err.Error() != "no recipient" {
+		t.Errorf("error %v, want no recipient", err)
+	}
+}
+
+func TestNewSmtpNotifierDefaults(t *testing.T) {
+	conf := NewSmtpNotifier(SmtpConfig{From: fakeUser, TLSMode: SMTP_TLS_IMPLICIT, Password: "p"}).Conf
+	if conf.Host != DEFAULT_SMTP_HOST || conf.Port != 465 || conf.Auth != SMTP_AUTH_PLAIN || conf.Username != fakeUser {
+		t.Errorf("defaults %+v", conf)
+	}
+	conf = NewSmtpNotifier(SmtpConfig{From: fakeUser}).Conf
+	if conf.Port != DEFAULT_SMTP_PORT || conf.TLSMode != SMTP_TLS_STARTTLS || conf.Auth != SMTP_AUTH_NONE {
+		t.Errorf("defaults %+v", conf)
+	}
+}
@@ -0,0 +1,97 @@
+package report
+
+import (
+	"fmt"
+	"html/template"
+	"strings"
+)
+
+var sparkRunes = []rune("▁▂▃▄▅▆▇█")
+
+// 把点数压缩到最多n个, 取每段的最后一个点
+func sample(values []float64, n int) []float64 {
+	if len(values) <= n {
+		return values
+	}
+	res := make([]float64, n)
+	for i := range res {
+		res[i] = values[(i+1)*len(values)/n-1]
+	}
+	return res
+}
+
+func equityValues(points []EquityPoint) []float64 {
+	values := make([]float64, len(points))
+	for i, point := range points {
+		values[i] = point.Equity()
+	}
+	return values
+}
+
+func bounds(values []float64) (min, max float64) {
+	min, max = values[0], values[0]
+	for _, v := range values {
+		if v < min {
+			min = v
+		}
+		if v > max {
+			max = v
+		}
+	}
+	return min, max
+}
+
+// 纯文本资产曲线, 如 ▁▂▄▆█
+func Sparkline(points []EquityPoint) string {
+	if len(points) == 0 {
+		return ""
+	}
+	values := sample(equityValues(points), 48)
+	min, max := bounds(values)
+
+	var builder strings.Builder
+	for _, v := range values {
+		idx := 0
+		if max > min {
+			idx = int((v - min) / (max - min) * float64(len(sparkRunes)-1))
+		}
+		builder.WriteRune(sparkRunes[idx])
+	}
+	return builder.String()
+}
+
+const (
+	CHART_WIDTH  = 480
+	CHART_HEIGHT = 120
+	CHART_PAD    = 4
+)
+
+// 内嵌svg资产曲线
+func EquitySVG(points []EquityPoint) template.HTML {
+	if len(points) < 2 {
+		return ""
+	}
+	values := sample(equityValues(points), CHART_WIDTH/2)
+	min, max := bounds(values)
+
+	coords := make([]string, len(values))
+	for i, v := range values {
+		x := CHART_PAD + float64(i)*float64(CHART_WIDTH-2*CHART_PAD)/float64(len(values)-1)
+		y := float64(CHART_HEIGHT) / 2
+		if max > min {
+			y = CHART_PAD + (max-v)/(max-min)*float64(CHART_HEIGHT-2*CHART_PAD)
+		}
+		coords[i] = fmt.Sprintf("%.1f,%.1f", x, y)
+	}
+
+	// 只包含数字, 可以直接作为html输出
+	return template.HTML(fmt.Sprintf(
+		`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+
+			`<rect width="100%%" height="100%%" fill="#f7f7f7"/>`+
+			`<polyline fill="none" stroke="#2a7ae2" stroke-width="2" points="%s"/>`+
+			`<text x="%d" y="14" font-size="11" fill="#666">%.2f</text>`+
+			`<text x="%d" y="%d" font-size="11" fill="#666">%.2f</text>`+
+			`</svg>`,
+		CHART_WIDTH, CHART_HEIGHT, CHART_WIDTH, CHART_HEIGHT, strings.Join(coords, " "),
+		CHART_PAD+2, max, CHART_PAD+2, CHART_HEIGHT-CHART_PAD-2, min))
+}
@@ -0,0 +1,171 @@
+package report
+
+type defaultTemplate struct {
+	Text string
+	HTML string
+}
+
+// 内置模板, 可以复制到模板目录后修改
+var defaultTemplates = map[string]defaultTemplate{
+	TEMPLATE_REBALANCE: {Text: rebalanceText, HTML: rebalanceHTML},
+	TEMPLATE_TICKER:    {Text: tickerText, HTML: tickerHTML},
+	TEMPLATE_DIGEST:    {Text: digestText, HTML: digestHTML},
+}
+
+const rebalanceText = `{{if .Error}}REBALANCE {{upper .Coin}} FAILED !
+ERROR: {{.Error}}
+{{else}}{{.Action}} {{upper .Coin}} HAPPEND !
+{{end}}
+TIME: {{time .Time}}
+LOGID: {{.LogID}}
+{{- if .Action}}
+
+{{.Action}} INFO
+COIN: {{.Coin}}
+AMOUNT: {{f6 .Amount}}
+PRICE: {{f6 .Price}}
+ASSET: {{f4 .Asset}}
+{{- if .OrderID}}
+ORDER: {{.OrderID}}
+{{- end}}
+{{- end}}
+
+BALANCE          {{printf "%-16s" "BEFORE"}}{{if .After}}AFTER{{end}}
+PRICE            {{printf "%-16s" (f6 .Before.CoinPrice)}}{{with .After}}{{f6 .CoinPrice}}{{end}}
+{{printf "%-17s" (upper .Coin)}}{{printf "%-16s" (f4 .Before.CoinAmount)}}{{with .After}}{{f4 .CoinAmount}}{{end}}
+{{printf "%-17s" (printf "%s ASSET" (upper .Coin))}}{{printf "%-16s" (f4 .Before.CoinAsset)}}{{with .After}}{{f4 .CoinAsset}}{{end}}
+USDT             {{printf "%-16s" (f4 .Before.USDTAmount)}}{{with .After}}{{f4 .USDTAmount}}{{end}}
+TOTAL            {{printf "%-16s" (f4 .Before.Total)}}{{with .After}}{{f4 .Total}}{{end}}
+RATIO            {{printf "%-16s" (f4 .Before.Ratio)}}{{with .After}}{{f4 .Ratio}}{{end}}
+{{- if .Fills}}
+
+FILLS
+{{- range .Fills}}
+{{time .Time}}  {{f6 .Price}} x {{f6 .Amount}}  fee {{f6 .Fee}} {{.FeeCurrency}}
+{{- end}}
+FILLED: {{f6 .FilledAmount}} @ {{f6 .AvgPrice}}
+{{- $fees := .Fees}}
+FEES:{{range sortedKeys $fees}} {{f6 (index $fees .)}} {{.}}{{end}}
+{{- end}}
+{{- if .Equity}}
+
+EQUITY 24H: {{sparkline .Equity}}
+{{- end}}
+`
+
+const rebalanceHTML = `<html><body style="font-family: sans-serif">
+{{if .Error}}<h1>REBALANCE {{upper .Coin}} FAILED !</h1>
+<p style="color: #c00">{{.Error}}</p>
+{{else}}<h1>{{.Action}} {{upper .Coin}} HAPPEND !</h1>
+{{end}}<p>{{.Tag}} &middot; {{time .Time}} &middot; logid {{.LogID}}</p>
+{{if .Action}}<h2>{{.Action}} INFO</h2>
+<table cellpadding="4">
+<tr><td>COIN</td><td>{{.Coin}}</td></tr>
+<tr><td>AMOUNT</td><td>{{f6 .Amount}}</td></tr>
+<tr><td>PRICE</td><td>{{f6 .Price}}</td></tr>
+<tr><td>ASSET</td><td>{{f4 .Asset}}</td></tr>
+{{if .OrderID}}<tr><td>ORDER</td><td>{{.OrderID}}</td></tr>{{end}}
+</table>
+{{end}}<h2>BALANCE</h2>
+<table border="1" cellpadding="4" style="border-collapse: collapse">
+<tr><th></th><th>BEFORE</th>{{if .After}}<th>AFTER</th>{{end}}</tr>
+<tr><td>PRICE</td><td>{{f6 .Before.CoinPrice}}</td>{{with .After}}<td>{{f6 .CoinPrice}}</td>{{end}}</tr>
+<tr><td>{{upper .Coin}}</td><td>{{f4 .Before.CoinAmount}}</td>{{with .After}}<td>{{f4 .CoinAmount}}</td>{{end}}</tr>
+<tr><td>{{upper .Coin}} ASSET</td><td>{{f4 .Before.CoinAsset}}</td>{{with .After}}<td>{{f4 .CoinAsset}}</td>{{end}}</tr>
+<tr><td>USDT</td><td>{{f4 .Before.USDTAmount}}</td>{{with .After}}<td>{{f4 .USDTAmount}}</td>{{end}}</tr>
+<tr><td>TOTAL</td><td>{{f4 .Before.Total}}</td>{{with .After}}<td>{{f4 .Total}}</td>{{end}}</tr>
+<tr><td>RATIO</td><td>{{f4 .Before.Ratio}}</td>{{with .After}}<td>{{f4 .Ratio}}</td>{{end}}</tr>
+</table>
+{{if .Fills}}<h2>FILLS</h2>
+<table border="1" cellpadding="4" style="border-collapse: collapse">
+<tr><th>TIME</th><th>PRICE</th><th>AMOUNT</th><th>FEE</th></tr>
+{{range .Fills}}<tr><td>{{time .Time}}</td><td>{{f6 .Price}}</td><td>{{f6 .Amount}}</td><td>{{f6 .Fee}} {{.FeeCurrency}}</td></tr>
+{{end}}</table>
+<p>FILLED: {{f6 .FilledAmount}} @ {{f6 .AvgPrice}}<br>
+{{$fees := .Fees}}FEES:{{range sortedKeys $fees}} {{f6 (index $fees .)}} {{.}}{{end}}</p>
+{{end}}{{if .Equity}}<h2>EQUITY 24H</h2>
+{{chart .Equity}}
+{{end}}</body></html>
+`
+
+const tickerText = `{{.Head}}
+
+COIN: {{.Coin}}
+TIME: {{time .Time}}
+COIN AMOUNT: {{f6 .Balance.CoinAmount}}, COIN PRICE: {{f6 .Balance.CoinPrice}}
+COIN ASSET: {{f4 .Balance.CoinAsset}}, USDT ASSET: {{f4 .Balance.USDTAmount}}
+COIN / USDT RATIO: {{.Coin}}/usdt: {{f4 .Balance.Ratio}}
+
+TOTAL ASSET: {{f4 .Balance.Total}}
+{{- if .Equity}}
+
+EQUITY 24H: {{sparkline .Equity}}
+{{- end}}
+`
+
+const tickerHTML = `<html><body style="font-family: sans-serif">
+<h1>{{.Head}}</h1>
+<p>{{time .Time}}</p>
+<table border="1" cellpadding="4" style="border-collapse: collapse">
+<tr><td>COIN</td><td>{{.Coin}}</td></tr>
+<tr><td>PRICE</td><td>{{f6 .Balance.CoinPrice}}</td></tr>
+<tr><td>{{upper .Coin}}</td><td>{{f4 .Balance.CoinAmount}}</td></tr>
+<tr><td>{{upper .Coin}} ASSET</td><td>{{f4 .Balance.CoinAsset}}</td></tr>
+<tr><td>USDT</td><td>{{f4 .Balance.USDTAmount}}</td></tr>
+<tr><td>RATIO</td><td>{{f4 .Balance.Ratio}}</td></tr>
+<tr><td>TOTAL</td><td>{{f4 .Balance.Total}}</td></tr>
+</table>
+{{if .Equity}}<h2>EQUITY 24H</h2>
+{{chart .Equity}}
+{{end}}</body></html>
+`
+
+const digestText = `{{.Head}}
+
+{{upper .Period}} DIGEST {{.Coin}}: {{time .From}} ~ {{time .To}}
+{{if not .Points}}
+NO SNAPSHOT RECORDED IN THIS PERIOD
+{{- else}}
+EQUITY           {{f4 .Start.Total}} -> {{f4 .End.Total}}
+RETURN           {{pct .Return}}
+HODL RETURN      {{pct .HodlReturn}}
+VS HODL          {{pct .ExcessReturn}}
+MAX DRAWDOWN     {{percent .MaxDrawdown}}
+PRICE RANGE      {{f6 .PriceLow}} ~ {{f6 .PriceHigh}}
+PRICE            {{f6 .Start.CoinPrice}} -> {{f6 .End.CoinPrice}}
+{{printf "%-17s" (upper .Coin)}}{{f4 .Start.CoinAmount}} -> {{f4 .End.CoinAmount}}
+USDT             {{f4 .Start.USDTAmount}} -> {{f4 .End.USDTAmount}}
+{{- end}}
+REBALANCES       {{len .Rebalances}}
+{{- $fees := .Fees}}
+FEES            {{range sortedKeys $fees}} {{f6 (index $fees .)}} {{.}}{{else}} 0{{end}}
+{{- if .Equity}}
+
+EQUITY: {{sparkline .Equity}}
+{{- end}}
+`
+
+const digestHTML = `<html><body style="font-family: sans-serif">
+<h1>{{.Head}}</h1>
+<p>{{upper .Period}} DIGEST {{.Coin}}: {{time .From}} ~ {{time .To}}</p>
+{{if not .Points}}<p>NO SNAPSHOT RECORDED IN THIS PERIOD</p>
+{{else}}<table border="1" cellpadding="4" style="border-collapse: collapse">
+<tr><th></th><th>START</th><th>END</th></tr>
+<tr><td>PRICE</td><td>{{f6 .Start.CoinPrice}}</td><td>{{f6 .End.CoinPrice}}</td></tr>
+<tr><td>{{upper .Coin}}</td><td>{{f4 .Start.CoinAmount}}</td><td>{{f4 .End.CoinAmount}}</td></tr>
+<tr><td>USDT</td><td>{{f4 .Start.USDTAmount}}</td><td>{{f4 .End.USDTAmount}}</td></tr>
+<tr><td>EQUITY</td><td>{{f4 .Start.Total}}</td><td>{{f4 .End.Total}}</td></tr>
+</table>
+<table cellpadding="4">
+<tr><td>RETURN</td><td>{{pct .Return}}</td></tr>
+<tr><td>HODL RETURN</td><td>{{pct .HodlReturn}}</td></tr>
+<tr><td>VS HODL</td><td>{{pct .ExcessReturn}}</td></tr>
+<tr><td>MAX DRAWDOWN</td><td>{{percent .MaxDrawdown}}</td></tr>
+<tr><td>PRICE RANGE</td><td>{{f6 .PriceLow}} ~ {{f6 .PriceHigh}}</td></tr>
+</table>
+{{end}}<p>REBALANCES: {{len .Rebalances}}<br>
+{{$fees := .Fees}}FEES:{{range sortedKeys $fees}} {{f6 (index $fees .)}} {{.}}{{else}} 0{{end}}</p>
+{{if .Equity}}<h2>EQUITY</h2>
+{{chart .Equity}}
+{{end}}</body></html>
+`
@@ -0,0 +1,112 @@
+package report
+
+import (
+	"time"
+)
+
+const (
+	DIGEST_DAILY  = "daily"
+	DIGEST_WEEKLY = "weekly"
+)
+
+// 一段时间的汇总报告, 由History中的记录计算
+type Digest struct {
+	Head   string
+	Tag    string
+	Coin   string
+	Period string
+	From   time.Time
+	To     time.Time
+
+	// 区间内的第一个和最后一个点, 没有记录时Points为0
+	Points int
+	Start  Balance
+	End    Balance
+
+	Rebalances  []RebalanceRecord
+	Fees        map[string]float64
+	MaxDrawdown float64
+	PriceLow    float64
+	PriceHigh   float64
+
+	Equity []EquityPoint
+}
+
+// 区间为[from, to), 发送时间上的记录只计入下一次报告
+func NewDigest(h *History, period string, from time.Time, to time.Time) *Digest {
+	d := &Digest{
+		Period: period,
+		From:   from,
+		To:     to,
+		Fees:   make(map[string]float64),
+	}
+
+	for _, point := range h.Since(from) {
+		if !point.Time.Before(to) {
+			break
+		}
+		d.Equity = append(d.Equity, point)
+	}
+	for _, rec := range h.RebalancesSince(from) {
+		if !rec.Time.Before(to) {
+			break
+		}
+		d.Rebalances = append(d.Rebalances, rec)
+		for currency, fee := range rec.Fees {
+			d.Fees[currency] += fee
+		}
+	}
+
+	d.Points = len(d.Equity)
+	if d.Points == 0 {
+		return d
+	}
+	d.Start = d.Equity[0].Balance
+	d.End = d.Equity[d.Points-1].Balance
+
+	peak := 0.0
+	d.PriceLow, d.PriceHigh = d.Start.CoinPrice, d.Start.CoinPrice
+	for _, point := range d.Equity {
+		equity := point.Equity()
+		if equity > peak {
+			peak = equity
+		}
+		if peak > 0 && (peak-equity)/peak > d.MaxDrawdown {
+			d.MaxDrawdown = (peak - equity) / peak
+		}
+
+		price := point.Balance.CoinPrice
+		if price < d.PriceLow {
+			d.PriceLow = price
+		}
+		if price > d.PriceHigh {
+			d.PriceHigh = price
+		}
+	}
+	return d
+}
+
+// 区间收益率
+func (d *Digest) Return() float64 {
+	if d.Start.Total() == 0 {
+		return 0
+	}
+	return d.End.Total()/d.Start.Total() - 1
+}
+
+// 一直持有期初仓位不做再平衡时的期末资产
+func (d *Digest) HodlEquity() float64 {
+	return d.Start.CoinAmount*d.End.CoinPrice + d.Start.USDTAmount
+}
+
+func (d *Digest) HodlReturn() float64 {
+	if d.Start.Total() == 0 {
+		return 0
+	}
+	return d.HodlEquity()/d.Start.Total() - 1
+}
+
+// 相对HODL的超额收益
+func (d *Digest) ExcessReturn() float64 {
+	return d.Return() - d.HodlReturn()
+}
@@ -0,0 +1,112 @@
+package report
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+var digestBase = time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)
+
+// 第i小时的时间
+func hour(i int) time.Time {
+	return digestBase.Add(time.Duration(i) * time.Hour)
+}
+
+// 固定的资产曲线: 涨到220后回撤到190, 第3小时再平衡买入, 之后涨到212
+func digestHistory() *History {
+	h := NewHistory()
+	balances := []Balance{
+		{CoinPrice: 1.0, CoinAmount: 100, USDTAmount: 100},
+		{CoinPrice: 1.2, CoinAmount: 100, USDTAmount: 100},
+		{CoinPrice: 0.9, CoinAmount: 100, USDTAmount: 100},
+		{CoinPrice: 0.9, CoinAmount: 110, USDTAmount: 91},
+		{CoinPrice: 1.1, CoinAmount: 110, USDTAmount: 91},
+	}
+	for i, balance := range balances {
+		h.Add(EquityPoint{Time: hour(i), Balance: balance})
+	}
+	h.AddRebalance(RebalanceRecord{Time: hour(3), Action: "buy", Price: 0.9, Amount: 10, Fees: map[string]float64{"usdt": 0.2}})
+	h.AddRebalance(RebalanceRecord{Time: hour(4), Action: "sell", Price: 1.1, Amount: 1, Fees: map[string]float64{"usdt": 0.1, "ada": 0.01}})
+	return h
+}
+
+func floatEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestNewDigest(t *testing.T) {
+	h := digestHistory()
+	cases := []struct {
+		name       string
+		from, to   time.Time
+		points     int
+		rebalances int
+		usdtFee    float64
+		drawdown   float64
+		ret        float64
+		hodl       float64
+		low, high  float64
+	}{
+		{"whole history", hour(0), hour(5), 5, 2, 0.3, 30.0 / 220, 212.0/200 - 1, 210.0/200 - 1, 0.9, 1.2},
+		{"to is exclusive", hour(0), hour(4), 4, 1, 0.2, 30.0 / 220, 190.0/200 - 1, 190.0/200 - 1, 0.9, 1.2},
+		{"from is inclusive", hour(1), hour(3), 2, 0, 0, 30.0 / 220, 190.0/220 - 1, 190.0/220 - 1, 0.9, 1.2},
+		{"no drawdown after the low", hour(2), hour(5), 3, 2, 0.3, 0, 212.0/190 - 1, 210.0/190 - 1, 0.9, 1.1},
+		{"single point", hour(0), hour(1), 1, 0, 0, 0, 0, 0, 1.0, 1.0},
+		{"empty", hour(5), hour(6), 0, 0, 0, 0, 0, 0, 0, 0},
+		{"from after to", hour(3), hour(2), 0, 0, 0, 0, 0, 0, 0, 0},
+	}
+	for _, c := range cases {
+		d := NewDigest(h, DIGEST_DAILY, c.from, c.to)
+		if d.Points != c.points || len(d.Rebalances) != c.rebalances {
+			t.Errorf("%s: points %d rebalances %d, want %d %d", c.name, d.Points, len(d.Rebalances), c.points, c.rebalances)
+		}
+		if !floatEqual(d.Fees["usdt"], c.usdtFee) {
+			t.Errorf("%s: usdt fee %v, want %v", c.name, d.Fees["usdt"], c.usdtFee)
+		}
+		if !floatEqual(d.MaxDrawdown, c.drawdown) {
+			t.Errorf("%s: max drawdown %v, want %v", c.name, d.MaxDrawdown, c.drawdown)
+		}
+		if !floatEqual(d.Return(), c.ret) || !floatEqual(d.HodlReturn(), c.hodl) {
+			t.Errorf("%s: return %v hodl %v, want %v %v", c.name, d.Return(), d.HodlReturn(), c.ret, c.hodl)
+		}
+		if !floatEqual(d.ExcessReturn(), c.ret-c.hodl) {
+			t.Errorf("%s: excess return %v, want %v", c.name, d.ExcessReturn(), c.ret-c.hodl)
+		}
+		if d.PriceLow != c.low || d.PriceHigh != c.high {
+			t.Errorf("%s: price %v-%v, want %v-%v", c.name, d.PriceLow, d.PriceHigh, c.low, c.high)
+		}
+	}
+}
+
+func TestDigestHodl(t *testing.T) {
+	d := NewDigest(digestHistory(), DIGEST_WEEKLY, hour(0), hour(5))
+	// 期初100币+100usdt, 期末价格1.1
+	if !floatEqual(d.HodlEquity(), 210) {
+		t.Errorf("hodl equity %v, want 210", d.HodlEquity())
+	}
+	if d.Start.Total() != 200 || !floatEqual(d.End.Total(), 212) {
+		t.Errorf("start %v end %v, want 200 212", d.Start.Total(), d.End.Total())
+	}
+	if !floatEqual(d.ExcessReturn(), 0.01) {
+		t.Errorf("excess return %v, want 0.01", d.ExcessReturn())
+	}
+}
+
+// 相邻两次报告不能重复统计边界上的点和再平衡
+func TestDigestAdjacentPeriods(t *testing.T) {
+	h := digestHistory()
+	for split := 0; split <= 5; split++ {
+		first := NewDigest(h, DIGEST_DAILY, hour(0), hour(split))
+		second := NewDigest(h, DIGEST_DAILY, hour(split), hour(5))
+		if points := first.Points + second.Points; points != 5 {
+			t.Errorf("split at %d: %d points, want 5", split, points)
+		}
+		if n := len(first.Rebalances) + len(second.Rebalances); n != 2 {
+			t.Errorf("split at %d: %d rebalances, want 2", split, n)
+		}
+		if fee := first.Fees["usdt"] + second.Fees["usdt"]; !floatEqual(fee, 0.3) {
+			t.Errorf("split at %d: usdt fee %v, want 0.3", split, fee)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package report
+
+import (
+	"bufio"
+	"encoding/json"
+	"korok"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	HISTORY_WINDOW   = 24     //h, 报告中资产曲线的长度
+	HISTORY_KEEP     = 8 * 24 //h, 周报需要最近7天的记录
+	HISTORY_INTERVAL = 60     //s
+)
+
+// 一次再平衡的记录, 用于统计次数和手续费
+type RebalanceRecord struct {
+	Time   time.Time
+	Action string
+	Price  float64
+	Amount float64
+	Fees   map[string]float64
+}
+
+// 记录文件中的一行
+type record struct {
+	Point     *EquityPoint     `json:",omitempty"`
+	Rebalance *RebalanceRecord `json:",omitempty"`
+}
+
+// 只在内存中记录的History
+func NewHistory() *History {
+	return &History{
+		Keep:     time.Duration(HISTORY_KEEP) * time.Hour,
+		Interval: time.Duration(HISTORY_INTERVAL) * time.Second,
+	}
+}
+
+// 打开记录文件, 加载最近HISTORY_KEEP内的记录, 之后的记录追加到文件中
+// 过期的记录在打开时清理
+func OpenHistory(path string) (*History, error) {
+	h := NewHistory()
+
+	err := h.load(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	// 重写文件, 去掉过期记录
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	h.file = file
+	for i := range h.points {
+		h.writeWithoutLock(&record{Point: &h.points[i]})
+	}
+	for i := range h.rebalances {
+		h.writeWithoutLock(&record{Rebalance: &h.rebalances[i]})
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	h.path = path
+	return h, nil
+}
+
+// 资产和再平衡的历史记录, 资产每Interval最多记录一个点, 保留Keep
+type History struct {
+	Keep     time.Duration
+	Interval time.Duration
+
+	mu         sync.Mutex
+	points     []EquityPoint
+	rebalances []RebalanceRecord
+
+	path string
+	file *os.File
+}
+
+func (h *History) load(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	since := time.Now().Add(-h.Keep)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		rec := &record{}
+		if err := json.Unmarshal(scanner.Bytes(), rec); err != nil {
+			// 进程退出时可能写了半行
+			korok.Warn("[History] %s skip broken line: %s", path, err)
+			continue
+		}
+		if rec.Point != nil && rec.Point.Time.After(since) {
+			h.points = append(h.points, *rec.Point)
+		}
+		if rec.Rebalance != nil && rec.Rebalance.Time.After(since) {
+			h.rebalances = append(h.rebalances, *rec.Rebalance)
+		}
+	}
+	return scanner.Err()
+}
+
+func (h *History) writeWithoutLock(rec *record) {
+	if h.file == nil {
+		return
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		korok.Error("[History] marshal record failed: %s", err)
+		return
+	}
+	if _, err := h.file.Write(append(line, '\n')); err != nil {
+		korok.Error("[History] write %s failed: %s", h.path, err)
+	}
+}
+
+// 记录一个点, 距上一个点不足Interval时忽略, 返回是否记录
+func (h *History) Add(point EquityPoint) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if n := len(h.points); n > 0 && point.Time.Sub(h.points[n-1].Time) < h.Interval {
+		return false
+	}
+	h.points = append(h.points, point)
+	h.writeWithoutLock(&record{Point: &point})
+
+	expired := 0
+	for expired < len(h.points) && point.Time.Sub(h.points[expired].Time) > h.Keep {
+		expired++
+	}
+	if expired > 0 {
+		h.points = append(h.points[:0], h.points[expired:]...)
+	}
+	return true
+}
+
+func (h *History) AddRebalance(rec RebalanceRecord) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.rebalances = append(h.rebalances, rec)
+	h.writeWithoutLock(&record{Rebalance: &rec})
+
+	expired := 0
+	for expired < len(h.rebalances) && rec.Time.Sub(h.rebalances[expired].Time) > h.Keep {
+		expired++
+	}
+	if expired > 0 {
+		h.rebalances = append(h.rebalances[:0], h.rebalances[expired:]...)
+	}
+}
+
+// since之后的所有点
+func (h *History) Since(since time.Time) []EquityPoint {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var res []EquityPoint
+	for _, point := range h.points {
+		if !point.Time.Before(since) {
+			res = append(res, point)
+		}
+	}
+	return res
+}
+
+// since之后的所有再平衡
+func (h *History) RebalancesSince(since time.Time) []RebalanceRecord {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var res []RebalanceRecord
+	for _, rec := range h.rebalances {
+		if !rec.Time.Before(since) {
+			res = append(res, rec)
+		}
+	}
+	return res
+}
+
+// 关闭记录文件
+func (h *History) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.file == nil {
+		return nil
+	}
+	err := h.file.Close()
+	h.file = nil
+	return err
+}
@@ -0,0 +1,113 @@
+package report
+
+import (
+	"time"
+)
+
+// 某一时刻的持仓
+type Balance struct {
+	CoinPrice  float64
+	CoinAmount float64
+	USDTAmount float64
+}
+
+func (b Balance) CoinAsset() float64 {
+	return b.CoinAmount * b.CoinPrice
+}
+
+func (b Balance) Total() float64 {
+	return b.CoinAsset() + b.USDTAmount
+}
+
+// 币/usdt资产比例
+func (b Balance) Ratio() float64 {
+	if b.USDTAmount == 0 {
+		return 0
+	}
+	return b.CoinAsset() / b.USDTAmount
+}
+
+// 一笔成交
+type Fill struct {
+	Time        time.Time
+	Price       float64
+	Amount      float64
+	Fee         float64
+	FeeCurrency string
+}
+
+// 再平衡报告
+type RebalanceReport struct {
+	LogID  uint32 // 本次再平衡的日志都带有这个logid
+	Tag    string
+	Coin   string
+	Time   time.Time
+	Action string // SELL, BUY
+
+	// 下单时的计划
+	Price   float64
+	Amount  float64
+	Asset   float64
+	OrderID string
+
+	Before Balance
+	After  *Balance // 下单后查询到的持仓, 查询失败时为nil
+	Fills  []Fill
+
+	Error string // 不为空时表示再平衡失败
+
+	Equity []EquityPoint // 最近24小时的资产
+}
+
+func (r *RebalanceReport) FilledAmount() (amount float64) {
+	for _, fill := range r.Fills {
+		amount += fill.Amount
+	}
+	return amount
+}
+
+func (r *RebalanceReport) FilledAsset() (asset float64) {
+	for _, fill := range r.Fills {
+		asset += fill.Amount * fill.Price
+	}
+	return asset
+}
+
+// 成交均价
+func (r *RebalanceReport) AvgPrice() float64 {
+	amount := r.FilledAmount()
+	if amount == 0 {
+		return 0
+	}
+	return r.FilledAsset() / amount
+}
+
+// 按币种汇总手续费
+func (r *RebalanceReport) Fees() map[string]float64 {
+	fees := make(map[string]float64)
+	for _, fill := range r.Fills {
+		fees[fill.FeeCurrency] += fill.Fee
+	}
+	return fees
+}
+
+// 行情/持仓报告
+type TickerReport struct {
+	Head    string
+	Tag     string
+	Coin    string
+	Time    time.Time
+	Balance Balance
+
+	Equity []EquityPoint
+}
+
+// 资产曲线上的一个点
+type EquityPoint struct {
+	Time    time.Time
+	Balance Balance
+}
+
+func (p EquityPoint) Equity() float64 {
+	return p.Balance.Total()
+}
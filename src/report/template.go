@@ -0,0 +1,131 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+	"time"
+)
+
+// 模板名, 模板目录下同名的 .txt / .html 文件覆盖内置模板
+const (
+	TEMPLATE_REBALANCE = "rebalance"
+	TEMPLATE_TICKER    = "ticker"
+	TEMPLATE_DIGEST    = "digest"
+)
+
+var (
+	templatesMu   sync.RWMutex
+	textTemplates = map[string]*texttemplate.Template{}
+	htmlTemplates = map[string]*htmltemplate.Template{}
+)
+
+var funcs = map[string]interface{}{
+	"f2": func(v float64) string { return fmt.Sprintf("%.2f", v) },
+	"f4": func(v float64) string { return fmt.Sprintf("%.4f", v) },
+	"f6": func(v float64) string { return fmt.Sprintf("%.6f", v) },
+	"pct": func(v float64) string {
+		return fmt.Sprintf("%+.2f%%", v*100)
+	},
+	"percent": func(v float64) string {
+		return fmt.Sprintf("%.2f%%", v*100)
+	},
+	"time": func(t time.Time) string {
+		return t.Format("2006-01-02 15:04:05")
+	},
+	"upper":     strings.ToUpper,
+	"sparkline": Sparkline,
+	"chart":     EquitySVG,
+	"sortedKeys": func(m map[string]float64) []string {
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		return keys
+	},
+}
+
+func init() {
+	if err := Init(""); err != nil {
+		panic(err)
+	}
+}
+
+// 加载模板, dir为空时只使用内置模板
+// dir下存在 <name>.txt / <name>.html 时覆盖对应的内置模板
+func Init(dir string) error {
+	texts := map[string]*texttemplate.Template{}
+	htmls := map[string]*htmltemplate.Template{}
+
+	for name, def := range defaultTemplates {
+		textSrc, err := readTemplate(dir, name+".txt", def.Text)
+		if err != nil {
+			return err
+		}
+		t, err := texttemplate.New(name).Funcs(funcs).Parse(textSrc)
+		if err != nil {
+			return fmt.Errorf("parse template %s.txt: %s", name, err)
+		}
+		texts[name] = t
+
+		htmlSrc, err := readTemplate(dir, name+".html", def.HTML)
+		if err != nil {
+			return err
+		}
+		h, err := htmltemplate.New(name).Funcs(funcs).Parse(htmlSrc)
+		if err != nil {
+			return fmt.Errorf("parse template %s.html: %s", name, err)
+		}
+		htmls[name] = h
+	}
+
+	templatesMu.Lock()
+	defer templatesMu.Unlock()
+	textTemplates = texts
+	htmlTemplates = htmls
+	return nil
+}
+
+func readTemplate(dir string, file string, def string) (string, error) {
+	if dir == "" {
+		return def, nil
+	}
+	content, err := ioutil.ReadFile(filepath.Join(dir, file))
+	if os.IsNotExist(err) {
+		return def, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+// 用模板渲染报告, 返回纯文本和html正文
+func Render(name string, data interface{}) (text string, html string, err error) {
+	templatesMu.RLock()
+	t, h := textTemplates[name], htmlTemplates[name]
+	templatesMu.RUnlock()
+	if t == nil || h == nil {
+		return "", "", fmt.Errorf("template %s not found", name)
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", "", fmt.Errorf("render %s.txt: %s", name, err)
+	}
+	text = buf.String()
+
+	buf.Reset()
+	if err := h.Execute(&buf, data); err != nil {
+		return "", "", fmt.Errorf("render %s.html: %s", name, err)
+	}
+	return text, buf.String(), nil
+}
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strconv"
@@ -19,11 +20,12 @@ import (
 // 交易API
 
 // 获取K线数据
+// ctx: 请求的context
 // strSymbol: 交易对, btcusdt, bccbtc......
 // strPeriod: K线类型, 1min, 5min, 15min......
 // nSize: 获取数量, [1-2000]
 // return: KLineReturn 对象
-func GetKLine(strSymbol, strPeriod string, nSize int) (models.KLineReturn, error) {
+func GetKLine(ctx context.Context, strSymbol, strPeriod string, nSize int) (models.KLineReturn, error) {
 	kLineReturn := models.KLineReturn{}
 
 	mapParams := make(map[string]string)
@@ -34,19 +36,20 @@ func GetKLine(strSymbol, strPeriod string, nSize int) (models.KLineReturn, error
 	strRequestUrl := "/market/history/kline"
 	strUrl := config.MARKET_URL + strRequestUrl
 
-	jsonKLineReturn := untils.HttpGetRequest(strUrl, mapParams)
+	jsonKLineReturn := untils.HttpGetRequest(ctx, strUrl, mapParams)
 	err := json.Unmarshal([]byte(jsonKLineReturn), &kLineReturn)
 	if err != nil {
-		korok.Fatal("GetKLine json Unmarshal Failed. json: %s", kLineReturn)
+		korok.ErrorCtx(ctx, "GetKLine json Unmarshal Failed. json: %s", jsonKLineReturn)
 	}
 
 	return kLineReturn, err
 }
 
 // 获取聚合行情
+// ctx: 请求的context
 // strSymbol: 交易对, btcusdt, bccbtc......
 // return: TickReturn对象
-func GetTicker(strSymbol string) models.TickerReturn {
+func GetTicker(ctx context.Context, strSymbol string) models.TickerReturn {
 	tickerReturn := models.TickerReturn{}
 
 	mapParams := make(map[string]string)
@@ -55,17 +58,18 @@ func GetTicker(strSymbol string) models.TickerReturn {
 	strRequestUrl := "/market/detail/merged"
 	strUrl := config.MARKET_URL + strRequestUrl
 
-	jsonTickReturn := untils.HttpGetRequest(strUrl, mapParams)
+	jsonTickReturn := untils.HttpGetRequest(ctx, strUrl, mapParams)
 	json.Unmarshal([]byte(jsonTickReturn), &tickerReturn)
 
 	return tickerReturn
 }
 
 // 获取交易深度信息
+// ctx: 请求的context
 // strSymbol: 交易对, btcusdt, bccbtc......
 // strType: Depth类型, step0、step1......stpe5 (合并深度0-5, 0时不合并)
 // return: MarketDepthReturn对象
-func GetMarketDepth(strSymbol, strType string) models.MarketDepthReturn {
+func GetMarketDepth(ctx context.Context, strSymbol, strType string) models.MarketDepthReturn {
 	marketDepthReturn := models.MarketDepthReturn{}
 
 	mapParams := make(map[string]string)
@@ -75,16 +79,17 @@ func GetMarketDepth(strSymbol, strType string) models.MarketDepthReturn {
 	strRequestUrl := "/market/depth"
 	strUrl := config.MARKET_URL + strRequestUrl
 
-	jsonMarketDepthReturn := untils.HttpGetRequest(strUrl, mapParams)
+	jsonMarketDepthReturn := untils.HttpGetRequest(ctx, strUrl, mapParams)
 	json.Unmarshal([]byte(jsonMarketDepthReturn), &marketDepthReturn)
 
 	return marketDepthReturn
 }
 
 // 获取交易细节信息
+// ctx: 请求的context
 // strSymbol: 交易对, btcusdt, bccbtc......
 // return: TradeDetailReturn对象
-func GetTradeDetail(strSymbol string) models.TradeDetailReturn {
+func GetTradeDetail(ctx context.Context, strSymbol string) models.TradeDetailReturn {
 	tradeDetailReturn := models.TradeDetailReturn{}
 
 	mapParams := make(map[string]string)
@@ -93,17 +98,18 @@ func GetTradeDetail(strSymbol string) models.TradeDetailReturn {
 	strRequestUrl := "/market/trade"
 	strUrl := config.MARKET_URL + strRequestUrl
 
-	jsonTradeDetailReturn := untils.HttpGetRequest(strUrl, mapParams)
+	jsonTradeDetailReturn := untils.HttpGetRequest(ctx, strUrl, mapParams)
 	json.Unmarshal([]byte(jsonTradeDetailReturn), &tradeDetailReturn)
 
 	return tradeDetailReturn
 }
 
 // 批量获取最近的交易记录
+// ctx: 请求的context
 // strSymbol: 交易对, btcusdt, bccbtc......
 // nSize: 获取交易记录的数量, 范围1-2000
 // return: TradeReturn对象
-func GetTrade(strSymbol string, nSize int) models.TradeReturn {
+func GetTrade(ctx context.Context, strSymbol string, nSize int) models.TradeReturn {
 	tradeReturn := models.TradeReturn{}
 
 	mapParams := make(map[string]string)
@@ -113,16 +119,17 @@ func GetTrade(strSymbol string, nSize int) models.TradeReturn {
 	strRequestUrl := "/market/history/trade"
 	strUrl := config.MARKET_URL + strRequestUrl
 
-	jsonTradeReturn := untils.HttpGetRequest(strUrl, mapParams)
+	jsonTradeReturn := untils.HttpGetRequest(ctx, strUrl, mapParams)
 	json.Unmarshal([]byte(jsonTradeReturn), &tradeReturn)
 
 	return tradeReturn
 }
 
 // 获取Market Detail 24小时成交量数据
+// ctx: 请求的context
 // strSymbol: 交易对, btcusdt, bccbtc......
 // return: MarketDetailReturn对象
-func GetMarketDetail(strSymbol string) models.MarketDetailReturn {
+func GetMarketDetail(ctx context.Context, strSymbol string) models.MarketDetailReturn {
 	marketDetailReturn := models.MarketDetailReturn{}
 
 	mapParams := make(map[string]string)
@@ -131,7 +138,7 @@ func GetMarketDetail(strSymbol string) models.MarketDetailReturn {
 	strRequestUrl := "/market/detail"
 	strUrl := config.MARKET_URL + strRequestUrl
 
-	jsonMarketDetailReturn := untils.HttpGetRequest(strUrl, mapParams)
+	jsonMarketDetailReturn := untils.HttpGetRequest(ctx, strUrl, mapParams)
 	json.Unmarshal([]byte(jsonMarketDetailReturn), &marketDetailReturn)
 
 	return marketDetailReturn
@@ -141,42 +148,45 @@ func GetMarketDetail(strSymbol string) models.MarketDetailReturn {
 // 公共API
 
 // 查询系统支持的所有交易及精度
+// ctx: 请求的context
 // return: SymbolsReturn对象
-func GetSymbols() models.SymbolsReturn {
+func GetSymbols(ctx context.Context) models.SymbolsReturn {
 	symbolsReturn := models.SymbolsReturn{}
 
 	strRequestUrl := "/v1/common/symbols"
 	strUrl := config.TRADE_URL + strRequestUrl
 
-	jsonSymbolsReturn := untils.HttpGetRequest(strUrl, nil)
+	jsonSymbolsReturn := untils.HttpGetRequest(ctx, strUrl, nil)
 	json.Unmarshal([]byte(jsonSymbolsReturn), &symbolsReturn)
 
 	return symbolsReturn
 }
 
 // 查询系统支持的所有币种
+// ctx: 请求的context
 // return: CurrencysReturn对象
-func GetCurrencys() models.CurrencysReturn {
+func GetCurrencys(ctx context.Context) models.CurrencysReturn {
 	currencysReturn := models.CurrencysReturn{}
 
 	strRequestUrl := "/v1/common/currencys"
 	strUrl := config.TRADE_URL + strRequestUrl
 
-	jsonCurrencysReturn := untils.HttpGetRequest(strUrl, nil)
+	jsonCurrencysReturn := untils.HttpGetRequest(ctx, strUrl, nil)
 	json.Unmarshal([]byte(jsonCurrencysReturn), &currencysReturn)
 
 	return currencysReturn
 }
 
 // 查询系统当前时间戳
+// ctx: 请求的context
 // return: TimestampReturn对象
-func GetTimestamp() models.TimestampReturn {
+func GetTimestamp(ctx context.Context) models.TimestampReturn {
 	timestampReturn := models.TimestampReturn{}
 
 	strRequest := "/v1/common/timestamp"
 	strUrl := config.TRADE_URL + strRequest
 
-	jsonTimestampReturn := untils.HttpGetRequest(strUrl, nil)
+	jsonTimestampReturn := untils.HttpGetRequest(ctx, strUrl, nil)
 	json.Unmarshal([]byte(jsonTimestampReturn), &timestampReturn)
 
 	return timestampReturn
@@ -186,33 +196,35 @@ func GetTimestamp() models.TimestampReturn {
 // 用户资产API
 
 // 查询当前用户的所有账户, 根据包含的私钥查询
+// ctx: 请求的context
 // return: AccountsReturn对象
-func GetAccounts() (models.AccountsReturn, error) {
+func GetAccounts(ctx context.Context) (models.AccountsReturn, error) {
 	accountsReturn := models.AccountsReturn{}
 
 	strRequest := "/v1/account/accounts"
-	jsonAccountsReturn := untils.ApiKeyGet(make(map[string]string), strRequest)
+	jsonAccountsReturn := untils.ApiKeyGet(ctx, make(map[string]string), strRequest)
 	err := json.Unmarshal([]byte(jsonAccountsReturn), &accountsReturn)
 
 	if err != nil {
-		korok.Fatal("GetAccounts json Unmarshal Failed. json: %s", jsonAccountsReturn)
+		korok.ErrorCtx(ctx, "GetAccounts json Unmarshal Failed. json: %s", jsonAccountsReturn)
 	}
 
 	return accountsReturn, err
 }
 
 // 根据账户ID查询账户余额
+// ctx: 请求的context
 // nAccountID: 账户ID, 不知道的话可以通过GetAccounts()获取, 可以只现货账户, C2C账户, 期货账户
 // return: BalanceReturn对象
-func GetAccountBalance(strAccountID string) (models.BalanceReturn, error) {
+func GetAccountBalance(ctx context.Context, strAccountID string) (models.BalanceReturn, error) {
 	balanceReturn := models.BalanceReturn{}
 
 	strRequest := fmt.Sprintf("/v1/account/accounts/%s/balance", strAccountID)
-	jsonBanlanceReturn := untils.ApiKeyGet(make(map[string]string), strRequest)
+	jsonBanlanceReturn := untils.ApiKeyGet(ctx, make(map[string]string), strRequest)
 	err := json.Unmarshal([]byte(jsonBanlanceReturn), &balanceReturn)
 
 	if err != nil {
-		korok.Fatal("GetAccountBalance json Unmarshal Faild. json: %s", jsonBanlanceReturn)
+		korok.ErrorCtx(ctx, "GetAccountBalance json Unmarshal Faild. json: %s", jsonBanlanceReturn)
 	}
 
 	return balanceReturn, err
@@ -222,9 +234,10 @@ func GetAccountBalance(strAccountID string) (models.BalanceReturn, error) {
 // 交易API
 
 // 下单
+// ctx: 请求的context
 // placeRequestParams: 下单信息
 // return: PlaceReturn对象
-func Place(placeRequestParams models.PlaceRequestParams) (models.PlaceReturn, error) {
+func Place(ctx context.Context, placeRequestParams models.PlaceRequestParams) (models.PlaceReturn, error) {
 	placeReturn := models.PlaceReturn{}
 
 	mapParams := make(map[string]string)
@@ -240,23 +253,41 @@ func Place(placeRequestParams models.PlaceRequestParams) (models.PlaceReturn, er
 	mapParams["type"] = placeRequestParams.Type
 
 	strRequest := "/v1/order/orders/place"
-	jsonPlaceReturn := untils.ApiKeyPost(mapParams, strRequest)
+	jsonPlaceReturn := untils.ApiKeyPost(ctx, mapParams, strRequest)
 	err := json.Unmarshal([]byte(jsonPlaceReturn), &placeReturn)
 	if err != nil {
-		korok.Fatal("Place json Unmarshal Failed. json: %s", jsonPlaceReturn)
+		korok.ErrorCtx(ctx, "Place json Unmarshal Failed. json: %s", jsonPlaceReturn)
 	}
 
 	return placeReturn, err
 }
 
+// 查询某个订单的成交明细
+// ctx: 请求的context
+// strOrderID: 订单ID
+// return: MatchResultsReturn对象
+func GetMatchResults(ctx context.Context, strOrderID string) (models.MatchResultsReturn, error) {
+	matchResultsReturn := models.MatchResultsReturn{}
+
+	strRequest := fmt.Sprintf("/v1/order/orders/%s/matchresults", strOrderID)
+	jsonMatchResultsReturn := untils.ApiKeyGet(ctx, make(map[string]string), strRequest)
+	err := json.Unmarshal([]byte(jsonMatchResultsReturn), &matchResultsReturn)
+	if err != nil {
+		korok.ErrorCtx(ctx, "GetMatchResults json Unmarshal Failed. json: %s", jsonMatchResultsReturn)
+	}
+
+	return matchResultsReturn, err
+}
+
 // 申请撤销一个订单请求
+// ctx: 请求的context
 // strOrderID: 订单ID
 // return: PlaceReturn对象
-func SubmitCancel(strOrderID string) models.PlaceReturn {
+func SubmitCancel(ctx context.Context, strOrderID string) models.PlaceReturn {
 	placeReturn := models.PlaceReturn{}
 
 	strRequest := fmt.Sprintf("/v1/order/orders/%s/submitcancel", strOrderID)
-	jsonPlaceReturn := untils.ApiKeyPost(make(map[string]string), strRequest)
+	jsonPlaceReturn := untils.ApiKeyPost(ctx, make(map[string]string), strRequest)
 	json.Unmarshal([]byte(jsonPlaceReturn), &placeReturn)
 
 	return placeReturn
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"korok"
+	"untils"
+)
+
+const (
+	TIME_SYNC_INTERVAL = 10   // min
+	TIME_SYNC_TIMEOUT  = 5000 // ms
+	TIME_DRIFT_WARN    = 1000 // ms
+)
+
+// 用交易所时间戳校正本地时钟偏差
+// ctx: 请求的context
+// return: 本地时钟与交易所时钟的偏差, 交易所时间 = 本地时间 + 偏差
+func SyncServerTime(ctx context.Context) (time.Duration, error) {
+	before := time.Now()
+	timestampReturn := GetTimestamp(ctx)
+	after := time.Now()
+
+	if timestampReturn.Status != "ok" {
+		return 0, errors.New(fmt.Sprintf("GetTimestamp Failed with ErrCode: %s, ErrMsg: %s", timestampReturn.ErrCode, timestampReturn.ErrMsg))
+	}
+
+	// 假设请求往返耗时对称, 以中点作为交易所生成时间戳时的本地时间
+	local := before.Add(after.Sub(before) / 2)
+	server := time.Unix(0, timestampReturn.Data*int64(time.Millisecond))
+	offset := server.Sub(local)
+
+	untils.SetServerTimeOffset(offset)
+
+	drift := offset
+	if drift < 0 {
+		drift = -drift
+	}
+	if drift > time.Duration(TIME_DRIFT_WARN)*time.Millisecond {
+		korok.WarnCtx(ctx, "[Time Sync] local clock drift %v from exchange, rtt: %v", offset, after.Sub(before))
+	} else {
+		korok.InfoCtx(ctx, "[Time Sync] local clock offset %v, rtt: %v", offset, after.Sub(before))
+	}
+
+	return offset, nil
+}
+
+// 定期校正本地时钟偏差
+func RunTimeSyncRoutine() {
+	go func() {
+		clocker := time.NewTicker(time.Duration(TIME_SYNC_INTERVAL) * time.Minute)
+		for {
+			select {
+			case <-clocker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), time.Duration(TIME_SYNC_TIMEOUT)*time.Millisecond)
+				if _, err := SyncServerTime(ctx); err != nil {
+					korok.Error("SyncServerTime Failed: %s", err)
+				}
+				cancel()
+			}
+		}
+	}()
+}
@@ -0,0 +1,31 @@
+package untils
+
+import (
+	"context"
+
+	"config"
+)
+
+// API密钥, 多账户时每个实例使用自己的密钥签名
+type Credential struct {
+	AccessKey string
+	SecretKey string
+}
+
+type credentialKey struct{}
+
+// 把密钥放入ctx, 之后通过该ctx发出的签名请求都使用这个密钥
+func WithCredential(ctx context.Context, cred *Credential) context.Context {
+	return context.WithValue(ctx, credentialKey{}, cred)
+}
+
+// 从ctx中取出密钥, 没有时使用全局配置的密钥
+func CredentialFromContext(ctx context.Context) *Credential {
+	if cred, ok := ctx.Value(credentialKey{}).(*Credential); ok && cred != nil {
+		return cred
+	}
+	return &Credential{
+		AccessKey: config.ACCESS_KEY,
+		SecretKey: config.SECRET_KEY,
+	}
+}
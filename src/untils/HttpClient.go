@@ -0,0 +1,129 @@
+package untils
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	DEFAULT_HTTP_TIMEOUT = 10000 //ms
+)
+
+var (
+	clientMu    sync.RWMutex
+	httpClient  = NewHttpClient(nil)
+	httpTimeout = time.Duration(DEFAULT_HTTP_TIMEOUT) * time.Millisecond
+)
+
+// 构建复用连接的Http Client
+// proxyUrl: 代理地址, 为nil时使用环境变量HTTP_PROXY/HTTPS_PROXY
+// return: Http Client
+func NewHttpClient(proxyUrl *url.URL) *http.Client {
+	proxy := http.ProxyFromEnvironment
+	if proxyUrl != nil {
+		proxy = http.ProxyURL(proxyUrl)
+	}
+
+	transport := &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   5 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          20,
+		MaxIdleConnsPerHost:   10,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ResponseHeaderTimeout: 10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+
+	return &http.Client{Transport: transport}
+}
+
+// 初始化全局Http Client
+// strProxy: 代理地址, 如 http://127.0.0.1:1087, 为空时使用环境变量
+// timeoutMs: 未设置deadline的请求的默认超时时间, 单位毫秒, <=0时使用默认值
+func InitHttpClient(strProxy string, timeoutMs int) error {
+	var proxyUrl *url.URL
+	if strProxy != "" {
+		u, err := url.Parse(strProxy)
+		if err != nil {
+			return err
+		}
+		proxyUrl = u
+	}
+
+	timeout := time.Duration(DEFAULT_HTTP_TIMEOUT) * time.Millisecond
+	if timeoutMs > 0 {
+		timeout = time.Duration(timeoutMs) * time.Millisecond
+	}
+
+	clientMu.Lock()
+	defer clientMu.Unlock()
+	httpClient = NewHttpClient(proxyUrl)
+	httpTimeout = timeout
+	return nil
+}
+
+// 开启录制, 之后所有请求和响应都脱敏后写入path
+func EnableRecord(path string) error {
+	clientMu.Lock()
+	defer clientMu.Unlock()
+
+	base := httpClient.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	transport, err := NewRecordTransport(path, base)
+	if err != nil {
+		return err
+	}
+	httpClient = &http.Client{Transport: transport}
+	return nil
+}
+
+// 开启回放, 之后所有请求都从path中的录制记录返回, 不再访问网络
+func EnableReplay(path string) error {
+	transport, err := NewReplayTransport(path)
+	if err != nil {
+		return err
+	}
+
+	clientMu.Lock()
+	defer clientMu.Unlock()
+	httpClient = &http.Client{Transport: transport}
+	return nil
+}
+
+// 退出前调用: 录制时落盘并关闭录制文件, 回放时检查请求与录制是否一致
+func CloseHttpClient() error {
+	clientMu.RLock()
+	defer clientMu.RUnlock()
+
+	switch transport := httpClient.Transport.(type) {
+	case *RecordTransport:
+		return transport.Close()
+	case *ReplayTransport:
+		return transport.Verify()
+	}
+	return nil
+}
+
+func getHttpClient() (*http.Client, time.Duration) {
+	clientMu.RLock()
+	defer clientMu.RUnlock()
+	return httpClient, httpTimeout
+}
+
+// ctx没有deadline时加上默认超时
+func withDefaultTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
@@ -0,0 +1,94 @@
+package untils
+
+import (
+	"encoding/json"
+	"metrics"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 请求失败的原因
+const (
+	API_ERROR_NETWORK  = "network"  // 连接, 超时或读取响应失败
+	API_ERROR_HTTP     = "http"     // 非2xx状态码, 包括429
+	API_ERROR_EXCHANGE = "exchange" // 响应中status为error
+)
+
+var (
+	apiLatency = metrics.NewHistogramVec("shannon_api_request_duration_seconds",
+		"Latency of exchange API requests, each retry counted on its own.", nil, "endpoint")
+	apiRequests = metrics.NewCounterVec("shannon_api_requests_total",
+		"Exchange API requests by endpoint and HTTP status code, 0 for network errors.", "endpoint", "code")
+	apiErrors = metrics.NewCounterVec("shannon_api_errors_total",
+		"Failed exchange API requests by endpoint and reason.", "endpoint", "reason")
+)
+
+// 限频统计在读取时从限频器取
+func init() {
+	metrics.NewCounterVecFunc("shannon_ratelimit_requests_total",
+		"Requests that passed the rate limiter, by endpoint group.",
+		rateLimitValues(func(s RateLimitStats) float64 { return float64(s.Requests) }), "group")
+	metrics.NewCounterVecFunc("shannon_ratelimit_waited_total",
+		"Requests that waited for a rate limiter token, by endpoint group.",
+		rateLimitValues(func(s RateLimitStats) float64 { return float64(s.Waited) }), "group")
+	metrics.NewCounterVecFunc("shannon_ratelimit_wait_seconds_total",
+		"Total time spent waiting for rate limiter tokens, by endpoint group.",
+		rateLimitValues(func(s RateLimitStats) float64 { return s.WaitTotal.Seconds() }), "group")
+	metrics.NewGaugeVecFunc("shannon_ratelimit_wait_max_seconds",
+		"Longest single wait for a rate limiter token since start, by endpoint group.",
+		rateLimitValues(func(s RateLimitStats) float64 { return s.WaitMax.Seconds() }), "group")
+	metrics.NewCounterVecFunc("shannon_ratelimit_throttled_total",
+		"HTTP 429 responses received, by endpoint group.",
+		rateLimitValues(func(s RateLimitStats) float64 { return float64(s.Throttled) }), "group")
+}
+
+func rateLimitValues(field func(RateLimitStats) float64) func() []metrics.LabeledValue {
+	return func() []metrics.LabeledValue {
+		stats := GetRateLimitStats()
+		res := make([]metrics.LabeledValue, 0, len(stats))
+		for group, s := range stats {
+			res = append(res, metrics.LabeledValue{Values: []string{group}, Value: field(s)})
+		}
+		return res
+	}
+}
+
+// 指标中的接口名, 去掉域名和参数, 账户ID等数字替换为{id}, 避免标签过多
+func MetricsEndpoint(strUrl string) string {
+	path := strUrl
+	if u, err := url.Parse(strUrl); err == nil {
+		path = u.Path
+	}
+
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		if _, err := strconv.ParseUint(part, 10, 64); err == nil {
+			parts[i] = "{id}"
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// 记录一次请求, err为请求或读取响应的错误
+func observeRequest(endpoint string, start time.Time, code int, body []byte, err error) {
+	apiLatency.With(endpoint).Observe(time.Since(start).Seconds())
+	apiRequests.With(endpoint, strconv.Itoa(code)).Inc()
+
+	switch {
+	case err != nil:
+		apiErrors.With(endpoint, API_ERROR_NETWORK).Inc()
+	case code < 200 || code >= 300:
+		apiErrors.With(endpoint, API_ERROR_HTTP).Inc()
+	case isExchangeError(body):
+		apiErrors.With(endpoint, API_ERROR_EXCHANGE).Inc()
+	}
+}
+
+func isExchangeError(body []byte) bool {
+	var res struct {
+		Status string `json:"status"`
+	}
+	return json.Unmarshal(body, &res) == nil && res.Status == "error"
+}
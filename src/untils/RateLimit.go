@@ -0,0 +1,211 @@
+package untils
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 接口分组, 火币对行情接口和账户/交易接口分别限频
+const (
+	LIMIT_GROUP_MARKET = "market"
+	LIMIT_GROUP_TRADE  = "trade"
+)
+
+// 收到429后, 没有Retry-After时的默认退避时间
+const (
+	DEFAULT_RETRY_AFTER = 1000 //ms
+	MAX_RETRY_429       = 3
+)
+
+var (
+	limitersMu sync.Mutex
+	limiters   = map[string]*RateLimiter{
+		LIMIT_GROUP_MARKET: NewRateLimiter(10, 10),
+		LIMIT_GROUP_TRADE:  NewRateLimiter(8, 8),
+	}
+)
+
+// 限频统计信息
+type RateLimitStats struct {
+	Requests  int64         // 通过限频器的请求数
+	Waited    int64         // 需要等待令牌的请求数
+	WaitTotal time.Duration // 累计等待时间
+	WaitMax   time.Duration // 单次最长等待时间
+	Throttled int64         // 收到429的次数
+}
+
+// 令牌桶限频器, 所有goroutine共享
+// rate: 每秒补充的令牌数
+// burst: 桶容量
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	return &RateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+type RateLimiter struct {
+	mu sync.Mutex
+
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+
+	// 429后在此时间之前不发请求
+	pausedUntil time.Time
+
+	stats RateLimitStats
+}
+
+func (rl *RateLimiter) refillWithoutLock(now time.Time) {
+	elapsed := now.Sub(rl.last).Seconds()
+	if elapsed > 0 {
+		rl.tokens += elapsed * rl.rate
+		if rl.tokens > rl.burst {
+			rl.tokens = rl.burst
+		}
+	}
+	rl.last = now
+}
+
+// 预定一个令牌, 返回需要等待的时间
+func (rl *RateLimiter) reserve() time.Duration {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	rl.refillWithoutLock(now)
+	rl.tokens -= 1
+
+	var wait time.Duration
+	if rl.tokens < 0 {
+		wait = time.Duration(-rl.tokens / rl.rate * float64(time.Second))
+	}
+	if pause := rl.pausedUntil.Sub(now); pause > wait {
+		wait = pause
+	}
+
+	rl.stats.Requests++
+	if wait > 0 {
+		rl.stats.Waited++
+		rl.stats.WaitTotal += wait
+		if wait > rl.stats.WaitMax {
+			rl.stats.WaitMax = wait
+		}
+	}
+	return wait
+}
+
+// 阻塞直到拿到令牌或ctx结束, 返回实际等待时间
+func (rl *RateLimiter) Wait(ctx context.Context) (time.Duration, error) {
+	wait := rl.reserve()
+	if wait <= 0 {
+		return 0, ctx.Err()
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return wait, nil
+	case <-ctx.Done():
+		// 请求不会发出, 归还预定的令牌
+		rl.mu.Lock()
+		rl.tokens += 1
+		if rl.tokens > rl.burst {
+			rl.tokens = rl.burst
+		}
+		rl.mu.Unlock()
+		return wait, ctx.Err()
+	}
+}
+
+// 收到429时调用, 在retryAfter内暂停该分组的所有请求并清空令牌
+func (rl *RateLimiter) Throttle(retryAfter time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	until := time.Now().Add(retryAfter)
+	if until.After(rl.pausedUntil) {
+		rl.pausedUntil = until
+	}
+	rl.tokens = 0
+	rl.stats.Throttled++
+}
+
+// 修改限频参数
+func (rl *RateLimiter) SetLimit(rate float64, burst int) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.refillWithoutLock(time.Now())
+	rl.rate = rate
+	rl.burst = float64(burst)
+	if rl.tokens > rl.burst {
+		rl.tokens = rl.burst
+	}
+}
+
+func (rl *RateLimiter) Stats() RateLimitStats {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return rl.stats
+}
+
+// 获取分组对应的限频器
+func GetRateLimiter(group string) *RateLimiter {
+	limitersMu.Lock()
+	defer limitersMu.Unlock()
+
+	rl, ok := limiters[group]
+	if !ok {
+		rl = limiters[LIMIT_GROUP_TRADE]
+	}
+	return rl
+}
+
+// 设置分组的限频参数, 分组不存在时新建
+func SetRateLimit(group string, rate float64, burst int) {
+	limitersMu.Lock()
+	defer limitersMu.Unlock()
+
+	if rl, ok := limiters[group]; ok {
+		rl.SetLimit(rate, burst)
+		return
+	}
+	limiters[group] = NewRateLimiter(rate, burst)
+}
+
+// 所有分组的限频统计
+func GetRateLimitStats() map[string]RateLimitStats {
+	limitersMu.Lock()
+	defer limitersMu.Unlock()
+
+	res := make(map[string]RateLimitStats, len(limiters))
+	for group, rl := range limiters {
+		res[group] = rl.Stats()
+	}
+	return res
+}
+
+// 根据请求URL判断接口分组, 行情和公共接口走market, 其余走trade
+func EndpointGroup(strUrl string) string {
+	if strings.Contains(strUrl, "/market/") || strings.Contains(strUrl, "/v1/common/") {
+		return LIMIT_GROUP_MARKET
+	}
+	return LIMIT_GROUP_TRADE
+}
+
+// 解析Retry-After头, 只支持秒数格式
+func parseRetryAfter(value string) time.Duration {
+	if secs, err := strconv.Atoi(strings.TrimSpace(value)); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	return time.Duration(DEFAULT_RETRY_AFTER) * time.Millisecond
+}
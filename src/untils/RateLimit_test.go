@@ -0,0 +1,149 @@
+package untils
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterBurst(t *testing.T) {
+	rl := NewRateLimiter(10, 3)
+	for i := 0; i < 3; i++ {
+		if wait := rl.reserve(); wait != 0 {
+			t.Fatalf("request %d within burst waits %s", i, wait)
+		}
+	}
+	// 桶空后按rate补充, 第4个请求约等待1/rate
+	if wait := rl.reserve(); wait < 80*time.Millisecond || wait > 100*time.Millisecond {
+		t.Errorf("request after burst waits %s, want about 100ms", wait)
+	}
+	if wait := rl.reserve(); wait < 180*time.Millisecond || wait > 200*time.Millisecond {
+		t.Errorf("second request after burst waits %s, want about 200ms", wait)
+	}
+
+	stats := rl.Stats()
+	if stats.Requests != 5 || stats.Waited != 2 || stats.WaitMax < 180*time.Millisecond || stats.WaitTotal < stats.WaitMax {
+		t.Errorf("stats %+v", stats)
+	}
+}
+
+func TestRateLimiterRefill(t *testing.T) {
+	rl := NewRateLimiter(50, 2)
+	rl.reserve()
+	rl.reserve()
+
+	// 50/s, 60ms后补充约3个令牌, 但不超过burst
+	time.Sleep(60 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		if wait := rl.reserve(); wait != 0 {
+			t.Errorf("request %d after refill waits %s", i, wait)
+		}
+	}
+	if wait := rl.reserve(); wait == 0 {
+		t.Error("tokens refilled beyond burst")
+	}
+}
+
+func TestRateLimiterWait(t *testing.T) {
+	rl := NewRateLimiter(20, 1)
+	if wait, err := rl.Wait(context.Background()); wait != 0 || err != nil {
+		t.Fatalf("Wait = %s, %v", wait, err)
+	}
+
+	start := time.Now()
+	wait, err := rl.Wait(context.Background())
+	if err != nil || wait <= 0 {
+		t.Fatalf("Wait = %s, %v", wait, err)
+	}
+	if elapsed := time.Since(start); elapsed < wait {
+		t.Errorf("Wait returned after %s, want at least %s", elapsed, wait)
+	}
+}
+
+func TestRateLimiterWaitCancel(t *testing.T) {
+	rl := NewRateLimiter(1, 1)
+	rl.reserve()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := rl.Wait(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Wait error %v, want DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("canceled Wait returned after %s", elapsed)
+	}
+
+	// 取消的请求归还令牌, 后面的请求不用多等一个令牌的时间
+	if wait := rl.reserve(); wait > time.Second {
+		t.Errorf("request after cancel waits %s, want at most 1s", wait)
+	}
+
+	// 已结束的ctx在有令牌时也返回错误
+	canceled, cancelNow := context.WithCancel(context.Background())
+	cancelNow()
+	if _, err := NewRateLimiter(1, 1).Wait(canceled); err != context.Canceled {
+		t.Errorf("Wait error %v, want Canceled", err)
+	}
+}
+
+func TestRateLimiterThrottle(t *testing.T) {
+	rl := NewRateLimiter(100, 10)
+	rl.Throttle(200 * time.Millisecond)
+	// 较短的暂停不会缩短已有的暂停
+	rl.Throttle(10 * time.Millisecond)
+
+	if wait := rl.reserve(); wait < 150*time.Millisecond || wait > 200*time.Millisecond {
+		t.Errorf("request after 429 waits %s, want about 200ms", wait)
+	}
+	if stats := rl.Stats(); stats.Throttled != 2 {
+		t.Errorf("throttled %d, want 2", stats.Throttled)
+	}
+}
+
+func TestRateLimiterSetLimit(t *testing.T) {
+	rl := NewRateLimiter(10, 10)
+	rl.SetLimit(10, 1)
+	rl.reserve()
+	if wait := rl.reserve(); wait == 0 {
+		t.Error("tokens above the new burst should be dropped")
+	}
+}
+
+func TestEndpointGroup(t *testing.T) {
+	cases := []struct {
+		url  string
+		want string
+	}{
+		{"https://api.huobi.pro/market/detail/merged?symbol=adausdt", LIMIT_GROUP_MARKET},
+		{"https://api.huobi.pro/v1/common/symbols", LIMIT_GROUP_MARKET},
+		{"https://api.huobi.pro/v1/order/orders/place", LIMIT_GROUP_TRADE},
+		{"https://api.huobi.pro/v1/account/accounts", LIMIT_GROUP_TRADE},
+	}
+	for _, c := range cases {
+		if got := EndpointGroup(c.url); got != c.want {
+			t.Errorf("EndpointGroup(%s) = %s, want %s", c.url, got, c.want)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	def := time.Duration(DEFAULT_RETRY_AFTER) * time.Millisecond
+	cases := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"3", 3 * time.Second},
+		{" 1 ", time.Second},
+		{"", def},
+		{"0", def},
+		{"-1", def},
+		{http.TimeFormat, def},
+	}
+	for _, c := range cases {
+		if got := parseRetryAfter(c.value); got != c.want {
+			t.Errorf("parseRetryAfter(%q) = %s, want %s", c.value, got, c.want)
+		}
+	}
+}
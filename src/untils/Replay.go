@@ -0,0 +1,342 @@
+package untils
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 录制时需要脱敏的参数
+var redactedParams = map[string]bool{
+	"AccessKeyId": true,
+	"Signature":   true,
+}
+
+// 回放匹配请求时忽略的参数, 每次请求都会变化
+var ignoredParams = map[string]bool{
+	"AccessKeyId": true,
+	"Signature":   true,
+	"Timestamp":   true,
+}
+
+// 录制时需要脱敏的响应头
+var redactedHeaders = map[string]bool{
+	"Set-Cookie":          true,
+	"Cookie":              true,
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+}
+
+const REDACTED = "REDACTED"
+
+// 一次请求/响应的录制记录, 每条记录占录制文件的一行
+type RecordEntry struct {
+	Seq          int64       `json:"seq"`
+	Time         time.Time   `json:"time"`
+	Method       string      `json:"method"`
+	Url          string      `json:"url"`
+	RequestBody  string      `json:"request_body,omitempty"`
+	StatusCode   int         `json:"status_code"`
+	Header       http.Header `json:"header,omitempty"`
+	ResponseBody string      `json:"response_body"`
+	Error        string      `json:"error,omitempty"`
+}
+
+// 对URL中的密钥和签名参数进行脱敏
+// strUrl: 原始URL
+// return: 脱敏后的URL
+func RedactUrl(strUrl string) string {
+	u, err := url.Parse(strUrl)
+	if err != nil {
+		return strUrl
+	}
+
+	query := u.Query()
+	params := make(map[string]string, len(query))
+	for key := range query {
+		if redactedParams[key] {
+			params[key] = REDACTED
+		} else {
+			params[key] = query.Get(key)
+		}
+	}
+	u.RawQuery = Map2UrlQuery(params)
+	return u.String()
+}
+
+// 对响应头中的cookie等进行脱敏
+// header: 原始响应头
+// return: 脱敏后的副本
+func RedactHeader(header http.Header) http.Header {
+	if header == nil {
+		return nil
+	}
+	res := make(http.Header, len(header))
+	for key, values := range header {
+		if redactedHeaders[http.CanonicalHeaderKey(key)] {
+			res[key] = []string{REDACTED}
+		} else {
+			res[key] = append([]string(nil), values...)
+		}
+	}
+	return res
+}
+
+// 回放时用于匹配请求的key: 方法 + 路径 + 除去忽略参数后的查询字符串 + 请求体
+// 下单等POST请求的路径相同, 按请求体区分买卖方向和数量
+func replayKey(method string, strUrl string, body string) string {
+	key := method + " " + strUrl
+	if u, err := url.Parse(strUrl); err == nil {
+		query := u.Query()
+		params := make(map[string]string, len(query))
+		for name := range query {
+			if !ignoredParams[name] {
+				params[name] = query.Get(name)
+			}
+		}
+		key = method + " " + u.Path + "?" + Map2UrlQuery(params)
+	}
+	if body != "" {
+		key += " " + body
+	}
+	return key
+}
+
+// 录制Transport, 把每一次请求和响应脱敏后写入文件
+// path: 录制文件路径, 已存在时追加
+// base: 实际发请求的Transport
+func NewRecordTransport(path string, base http.RoundTripper) (*RecordTransport, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RecordTransport{
+		Base: base,
+		file: file,
+	}, nil
+}
+
+type RecordTransport struct {
+	Base http.RoundTripper
+
+	mu   sync.Mutex
+	seq  int64
+	file *os.File
+}
+
+func (rt *RecordTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	entry := &RecordEntry{
+		Time:   time.Now(),
+		Method: request.Method,
+		Url:    RedactUrl(request.URL.String()),
+	}
+
+	if request.Body != nil {
+		body, err := ioutil.ReadAll(request.Body)
+		request.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		entry.RequestBody = string(body)
+		request.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	response, err := rt.Base.RoundTrip(request)
+	if err != nil {
+		entry.Error = err.Error()
+		rt.write(entry)
+		return nil, err
+	}
+
+	body, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		entry.Error = err.Error()
+		rt.write(entry)
+		return nil, err
+	}
+	response.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	entry.StatusCode = response.StatusCode
+	entry.Header = RedactHeader(response.Header)
+	entry.ResponseBody = string(body)
+	rt.write(entry)
+
+	return response, nil
+}
+
+func (rt *RecordTransport) write(entry *RecordEntry) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	// 关闭后的请求不再录制
+	if rt.file == nil {
+		return
+	}
+	rt.seq++
+	entry.Seq = rt.seq
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	rt.file.Write(append(line, '\n'))
+}
+
+// 落盘并关闭录制文件, 退出前调用
+func (rt *RecordTransport) Close() error {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	if rt.file == nil {
+		return nil
+	}
+	err := rt.file.Sync()
+	if closeErr := rt.file.Close(); err == nil {
+		err = closeErr
+	}
+	rt.file = nil
+	return err
+}
+
+// 回放Transport, 按录制顺序返回录制文件中的响应
+// 同一接口(方法+路径+参数)的请求按录制顺序依次返回, 不同接口之间互不影响,
+// 这样并发的goroutine交错发请求时回放结果也是确定的
+// path: 录制文件路径
+func NewReplayTransport(path string) (*ReplayTransport, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	rt := &ReplayTransport{
+		queues: make(map[string][]*RecordEntry),
+	}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		entry := &RecordEntry{}
+		if err := json.Unmarshal([]byte(line), entry); err != nil {
+			return nil, err
+		}
+		key := replayKey(entry.Method, entry.Url, entry.RequestBody)
+		rt.queues[key] = append(rt.queues[key], entry)
+		rt.remain++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return rt, nil
+}
+
+type ReplayTransport struct {
+	mu     sync.Mutex
+	queues map[string][]*RecordEntry
+	remain int
+
+	// 没有匹配到录制记录的请求
+	unmatched []string
+}
+
+// 取出下一条匹配的录制记录
+func (rt *ReplayTransport) next(key string) (*RecordEntry, bool) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	queue := rt.queues[key]
+	if len(queue) == 0 {
+		return nil, false
+	}
+	rt.queues[key] = queue[1:]
+	rt.remain--
+	return queue[0], true
+}
+
+// 尚未回放的记录数
+func (rt *ReplayTransport) Remain() int {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	return rt.remain
+}
+
+// 检查回放是否与录制一致: 所有请求都匹配到了记录, 所有记录都被回放
+func (rt *ReplayTransport) Verify() error {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	var errs []string
+	if len(rt.unmatched) != 0 {
+		errs = append(errs, fmt.Sprintf("%d requests not recorded: %s", len(rt.unmatched), strings.Join(rt.unmatched, "; ")))
+	}
+	if rt.remain != 0 {
+		var left []string
+		for key, queue := range rt.queues {
+			if len(queue) != 0 {
+				left = append(left, fmt.Sprintf("%s x%d", key, len(queue)))
+			}
+		}
+		sort.Strings(left)
+		errs = append(errs, fmt.Sprintf("%d recorded responses not replayed: %s", rt.remain, strings.Join(left, "; ")))
+	}
+	if len(errs) != 0 {
+		return errors.New("replay mismatch, " + strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+func (rt *ReplayTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	var body string
+	if request.Body != nil {
+		content, err := ioutil.ReadAll(request.Body)
+		request.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		body = string(content)
+	}
+
+	key := replayKey(request.Method, request.URL.String(), body)
+	entry, ok := rt.next(key)
+	if !ok {
+		rt.mu.Lock()
+		rt.unmatched = append(rt.unmatched, key)
+		rt.mu.Unlock()
+		return nil, fmt.Errorf("replay: no recorded response for %s", key)
+	}
+	if entry.Error != "" {
+		return nil, errors.New(entry.Error)
+	}
+
+	header := entry.Header
+	if header == nil {
+		header = make(http.Header)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", entry.StatusCode, http.StatusText(entry.StatusCode)),
+		StatusCode:    entry.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(strings.NewReader(entry.ResponseBody)),
+		ContentLength: int64(len(entry.ResponseBody)),
+		Request:       request,
+	}, nil
+}
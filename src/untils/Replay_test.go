@@ -0,0 +1,187 @@
+package untils
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	secretAccessKey = "ak-0123456789abcdef"
+	secretSignature = "c2lnbmF0dXJlLXNlY3JldA"
+	secretCookie    = "session=cookie-secret"
+	secretAuth      = "Bearer auth-secret"
+)
+
+func writeRecordFile(t *testing.T, entries ...*RecordEntry) string {
+	var lines []string
+	for i, entry := range entries {
+		entry.Seq = int64(i + 1)
+		line, err := json.Marshal(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, string(line))
+	}
+	path := filepath.Join(t.TempDir(), "record.jsonl")
+	if err := ioutil.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func replayBody(t *testing.T, client *http.Client, method string, strUrl string, body string) string {
+	request, err := http.NewRequest(method, strUrl, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		t.Fatalf("%s %s: %s", method, strUrl, err)
+	}
+	defer response.Body.Close()
+	content, _ := ioutil.ReadAll(response.Body)
+	return string(content)
+}
+
+func signedUrl(host string, path string, query string, timestamp string) string {
+	return host + path + "?AccessKeyId=" + secretAccessKey + "&Signature=" + secretSignature +
+		"&SignatureMethod=HmacSHA256&SignatureVersion=2&Timestamp=" + timestamp + query
+}
+
+func TestRecordRedaction(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Set-Cookie", secretCookie)
+		w.Header().Set("Authorization", secretAuth)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"ok","data":[]}`))
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "record.jsonl")
+	rt, err := NewRecordTransport(path, http.DefaultTransport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: rt}
+	if body := replayBody(t, client, "GET", signedUrl(srv.URL, "/v1/account/accounts", "", "2026-10-19T08%3A30%3A00"), ""); body != `{"status":"ok","data":[]}` {
+		t.Errorf("recorded request returned %s", body)
+	}
+	if err := rt.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{secretAccessKey, secretSignature, "cookie-secret", "auth-secret"} {
+		if strings.Contains(string(content), secret) {
+			t.Errorf("record file leaks %s:\n%s", secret, content)
+		}
+	}
+
+	entry := &RecordEntry{}
+	if err := json.Unmarshal(content, entry); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(entry.Url, "AccessKeyId=REDACTED") || !strings.Contains(entry.Url, "Signature=REDACTED") {
+		t.Errorf("url %s, want AccessKeyId and Signature redacted", entry.Url)
+	}
+	if entry.Header.Get("Set-Cookie") != REDACTED || entry.Header.Get("Authorization") != REDACTED {
+		t.Errorf("header %v, want Set-Cookie and Authorization redacted", entry.Header)
+	}
+	if entry.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("header %v, Content-Type should be kept", entry.Header)
+	}
+
+	// 回放时签名和时间戳都不同, 仍能匹配到录制的响应
+	replay, err := NewReplayTransport(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client = &http.Client{Transport: replay}
+	if body := replayBody(t, client, "GET", signedUrl("https://api.huobi.pro", "/v1/account/accounts", "", "2026-10-20T00%3A00%3A00"), ""); body != `{"status":"ok","data":[]}` {
+		t.Errorf("replayed %s", body)
+	}
+	if err := replay.Verify(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestReplayOrderPerKey(t *testing.T) {
+	path := writeRecordFile(t,
+		&RecordEntry{Method: "GET", Url: "https://api.huobi.pro/market/detail/merged?symbol=adausdt", StatusCode: 200, ResponseBody: "ada-1"},
+		&RecordEntry{Method: "GET", Url: "https://api.huobi.pro/market/detail/merged?symbol=btcusdt", StatusCode: 200, ResponseBody: "btc-1"},
+		&RecordEntry{Method: "GET", Url: "https://api.huobi.pro/market/detail/merged?symbol=adausdt", StatusCode: 200, ResponseBody: "ada-2"},
+		&RecordEntry{Method: "GET", Url: "https://api.huobi.pro/market/detail/merged?symbol=btcusdt", StatusCode: 200, ResponseBody: "btc-2"},
+	)
+	replay, err := NewReplayTransport(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: replay}
+
+	// 与录制时的交错顺序不同, 同一key内仍按录制顺序返回
+	var got []string
+	for _, symbol := range []string{"btcusdt", "btcusdt", "adausdt", "adausdt"} {
+		got = append(got, replayBody(t, client, "GET", "https://api.huobi.pro/market/detail/merged?symbol="+symbol, ""))
+	}
+	if strings.Join(got, ",") != "btc-1,btc-2,ada-1,ada-2" {
+		t.Errorf("replayed %v", got)
+	}
+	if replay.Remain() != 0 {
+		t.Errorf("remain %d", replay.Remain())
+	}
+}
+
+func TestReplayPostBody(t *testing.T) {
+	placeUrl := "https://api.huobi.pro/v1/order/orders/place?AccessKeyId=REDACTED&Signature=REDACTED&Timestamp=x"
+	buy := `{"amount":"10","symbol":"adausdt","type":"buy-limit"}`
+	sell := `{"amount":"10","symbol":"adausdt","type":"sell-limit"}`
+	path := writeRecordFile(t,
+		&RecordEntry{Method: "POST", Url: placeUrl, RequestBody: buy, StatusCode: 200, ResponseBody: "buy-order"},
+		&RecordEntry{Method: "POST", Url: placeUrl, RequestBody: sell, StatusCode: 200, ResponseBody: "sell-order"},
+	)
+	replay, err := NewReplayTransport(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: replay}
+
+	if body := replayBody(t, client, "POST", placeUrl, sell); body != "sell-order" {
+		t.Errorf("sell replayed %s", body)
+	}
+	if body := replayBody(t, client, "POST", placeUrl, buy); body != "buy-order" {
+		t.Errorf("buy replayed %s", body)
+	}
+}
+
+func TestReplayVerify(t *testing.T) {
+	path := writeRecordFile(t,
+		&RecordEntry{Method: "GET", Url: "https://api.huobi.pro/v1/common/symbols", StatusCode: 200, ResponseBody: "symbols"},
+		&RecordEntry{Method: "GET", Url: "https://api.huobi.pro/v1/account/accounts", StatusCode: 200, ResponseBody: "accounts"},
+		&RecordEntry{Method: "GET", Url: "https://api.huobi.pro/v1/account/accounts", StatusCode: 200, ResponseBody: "accounts"},
+	)
+	replay, err := NewReplayTransport(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: replay}
+
+	replayBody(t, client, "GET", "https://api.huobi.pro/v1/account/accounts", "")
+	if _, err := client.Get("https://api.huobi.pro/market/tickers"); err == nil {
+		t.Error("request without record should fail")
+	}
+
+	err = replay.Verify()
+	want := "replay mismatch, 1 requests not recorded: GET /market/tickers?, " +
+		"2 recorded responses not replayed: GET /v1/account/accounts? x1; GET /v1/common/symbols? x1"
+	if err == nil || err.Error() != want {
+		t.Errorf("Verify:\n%v\nwant:\n%s", err, want)
+	}
+}
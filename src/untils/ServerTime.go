@@ -0,0 +1,24 @@
+package untils
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// 本地时钟与交易所时钟的偏差, 单位纳秒, 交易所时间 = 本地时间 + 偏差
+var serverTimeOffset int64
+
+// 设置本地时钟与交易所时钟的偏差
+func SetServerTimeOffset(offset time.Duration) {
+	atomic.StoreInt64(&serverTimeOffset, int64(offset))
+}
+
+// 获取本地时钟与交易所时钟的偏差
+func GetServerTimeOffset() time.Duration {
+	return time.Duration(atomic.LoadInt64(&serverTimeOffset))
+}
+
+// 按交易所时钟校正后的当前时间, 签名时使用
+func ServerNow() time.Time {
+	return time.Now().Add(GetServerTimeOffset())
+}
@@ -1,13 +1,13 @@
 package untils
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
-	"net/url"
 	"sort"
 	"strings"
 	"time"
@@ -17,12 +17,11 @@ import (
 )
 
 // Http Get请求基础函数, 通过封装Go语言Http请求, 支持火币网REST API的HTTP Get请求
+// ctx: 请求的context, 没有deadline时使用默认超时
 // strUrl: 请求的URL
 // strParams: string类型的请求参数, user=lxz&pwd=lxz
 // return: 请求结果
-func HttpGetRequest(strUrl string, mapParams map[string]string) string {
-	httpClient := &http.Client{}
-
+func HttpGetRequest(ctx context.Context, strUrl string, mapParams map[string]string) string {
 	var strRequestUrl string
 	if nil == mapParams {
 		strRequestUrl = strUrl
@@ -32,103 +31,132 @@ func HttpGetRequest(strUrl string, mapParams map[string]string) string {
 	}
 
 	// 构建Request, 并且按官方要求添加Http Header
-	request, err := http.NewRequest("GET", strRequestUrl, nil)
-	if nil != err {
-		return err.Error()
-	}
-	request.Header.Add("User-Agent", "Mozilla/5.0 (Windows NT 6.1; WOW64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/39.0.2171.71 Safari/537.36")
-
-	// 发出请求
-	response, err := httpClient.Do(request)
-	if nil != err {
-		return err.Error()
-	}
-	defer response.Body.Close()
-
-	// 解析响应内容
-	body, err := ioutil.ReadAll(response.Body)
-	if nil != err {
-		return err.Error()
-	}
-
-	return string(body)
+	return doRequest(ctx, strRequestUrl, func(ctx context.Context) (*http.Request, error) {
+		request, err := http.NewRequestWithContext(ctx, "GET", strRequestUrl, nil)
+		if nil != err {
+			return nil, err
+		}
+		request.Header.Add("User-Agent", "Mozilla/5.0 (Windows NT 6.1; WOW64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/39.0.2171.71 Safari/537.36")
+		return request, nil
+	})
 }
 
 // Http POST请求基础函数, 通过封装Go语言Http请求, 支持火币网REST API的HTTP POST请求
+// ctx: 请求的context, 没有deadline时使用默认超时
 // strUrl: 请求的URL
 // mapParams: map类型的请求参数
 // return: 请求结果
-func HttpPostRequest(strUrl string, mapParams map[string]string) string {
-	httpClient := &http.Client{}
-
+func HttpPostRequest(ctx context.Context, strUrl string, mapParams map[string]string) string {
 	jsonParams := ""
 	if nil != mapParams {
 		bytesParams, _ := json.Marshal(mapParams)
 		jsonParams = string(bytesParams)
 	}
 
-	request, err := http.NewRequest("POST", strUrl, strings.NewReader(jsonParams))
-	if nil != err {
-		return err.Error()
-	}
-	request.Header.Add("User-Agent", "Mozilla/5.0 (Windows NT 6.1; WOW64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/39.0.2171.71 Safari/537.36")
-	request.Header.Add("Content-Type", "application/json")
-	request.Header.Add("Accept-Language", "zh-cn")
-
-	response, err := httpClient.Do(request)
-	defer response.Body.Close()
-	if nil != err {
-		return err.Error()
-	}
+	return doRequest(ctx, strUrl, func(ctx context.Context) (*http.Request, error) {
+		request, err := http.NewRequestWithContext(ctx, "POST", strUrl, strings.NewReader(jsonParams))
+		if nil != err {
+			return nil, err
+		}
+		request.Header.Add("User-Agent", "Mozilla/5.0 (Windows NT 6.1; WOW64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/39.0.2171.71 Safari/537.36")
+		request.Header.Add("Content-Type", "application/json")
+		request.Header.Add("Accept-Language", "zh-cn")
+		return request, nil
+	})
+}
 
-	body, err := ioutil.ReadAll(response.Body)
-	if nil != err {
-		return err.Error()
+// 发出请求并读取响应, 请求前经过接口分组的限频器, 收到429时退避后重试
+// ctx: 请求的context, 包括限频等待和重试在内都受其deadline约束
+// strUrl: 请求的URL, 用于判断接口分组
+// newRequest: 构建Request的函数, 重试时需要重新构建
+// return: 请求结果
+func doRequest(ctx context.Context, strUrl string, newRequest func(context.Context) (*http.Request, error)) string {
+	httpClient, timeout := getHttpClient()
+	ctx, cancel := withDefaultTimeout(ctx, timeout)
+	defer cancel()
+
+	limiter := GetRateLimiter(EndpointGroup(strUrl))
+	endpoint := MetricsEndpoint(strUrl)
+
+	for retry := 0; ; retry++ {
+		request, err := newRequest(ctx)
+		if nil != err {
+			return err.Error()
+		}
+
+		if _, err := limiter.Wait(ctx); nil != err {
+			return err.Error()
+		}
+		start := time.Now()
+		response, err := httpClient.Do(request)
+		if nil != err {
+			observeRequest(endpoint, start, 0, nil, err)
+			return err.Error()
+		}
+
+		// 解析响应内容
+		body, err := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		observeRequest(endpoint, start, response.StatusCode, body, err)
+		if nil != err {
+			return err.Error()
+		}
+
+		if response.StatusCode != http.StatusTooManyRequests || retry >= MAX_RETRY_429 {
+			return string(body)
+		}
+		limiter.Throttle(parseRetryAfter(response.Header.Get("Retry-After")))
 	}
-
-	return string(body)
 }
 
 // 进行签名后的HTTP GET请求, 参考官方Python Demo写的
+// ctx: 请求的context, 携带签名用的密钥, 见WithCredential
 // mapParams: map类型的请求参数, key:value
 // strRequest: API路由路径
 // return: 请求结果
-func ApiKeyGet(mapParams map[string]string, strRequestPath string) string {
+func ApiKeyGet(ctx context.Context, mapParams map[string]string, strRequestPath string) string {
 	strMethod := "GET"
-	timestamp := time.Now().UTC().Format("2006-01-02T15:04:05")
+	timestamp := ServerNow().UTC().Format("2006-01-02T15:04:05")
 
-	mapParams["AccessKeyId"] = config.ACCESS_KEY
-	mapParams["SignatureMethod"] = "HmacSHA256"
-	mapParams["SignatureVersion"] = "2"
-	mapParams["Timestamp"] = timestamp
+	mapParams2Sign := make(map[string]string)
+	for key, value := range mapParams {
+		mapParams2Sign[key] = value
+	}
+	cred := CredentialFromContext(ctx)
+	mapParams2Sign["AccessKeyId"] = cred.AccessKey
+	mapParams2Sign["SignatureMethod"] = "HmacSHA256"
+	mapParams2Sign["SignatureVersion"] = "2"
+	mapParams2Sign["Timestamp"] = timestamp
 
 	hostName := "api.huobi.pro"
-	mapParams["Signature"] = CreateSign(mapParams, strMethod, hostName, strRequestPath, config.SECRET_KEY)
+	mapParams2Sign["Signature"] = CreateSign(mapParams2Sign, strMethod, hostName, strRequestPath, cred.SecretKey)
 
 	strUrl := config.TRADE_URL + strRequestPath
-	return HttpGetRequest(strUrl, MapValueEncodeURI(mapParams))
+	return HttpGetRequest(ctx, strUrl, mapParams2Sign)
 }
 
 // 进行签名后的HTTP POST请求, 参考官方Python Demo写的
+// ctx: 请求的context, 携带签名用的密钥, 见WithCredential
 // mapParams: map类型的请求参数, key:value
 // strRequest: API路由路径
 // return: 请求结果
-func ApiKeyPost(mapParams map[string]string, strRequestPath string) string {
+func ApiKeyPost(ctx context.Context, mapParams map[string]string, strRequestPath string) string {
 	strMethod := "POST"
-	timestamp := time.Now().UTC().Format("2006-01-02T15:04:05")
+	timestamp := ServerNow().UTC().Format("2006-01-02T15:04:05")
 
 	mapParams2Sign := make(map[string]string)
-	mapParams2Sign["AccessKeyId"] = config.ACCESS_KEY
+	cred := CredentialFromContext(ctx)
+	mapParams2Sign["AccessKeyId"] = cred.AccessKey
 	mapParams2Sign["SignatureMethod"] = "HmacSHA256"
 	mapParams2Sign["SignatureVersion"] = "2"
 	mapParams2Sign["Timestamp"] = timestamp
 
 	hostName := "api.huobi.pro"
 
-	mapParams2Sign["Signature"] = CreateSign(mapParams2Sign, strMethod, hostName, strRequestPath, config.SECRET_KEY)
-	strUrl := config.TRADE_URL + strRequestPath + "?" + Map2UrlQuery(MapValueEncodeURI(mapParams2Sign))
+	mapParams2Sign["Signature"] = CreateSign(mapParams2Sign, strMethod, hostName, strRequestPath, cred.SecretKey)
+	strUrl := config.TRADE_URL + strRequestPath + "?" + Map2UrlQuery(mapParams2Sign)
 
-	return HttpPostRequest(strUrl, mapParams)
+	return HttpPostRequest(ctx, strUrl, mapParams)
 }
 
 // 构造签名
@@ -139,59 +167,69 @@ func ApiKeyPost(mapParams map[string]string, strRequestPath string) string {
 // strSecretKey: 进行签名的密钥
 func CreateSign(mapParams map[string]string, strMethod, strHostUrl, strRequestPath, strSecretKey string) string {
 	// 参数处理, 按API要求, 参数名应按ASCII码进行排序(使用UTF-8编码, 其进行URI编码, 16进制字符必须大写)
-	sortedParams := MapSortByKey(mapParams)
-	encodeParams := MapValueEncodeURI(sortedParams)
-	strParams := Map2UrlQuery(encodeParams)
-
-	strPayload := strMethod + "\n" + strHostUrl + "\n" + strRequestPath + "\n" + strParams
+	strPayload := CreateSignPayload(mapParams, strMethod, strHostUrl, strRequestPath)
 	// NOTE. Jinke Changed.
 	return ComputeHmac256(strPayload, strSecretKey)
 }
 
-// 对Map按着ASCII码进行排序
+// 构造待签名的字符串: 请求方法, 主机, 路由路径, 规范化的查询字符串, 以\n分隔
+// mapParams: 参与签名的参数, 值不需要事先编码
+// return: 待签名的字符串
+func CreateSignPayload(mapParams map[string]string, strMethod, strHostUrl, strRequestPath string) string {
+	return strMethod + "\n" + strings.ToLower(strHostUrl) + "\n" + strRequestPath + "\n" + Map2UrlQuery(mapParams)
+}
+
+// 对Map的key按着ASCII码进行排序
 // mapValue: 需要进行排序的map
-// return: 排序后的map
-func MapSortByKey(mapValue map[string]string) map[string]string {
-	var keys []string
+// return: 排序后的key
+func SortedKeys(mapValue map[string]string) []string {
+	keys := make([]string, 0, len(mapValue))
 	for key := range mapValue {
 		keys = append(keys, key)
 	}
 	sort.Strings(keys)
 
-	mapReturn := make(map[string]string)
-	for _, key := range keys {
-		mapReturn[key] = mapValue[key]
-	}
-
-	return mapReturn
+	return keys
 }
 
-// 对Map的值进行URI编码
-// mapParams: 需要进行URI编码的map
-// return: 编码后的map
-func MapValueEncodeURI(mapValue map[string]string) map[string]string {
-	for key, value := range mapValue {
-		valueEncodeURI := url.QueryEscape(value)
-		mapValue[key] = valueEncodeURI
+// 按RFC3986进行URI编码, 除 A-Z a-z 0-9 - _ . ~ 外都编码为%XX, 16进制字符大写
+// strValue: 需要编码的字符串
+// return: 编码后的字符串
+func EncodeURIComponent(strValue string) string {
+	const hex = "0123456789ABCDEF"
+
+	var builder strings.Builder
+	for i := 0; i < len(strValue); i++ {
+		c := strValue[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			builder.WriteByte(c)
+			continue
+		}
+		builder.WriteByte('%')
+		builder.WriteByte(hex[c>>4])
+		builder.WriteByte(hex[c&0x0F])
 	}
 
-	return mapValue
+	return builder.String()
 }
 
-// 将map格式的请求参数转换为字符串格式的
-// mapParams: map格式的参数键值对
+// 将map格式的请求参数转换为规范化的查询字符串
+// 参数名按ASCII码排序, 参数名和值都按RFC3986编码, 同样的参数总是得到同样的结果
+// mapParams: map格式的参数键值对, 值不需要事先编码
 // return: 查询字符串
 func Map2UrlQuery(mapParams map[string]string) string {
-	var strParams string
-	for key, value := range mapParams {
-		strParams += (key + "=" + value + "&")
-	}
-
-	if 0 < len(strParams) {
-		strParams = string([]rune(strParams)[:len(strParams)-1])
+	var builder strings.Builder
+	for i, key := range SortedKeys(mapParams) {
+		if i > 0 {
+			builder.WriteByte('&')
+		}
+		builder.WriteString(EncodeURIComponent(key))
+		builder.WriteByte('=')
+		builder.WriteString(EncodeURIComponent(mapParams[key]))
 	}
 
-	return strParams
+	return builder.String()
 }
 
 // HMAC SHA256加密
@@ -0,0 +1,117 @@
+package untils
+
+import (
+	"testing"
+)
+
+// 火币API文档中的签名示例, 密钥是文档中打码后的值
+const (
+	docAccessKey = "e2xxxxxx-99xxxxxx-84xxxxxx-7xxxx"
+	docSecretKey = "b0xxxxxx-c6xxxxxx-94xxxxxx-dxxxx"
+	docTimestamp = "2017-05-11T15:19:30"
+)
+
+func docParams() map[string]string {
+	return map[string]string{
+		"AccessKeyId":      docAccessKey,
+		"SignatureMethod":  "HmacSHA256",
+		"SignatureVersion": "2",
+		"Timestamp":        docTimestamp,
+	}
+}
+
+func TestCreateSignGet(t *testing.T) {
+	params := docParams()
+	params["order-id"] = "1234567890"
+
+	// 文档给出的待签名字符串
+	wantPayload := "GET\napi.huobi.pro\n/v1/order/orders\n" +
+		"AccessKeyId=e2xxxxxx-99xxxxxx-84xxxxxx-7xxxx&SignatureMethod=HmacSHA256&SignatureVersion=2&Timestamp=2017-05-11T15%3A19%3A30&order-id=1234567890"
+	if payload := CreateSignPayload(params, "GET", "api.huobi.pro", "/v1/order/orders"); payload != wantPayload {
+		t.Errorf("payload:\n%q\nwant:\n%q", payload, wantPayload)
+	}
+
+	// 用Python的hmac/hashlib/base64独立计算
+	wantSign := "Nmd8AU8uAe0mkFpxNbiava0aeZzBEtYjCdie1ZYZjoM="
+	if sign := CreateSign(params, "GET", "api.huobi.pro", "/v1/order/orders", docSecretKey); sign != wantSign {
+		t.Errorf("signature %s, want %s", sign, wantSign)
+	}
+}
+
+func TestCreateSignPost(t *testing.T) {
+	// POST的业务参数在body中, 不参与签名
+	params := docParams()
+
+	wantPayload := "POST\napi.huobi.pro\n/v1/order/orders/place\n" +
+		"AccessKeyId=e2xxxxxx-99xxxxxx-84xxxxxx-7xxxx&SignatureMethod=HmacSHA256&SignatureVersion=2&Timestamp=2017-05-11T15%3A19%3A30"
+	if payload := CreateSignPayload(params, "POST", "API.Huobi.Pro", "/v1/order/orders/place"); payload != wantPayload {
+		t.Errorf("payload:\n%q\nwant:\n%q", payload, wantPayload)
+	}
+
+	wantSign := "5NjPB1wj1lHSZO0PkwvX5X7fuOi2DHrI8Y/jS1nbDvQ="
+	if sign := CreateSign(params, "POST", "api.huobi.pro", "/v1/order/orders/place", docSecretKey); sign != wantSign {
+		t.Errorf("signature %s, want %s", sign, wantSign)
+	}
+}
+
+func TestMap2UrlQueryOrder(t *testing.T) {
+	params := map[string]string{
+		"symbol":      "btcusdt",
+		"AccessKeyId": "k",
+		"a":           "1",
+		"Z":           "2",
+		"_":           "3",
+		"period":      "1min",
+		"size":        "1",
+	}
+
+	// 按ASCII码排序: 大写字母在下划线和小写字母之前
+	want := "AccessKeyId=k&Z=2&_=3&a=1&period=1min&size=1&symbol=btcusdt"
+	// map的遍历顺序是随机的, 多次构造结果必须相同
+	for i := 0; i < 100; i++ {
+		if query := Map2UrlQuery(params); query != want {
+			t.Fatalf("query %s, want %s", query, want)
+		}
+	}
+}
+
+func TestEncodeURIComponent(t *testing.T) {
+	cases := []struct {
+		value string
+		want  string
+	}{
+		{"AZaz09-_.~", "AZaz09-_.~"},
+		{"*'()!", "%2A%27%28%29%21"},
+		{"a b+c", "a%20b%2Bc"},
+		{"=&/?#%", "%3D%26%2F%3F%23%25"},
+		{"中", "%E4%B8%AD"},
+		{"2017-05-11T15:19:30", "2017-05-11T15%3A19%3A30"},
+		{"", ""},
+	}
+	for _, c := range cases {
+		if got := EncodeURIComponent(c.value); got != c.want {
+			t.Errorf("EncodeURIComponent(%q) = %s, want %s", c.value, got, c.want)
+		}
+	}
+}
+
+func TestMap2UrlQueryEscape(t *testing.T) {
+	params := map[string]string{
+		"Timestamp": docTimestamp,
+		"note":      "it's (a) test!*",
+		"名":         "值 v",
+	}
+
+	want := "Timestamp=2017-05-11T15%3A19%3A30&note=it%27s%20%28a%29%20test%21%2A&%E5%90%8D=%E5%80%BC%20v"
+	if query := Map2UrlQuery(params); query != want {
+		t.Errorf("query:\n%s\nwant:\n%s", query, want)
+	}
+}
+
+func TestComputeHmac256(t *testing.T) {
+	// RFC 4231 Test Case 2
+	want := "W9zBRr9gdU5qBCQmCJV1x1oAPwidJzmDnexYuWTsOEM="
+	if got := ComputeHmac256("what do ya want for nothing?", "Jefe"); got != want {
+		t.Errorf("ComputeHmac256 = %s, want %s", got, want)
+	}
+}